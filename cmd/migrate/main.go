@@ -69,5 +69,9 @@ func main() {
 		db.FirstOrCreate(&pm, database.ProtoMapping{ServiceID: pm.ServiceID, RPCMethod: pm.RPCMethod})
 	}
 
+	if _, err := database.RecordRevision(db, "system", "Seeded configuration from route/gate/auth.json"); err != nil {
+		log.Printf("Failed to record config revision: %v", err)
+	}
+
 	log.Println("Migration completed successfully!")
 }
@@ -18,6 +18,7 @@ type Config struct {
 	DBUser              string
 	DBPassword          string
 	DBName              string
+	RateLimitStore      string // "memory" or "database" to share limits between instances
 }
 
 var (
@@ -42,6 +43,7 @@ func Load() *Config {
 			DBUser:              os.Getenv("DB_USER"),
 			DBPassword:          os.Getenv("DB_PASSWORD"),
 			DBName:              os.Getenv("DB_NAME"),
+			RateLimitStore:      getEnv("RATE_LIMIT_STORE", "memory"),
 		}
 	})
 	return instance
@@ -0,0 +1,20 @@
+package cron
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+)
+
+// StartBreakerSync picks up circuit breakers forced or reset through other instances
+func StartBreakerSync() {
+	ticker := time.NewTicker(10 * time.Second)
+	go func() {
+		for range ticker.C {
+			if err := breaker.SyncOverrides(); err != nil {
+				log.Printf("Breaker Sync: Error loading overrides: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package cron
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/idempotency"
+)
+
+// StartIdempotencySweep deletes expired idempotency records from the database store
+func StartIdempotencySweep() {
+	ticker := time.NewTicker(10 * time.Minute)
+	go func() {
+		for range ticker.C {
+			db := database.GetDB()
+			if db == nil {
+				continue
+			}
+			if err := idempotency.NewDatabaseStore(db).Sweep(context.Background()); err != nil {
+				log.Printf("Idempotency Sweep: Error deleting expired records: %v", err)
+			}
+		}
+	}()
+}
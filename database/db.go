@@ -29,10 +29,22 @@ func Init() *gorm.DB {
 		}
 
 		// Auto-migrate the schema
-		err = db.AutoMigrate(&Service{}, &Route{}, &ProtoMapping{}, &ActivityLog{}, &RequestLog{}, &TraceLog{})
+		newRateLimits := !db.Migrator().HasTable(&RateLimitPolicy{})
+		err = db.AutoMigrate(&Service{}, &Route{}, &ProtoMapping{}, &ActivityLog{}, &RequestLog{}, &TraceLog{}, &ConfigRevision{}, &BreakerEvent{}, &BreakerOverride{}, &IdempotencyRecord{}, &RateLimitPolicy{}, &RateLimitCounter{}, &Quota{}, &QuotaUsage{}, &Fault{}, &Consumer{}, &ConsumerKey{}, &SignatureNonce{}, &ServiceSigningKey{}, &RevokedToken{})
 		if err != nil {
 			log.Fatalf("Failed to auto-migrate schema: %v", err)
 		}
+
+		// Keep the limit that used to be hard coded until admins configure their own
+		if newRateLimits {
+			if err := db.Create(DefaultRateLimitPolicy()).Error; err != nil {
+				log.Printf("Failed to create default rate limit policy: %v", err)
+			}
+		}
+
+		if err := EnsureBaselineRevision(db); err != nil {
+			log.Printf("Failed to record baseline config revision: %v", err)
+		}
 	})
 	return db
 }
@@ -15,6 +15,12 @@ type Service struct {
 	GRPCAddr  string
 	Status    string // "online", "offline", "unknown"
 	LastCheck *time.Time
+	// JSON encoded circuit breaker policy, empty for the defaults
+	CircuitBreaker string
+	// JSON encoded bulkhead policy, empty for no concurrency limit
+	Bulkhead string
+	// JSON encoded adaptive concurrency policy, empty to not shed load
+	AdaptiveConcurrency string
 }
 
 // Route represents a gateway route mapping
@@ -26,7 +32,8 @@ type Route struct {
 	Service        Service `gorm:"foreignKey:ServiceID"`
 	EndpointFilter string  // The handler identifier
 	Tag            string
-	Middleware     string // JSON encoded array of middleware names
+	Middleware     string // JSON encoded array of middleware names or {"name": ..., params} objects
+	Authorization  string // JSON encoded claims policy checked after the jwt middleware, empty for none
 }
 
 // ProtoMapping defines the mapping for gRPC calls
@@ -61,6 +68,7 @@ type RequestLog struct {
 	ClientIP     string
 	UserAgent    string
 	ErrorMessage string
+	Consumer     string `gorm:"index"` // Consumer of the API key the request was authenticated with
 }
 
 // TraceLog captures granular events for a specific request
@@ -71,3 +79,162 @@ type TraceLog struct {
 	Component string
 	Message   string
 }
+
+// ConfigRevision is a numbered snapshot of the gateway configuration
+type ConfigRevision struct {
+	gorm.Model
+	Author   string
+	Message  string
+	Snapshot string `gorm:"type:text" json:"-"` // JSON encoded ConfigSnapshot
+}
+
+// BreakerEvent records a circuit breaker state change
+type BreakerEvent struct {
+	gorm.Model
+	Key       string `gorm:"index"`
+	ServiceID uint   `gorm:"index"`
+	From      string
+	To        string
+	Reason    string
+}
+
+// BreakerOverride is a circuit breaker an admin forced open or closed. It is kept apart from
+// the config revisions, so a rollback does not take a service out of or back into maintenance.
+type BreakerOverride struct {
+	ServiceID uint   `gorm:"primaryKey"`
+	Mode      string // "open" or "closed"
+	Reason    string
+	Actor     string
+	UpdatedAt time.Time
+}
+
+// IdempotencyRecord stores the response of the first request made with an Idempotency-Key
+type IdempotencyRecord struct {
+	gorm.Model
+	Key         string `gorm:"uniqueIndex"`
+	Fingerprint string
+	Completed   bool
+	Status      int
+	Header      string `gorm:"type:text"` // JSON encoded response headers
+	Body        []byte
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// RateLimitPolicy limits the requests of each client key at the global, service or route level
+type RateLimitPolicy struct {
+	gorm.Model
+	Name     string
+	Scope    string // "global", "service" or "route"
+	TargetID uint   // Service or route ID of a scoped policy
+	Requests int    // Requests allowed per period
+	Period   string // Duration such as "1s" or "1m"
+	Burst    int    // Requests allowed at once, defaults to Requests
+	KeyBy    string // "ip", "header", "jwt_claim", "api_key" or "body"
+	KeyName  string // Header, claim or JSON body field the key is read from
+	Disabled bool
+}
+
+// RateLimitCounter counts the requests of a client key in one fixed window of a rate-limit policy
+type RateLimitCounter struct {
+	Key         string    `gorm:"primaryKey"`
+	WindowStart time.Time `gorm:"primaryKey"`
+	Count       int
+	ExpiresAt   time.Time `gorm:"index"`
+}
+
+// DefaultRateLimitPolicy allows every client IP 10 requests per second with a burst of 5
+func DefaultRateLimitPolicy() *RateLimitPolicy {
+	return &RateLimitPolicy{Name: "default", Scope: "global", Requests: 10, Period: "1s", Burst: 5, KeyBy: "ip"}
+}
+
+// Quota caps the requests of each client key per day or month at the global, service,
+// route tag or route level
+type Quota struct {
+	gorm.Model
+	Name         string
+	Scope        string // "global", "service", "tag" or "route"
+	TargetID     uint   // Service or route ID of a service or route quota
+	Tag          string // Route tag of a tag quota, covering e.g. both the REST and gRPC OTP routes
+	Requests     int64  // Requests allowed per interval
+	Interval     string // "day" or "month"
+	KeyBy        string // Same as RateLimitPolicy.KeyBy
+	KeyName      string
+	RejectCode   string // Error code of rejected requests, defaults to "016"
+	RejectStatus int    // HTTP status of rejected requests, defaults to 429
+	Disabled     bool
+}
+
+// QuotaUsage counts the requests of a client key against a quota in one day or month
+type QuotaUsage struct {
+	QuotaID     uint      `gorm:"primaryKey"`
+	Key         string    `gorm:"primaryKey"`
+	PeriodStart time.Time `gorm:"primaryKey"`
+	Count       int64
+	UpdatedAt   time.Time
+}
+
+// Fault injects latency, an error or a broken body into a share of a route's traffic for chaos testing
+type Fault struct {
+	gorm.Model
+	Name        string
+	RouteID     uint      `gorm:"index"`
+	Type        string    // "latency", "abort", "corrupt" or "truncate"
+	Percentage  float64   // Share of matching requests affected, from 0 to 100
+	Delay       string    // latency: duration such as "2s"
+	Status      int       // abort: HTTP status returned to the client
+	GRPCCode    string    // abort: gRPC status such as "UNAVAILABLE" the upstream call fails with
+	HeaderName  string    // Only requests with this header are affected
+	HeaderValue string    // Value HeaderName must have, any value if empty
+	ExpiresAt   time.Time `gorm:"index"`
+	Disabled    bool
+}
+
+// Consumer is a client application or partner that calls the gateway with API keys
+type Consumer struct {
+	gorm.Model
+	Name          string `gorm:"uniqueIndex"`
+	Description   string
+	Scopes        string // Comma separated scopes granted to the consumer's keys
+	AllowedRoutes string // Comma separated route tags or "METHOD /path" routes, empty for every route
+	SigningSecret string `json:"-"` // HMAC secret of signed requests, shown once when it is generated
+	Priority      string // Load shedding priority of the consumer's requests: "high", "normal" or "low", empty for normal
+	Disabled      bool
+}
+
+// ConsumerKey is an API key of a consumer. Only its hash is stored.
+type ConsumerKey struct {
+	gorm.Model
+	ConsumerID uint     `gorm:"index"`
+	Consumer   Consumer `gorm:"foreignKey:ConsumerID" json:"-"`
+	Prefix     string   // Start of the key, so admins can tell keys apart
+	Hash       string   `gorm:"uniqueIndex" json:"-"` // SHA-256 of the key
+	ExpiresAt  *time.Time
+	Revoked    bool
+	RevokedAt  *time.Time
+	LastUsedAt *time.Time
+}
+
+// ServiceSigningKey is the key the gateway signs calls to a service with. Services without
+// one get unsigned calls.
+type ServiceSigningKey struct {
+	gorm.Model
+	ServiceID uint   `gorm:"uniqueIndex"`
+	KeyID     string // "kid" of the tokens, so services can accept the old key while it rotates
+	Secret    string `json:"-"`
+}
+
+// RevokedToken is an entry of the access token revocation list, kept until the token expires
+type RevokedToken struct {
+	Key       string `gorm:"primaryKey"` // Kind and value
+	Kind      string // "jti" for one token, "sid" for a session
+	Value     string
+	ExpiresAt time.Time `gorm:"index"`
+	Reason    string
+	CreatedAt time.Time
+}
+
+// SignatureNonce remembers the nonce of a signed request until its timestamp is no longer accepted
+type SignatureNonce struct {
+	Key       string    `gorm:"primaryKey"` // Client and nonce
+	ExpiresAt time.Time `gorm:"index"`
+}
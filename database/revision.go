@@ -0,0 +1,368 @@
+package database
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConfigSnapshot is the full set of services, routes, proto mappings and rate limits at a point in time
+type ConfigSnapshot struct {
+	Services          []Service         `json:"services"`
+	Routes            []Route           `json:"routes"`
+	ProtoMappings     []ProtoMapping    `json:"proto_mappings"`
+	RateLimitPolicies []RateLimitPolicy `json:"rate_limit_policies"` // Nil in revisions recorded before rate limits were configurable
+	Quotas            []Quota           `json:"quotas"`              // Nil in revisions recorded before quotas
+}
+
+// ConfigChange describes how a single resource differs between two snapshots
+type ConfigChange struct {
+	Resource string                 `json:"resource"`
+	ID       uint                   `json:"id"`
+	Name     string                 `json:"name"`
+	Change   string                 `json:"change"` // "added", "removed" or "modified"
+	Fields   map[string]FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange holds the old and new value of a modified field
+type FieldChange struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Fields that change at runtime or are bookkeeping only, so they are not part of a diff
+var ignoredDiffFields = map[string]bool{
+	"ID":        true,
+	"CreatedAt": true,
+	"UpdatedAt": true,
+	"DeletedAt": true,
+	"Service":   true,
+	"Status":    true,
+	"LastCheck": true,
+}
+
+// CaptureSnapshot reads the current configuration
+func CaptureSnapshot(tx *gorm.DB) (*ConfigSnapshot, error) {
+	snap := &ConfigSnapshot{}
+	if err := tx.Order("id").Find(&snap.Services).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order("id").Find(&snap.Routes).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order("id").Find(&snap.ProtoMappings).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Order("id").Find(&snap.RateLimitPolicies).Error; err != nil {
+		return nil, err
+	}
+	if snap.RateLimitPolicies == nil {
+		snap.RateLimitPolicies = []RateLimitPolicy{}
+	}
+	if err := tx.Order("id").Find(&snap.Quotas).Error; err != nil {
+		return nil, err
+	}
+	if snap.Quotas == nil {
+		snap.Quotas = []Quota{}
+	}
+	return snap, nil
+}
+
+// RecordRevision captures the current configuration and stores it as a new revision
+func RecordRevision(tx *gorm.DB, author, message string) (*ConfigRevision, error) {
+	snap, err := CaptureSnapshot(tx)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return nil, err
+	}
+
+	rev := &ConfigRevision{
+		Author:   author,
+		Message:  message,
+		Snapshot: string(data),
+	}
+	if err := tx.Create(rev).Error; err != nil {
+		return nil, err
+	}
+	return rev, nil
+}
+
+// EnsureBaselineRevision records the initial configuration if no revision exists yet
+func EnsureBaselineRevision(tx *gorm.DB) error {
+	var count int64
+	if err := tx.Model(&ConfigRevision{}).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+	_, err := RecordRevision(tx, "system", "Baseline configuration")
+	return err
+}
+
+// Decode returns the snapshot stored in the revision
+func (r *ConfigRevision) Decode() (*ConfigSnapshot, error) {
+	snap := &ConfigSnapshot{}
+	if err := json.Unmarshal([]byte(r.Snapshot), snap); err != nil {
+		return nil, fmt.Errorf("revision %d has a corrupt snapshot: %v", r.ID, err)
+	}
+	return snap, nil
+}
+
+// RestoreSnapshot replaces the current configuration with the snapshot.
+// Rows keep their original IDs so health stats and foreign keys stay valid: rows the
+// snapshot contains are brought back by ID, soft-deleted ones included, and the others
+// are soft-deleted. It should be called inside a transaction.
+func RestoreSnapshot(tx *gorm.DB, snap *ConfigSnapshot) error {
+	serviceIDs, names := make([]uint, 0, len(snap.Services)), make([]string, 0, len(snap.Services))
+	for _, s := range snap.Services {
+		serviceIDs = append(serviceIDs, s.ID)
+		names = append(names, s.Name)
+	}
+	routeIDs, paths := make([]uint, 0, len(snap.Routes)), make([]string, 0, len(snap.Routes))
+	for _, r := range snap.Routes {
+		routeIDs = append(routeIDs, r.ID)
+		paths = append(paths, r.Path)
+	}
+	mappingIDs := make([]uint, 0, len(snap.ProtoMappings))
+	for _, m := range snap.ProtoMappings {
+		mappingIDs = append(mappingIDs, m.ID)
+	}
+
+	// Rows outside the snapshot may hold a name or path it needs, e.g. a route deleted and
+	// created again since. They are removed for good, services with their routes and mappings.
+	services, err := takenBy(tx, &Service{}, "name", names, serviceIDs)
+	if err != nil {
+		return err
+	}
+	if len(services) > 0 {
+		for _, model := range []interface{}{&ProtoMapping{}, &Route{}} {
+			if err := tx.Unscoped().Where("service_id IN ?", services).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Unscoped().Delete(&Service{}, services).Error; err != nil {
+			return err
+		}
+	}
+	routes, err := takenBy(tx, &Route{}, "path", paths, routeIDs)
+	if err != nil {
+		return err
+	}
+	if len(routes) > 0 {
+		if err := tx.Unscoped().Delete(&Route{}, routes).Error; err != nil {
+			return err
+		}
+	}
+
+	// Parents first so foreign keys are never left dangling
+	if len(snap.Services) > 0 {
+		if err := restoreRows(tx, &snap.Services); err != nil {
+			return err
+		}
+	}
+	if len(snap.Routes) > 0 {
+		if err := restoreRows(tx, &snap.Routes); err != nil {
+			return err
+		}
+	}
+	if len(snap.ProtoMappings) > 0 {
+		if err := restoreRows(tx, &snap.ProtoMappings); err != nil {
+			return err
+		}
+	}
+	if err := deleteOthers(tx, &ProtoMapping{}, mappingIDs); err != nil {
+		return err
+	}
+	if err := deleteOthers(tx, &Route{}, routeIDs); err != nil {
+		return err
+	}
+	if err := deleteOthers(tx, &Service{}, serviceIDs); err != nil {
+		return err
+	}
+
+	// Revisions from before rate limits were configurable leave the current policies alone
+	if snap.RateLimitPolicies != nil {
+		ids := make([]uint, 0, len(snap.RateLimitPolicies))
+		for _, p := range snap.RateLimitPolicies {
+			ids = append(ids, p.ID)
+		}
+		if len(snap.RateLimitPolicies) > 0 {
+			if err := restoreRows(tx, &snap.RateLimitPolicies); err != nil {
+				return err
+			}
+		}
+		if err := deleteOthers(tx, &RateLimitPolicy{}, ids); err != nil {
+			return err
+		}
+	}
+	if snap.Quotas != nil {
+		ids := make([]uint, 0, len(snap.Quotas))
+		for _, q := range snap.Quotas {
+			ids = append(ids, q.ID)
+		}
+		if len(snap.Quotas) > 0 {
+			if err := restoreRows(tx, &snap.Quotas); err != nil {
+				return err
+			}
+		}
+		if err := deleteOthers(tx, &Quota{}, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takenBy returns the rows of model outside ids, soft-deleted or not, whose column holds
+// one of values
+func takenBy(tx *gorm.DB, model interface{}, column string, values []string, ids []uint) ([]uint, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	q := tx.Unscoped().Model(model).Where(column+" IN ?", values)
+	if len(ids) > 0 {
+		q = q.Where("id NOT IN ?", ids)
+	}
+	var taken []uint
+	return taken, q.Pluck("id", &taken).Error
+}
+
+// deleteOthers soft-deletes the rows of model in use that are not among ids
+func deleteOthers(tx *gorm.DB, model interface{}, ids []uint) error {
+	q := tx.Session(&gorm.Session{AllowGlobalUpdate: true})
+	if len(ids) > 0 {
+		q = q.Where("id NOT IN ?", ids)
+	}
+	return q.Delete(model).Error
+}
+
+// restoreRows inserts the snapshot's rows. A row that still exists, soft-deleted or not,
+// is brought back with the snapshot's values.
+func restoreRows(tx *gorm.DB, rows interface{}) error {
+	return tx.Omit(clause.Associations).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "id"}},
+		UpdateAll: true,
+	}).Create(rows).Error
+}
+
+// DiffSnapshots lists every service, route, proto mapping, rate limit and quota that differs between two snapshots
+func DiffSnapshots(from, to *ConfigSnapshot) []ConfigChange {
+	var changes []ConfigChange
+	changes = append(changes, diffResources("Service", serviceEntries(from.Services), serviceEntries(to.Services))...)
+	changes = append(changes, diffResources("Route", routeEntries(from.Routes), routeEntries(to.Routes))...)
+	changes = append(changes, diffResources("ProtoMapping", mappingEntries(from.ProtoMappings), mappingEntries(to.ProtoMappings))...)
+	if from.RateLimitPolicies != nil && to.RateLimitPolicies != nil {
+		changes = append(changes, diffResources("RateLimitPolicy", policyEntries(from.RateLimitPolicies), policyEntries(to.RateLimitPolicies))...)
+	}
+	if from.Quotas != nil && to.Quotas != nil {
+		changes = append(changes, diffResources("Quota", quotaEntries(from.Quotas), quotaEntries(to.Quotas))...)
+	}
+	return changes
+}
+
+type diffEntry struct {
+	name   string
+	fields map[string]interface{}
+}
+
+func serviceEntries(services []Service) map[uint]diffEntry {
+	entries := make(map[uint]diffEntry, len(services))
+	for _, s := range services {
+		entries[s.ID] = diffEntry{name: s.Name, fields: diffFields(s)}
+	}
+	return entries
+}
+
+func routeEntries(routes []Route) map[uint]diffEntry {
+	entries := make(map[uint]diffEntry, len(routes))
+	for _, r := range routes {
+		entries[r.ID] = diffEntry{name: r.Method + " " + r.Path, fields: diffFields(r)}
+	}
+	return entries
+}
+
+func mappingEntries(mappings []ProtoMapping) map[uint]diffEntry {
+	entries := make(map[uint]diffEntry, len(mappings))
+	for _, m := range mappings {
+		entries[m.ID] = diffEntry{name: m.ServiceName + "/" + m.RPCMethod, fields: diffFields(m)}
+	}
+	return entries
+}
+
+func policyEntries(policies []RateLimitPolicy) map[uint]diffEntry {
+	entries := make(map[uint]diffEntry, len(policies))
+	for _, p := range policies {
+		entries[p.ID] = diffEntry{name: p.Name, fields: diffFields(p)}
+	}
+	return entries
+}
+
+func quotaEntries(quotas []Quota) map[uint]diffEntry {
+	entries := make(map[uint]diffEntry, len(quotas))
+	for _, q := range quotas {
+		entries[q.ID] = diffEntry{name: q.Name, fields: diffFields(q)}
+	}
+	return entries
+}
+
+// diffFields flattens a model into its JSON fields without the ignored ones
+func diffFields(v interface{}) map[string]interface{} {
+	var fields map[string]interface{}
+	data, _ := json.Marshal(v)
+	_ = json.Unmarshal(data, &fields)
+	for k := range fields {
+		if ignoredDiffFields[k] {
+			delete(fields, k)
+		}
+	}
+	return fields
+}
+
+func diffResources(resource string, from, to map[uint]diffEntry) []ConfigChange {
+	ids := make([]uint, 0, len(from)+len(to))
+	for id := range from {
+		ids = append(ids, id)
+	}
+	for id := range to {
+		if _, ok := from[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var changes []ConfigChange
+	for _, id := range ids {
+		before, hadBefore := from[id]
+		after, hasAfter := to[id]
+
+		switch {
+		case !hadBefore:
+			changes = append(changes, ConfigChange{Resource: resource, ID: id, Name: after.name, Change: "added"})
+		case !hasAfter:
+			changes = append(changes, ConfigChange{Resource: resource, ID: id, Name: before.name, Change: "removed"})
+		default:
+			fields := make(map[string]FieldChange)
+			for k, v := range after.fields {
+				if !reflect.DeepEqual(before.fields[k], v) {
+					fields[k] = FieldChange{From: before.fields[k], To: v}
+				}
+			}
+			for k, v := range before.fields {
+				if _, ok := after.fields[k]; !ok {
+					fields[k] = FieldChange{From: v}
+				}
+			}
+			if len(fields) > 0 {
+				changes = append(changes, ConfigChange{Resource: resource, ID: id, Name: after.name, Change: "modified", Fields: fields})
+			}
+		}
+	}
+	return changes
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestDiffSnapshots(t *testing.T) {
+	from := &ConfigSnapshot{
+		Services: []Service{
+			{Model: gorm.Model{ID: 1}, Name: "auth-service", BaseURL: "http://auth:8081", Protocol: "rest", Status: "online"},
+		},
+		Routes: []Route{
+			{Model: gorm.Model{ID: 1}, Path: "/api/v1/auth/login", Method: "POST", ServiceID: 1, EndpointFilter: "login"},
+			{Model: gorm.Model{ID: 2}, Path: "/api/v1/auth/logout", Method: "POST", ServiceID: 1, EndpointFilter: "logout"},
+		},
+	}
+	to := &ConfigSnapshot{
+		Services: []Service{
+			{Model: gorm.Model{ID: 1}, Name: "auth-service", BaseURL: "http://auth:9091", Protocol: "rest", Status: "offline"},
+		},
+		Routes: []Route{
+			{Model: gorm.Model{ID: 1}, Path: "/api/v1/auth/login", Method: "POST", ServiceID: 1, EndpointFilter: "login"},
+			{Model: gorm.Model{ID: 3}, Path: "/api/v1/auth/profile", Method: "GET", ServiceID: 1, EndpointFilter: "profile"},
+		},
+		ProtoMappings: []ProtoMapping{
+			{Model: gorm.Model{ID: 1}, ServiceID: 1, ServiceName: "AuthService", RPCMethod: "Login"},
+		},
+	}
+
+	changes := DiffSnapshots(from, to)
+	if assert.Len(t, changes, 4) {
+		// Status is runtime state and must not show up as a config change
+		assert.Equal(t, "Service", changes[0].Resource)
+		assert.Equal(t, "modified", changes[0].Change)
+		assert.Equal(t, map[string]FieldChange{"BaseURL": {From: "http://auth:8081", To: "http://auth:9091"}}, changes[0].Fields)
+
+		assert.Equal(t, ConfigChange{Resource: "Route", ID: 2, Name: "POST /api/v1/auth/logout", Change: "removed"}, changes[1])
+		assert.Equal(t, ConfigChange{Resource: "Route", ID: 3, Name: "GET /api/v1/auth/profile", Change: "added"}, changes[2])
+		assert.Equal(t, ConfigChange{Resource: "ProtoMapping", ID: 1, Name: "AuthService/Login", Change: "added"}, changes[3])
+	}
+
+	assert.Empty(t, DiffSnapshots(to, to))
+}
+
+// testDB opens a transaction on the Postgres database in TEST_DATABASE_DSN that is rolled
+// back after the test. Tests that need a database are skipped without one.
+func testDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&Service{}, &Route{}, &ProtoMapping{}, &RateLimitPolicy{}, &Quota{}))
+
+	tx := db.Begin()
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// seedRollback creates a service with two routes and returns the snapshot holding them
+func seedRollback(t *testing.T, tx *gorm.DB) *ConfigSnapshot {
+	require.NoError(t, tx.Create(&Service{Model: gorm.Model{ID: 900001}, Name: "rollback-test", BaseURL: "http://rollback", Protocol: "rest"}).Error)
+	require.NoError(t, tx.Create(&[]Route{
+		{Model: gorm.Model{ID: 900001}, Path: "/rollback/a", Method: "GET", ServiceID: 900001, EndpointFilter: "rollback-a"},
+		{Model: gorm.Model{ID: 900002}, Path: "/rollback/b", Method: "GET", ServiceID: 900001, EndpointFilter: "rollback-b"},
+	}).Error)
+	snap, err := CaptureSnapshot(tx)
+	require.NoError(t, err)
+	return snap
+}
+
+func TestRestoreSnapshotAfterDeletingRoute(t *testing.T) {
+	tx := testDB(t)
+	snap := seedRollback(t, tx)
+
+	require.NoError(t, tx.Delete(&Route{}, 900002).Error)
+	// A service added since, with a deleted route still pointing at it
+	require.NoError(t, tx.Create(&Service{Model: gorm.Model{ID: 900002}, Name: "rollback-later", BaseURL: "http://later", Protocol: "rest"}).Error)
+	require.NoError(t, tx.Create(&Route{Model: gorm.Model{ID: 900003}, Path: "/rollback/later", Method: "GET", ServiceID: 900002, EndpointFilter: "rollback-later"}).Error)
+	require.NoError(t, tx.Delete(&Route{}, 900003).Error)
+
+	require.NoError(t, RestoreSnapshot(tx, snap))
+
+	var routes []Route
+	require.NoError(t, tx.Where("service_id = ?", 900001).Order("id").Find(&routes).Error)
+	if assert.Len(t, routes, 2) {
+		assert.Equal(t, "/rollback/b", routes[1].Path)
+	}
+
+	var later Service
+	require.NoError(t, tx.Unscoped().First(&later, 900002).Error)
+	assert.True(t, later.DeletedAt.Valid, "services added since are soft-deleted")
+	var deleted Route
+	require.NoError(t, tx.Unscoped().First(&deleted, 900003).Error)
+	assert.True(t, deleted.DeletedAt.Valid, "deleted routes are kept")
+}
+
+func TestRestoreSnapshotFreesReusedPath(t *testing.T) {
+	tx := testDB(t)
+	snap := seedRollback(t, tx)
+
+	// Rollbacks used to remove rows for good, so a path could be taken by a new route
+	require.NoError(t, tx.Unscoped().Delete(&Route{}, 900002).Error)
+	require.NoError(t, tx.Create(&Route{Model: gorm.Model{ID: 900004}, Path: "/rollback/b", Method: "POST", ServiceID: 900001, EndpointFilter: "rollback-b2"}).Error)
+
+	require.NoError(t, RestoreSnapshot(tx, snap))
+
+	var route Route
+	require.NoError(t, tx.Where("path = ?", "/rollback/b").First(&route).Error)
+	assert.Equal(t, uint(900002), route.ID)
+	assert.Equal(t, "GET", route.Method)
+}
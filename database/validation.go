@@ -0,0 +1,111 @@
+package database
+
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ConfigProblem is a single issue found while validating a configuration
+type ConfigProblem struct {
+	Severity string `json:"severity"`
+	Resource string `json:"resource"`
+	ID       uint   `json:"id,omitempty"`
+	Name     string `json:"name"`
+	Message  string `json:"message"`
+}
+
+// HasErrors reports whether any problem is severe enough to block a config change
+func HasErrors(problems []ConfigProblem) bool {
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// NewErrors returns the errors in after that were not already present in before,
+// so pre-existing problems do not block unrelated changes
+func NewErrors(before, after []ConfigProblem) []ConfigProblem {
+	existing := make(map[ConfigProblem]bool, len(before))
+	for _, p := range before {
+		existing[p] = true
+	}
+
+	var introduced []ConfigProblem
+	for _, p := range after {
+		if p.Severity == SeverityError && !existing[p] {
+			introduced = append(introduced, p)
+		}
+	}
+	return introduced
+}
+
+// Overlay applies proposed changes on top of the snapshot. Entries with a matching ID
+// replace the current one and entries without an ID are added.
+func (s *ConfigSnapshot) Overlay(changes *ConfigSnapshot) *ConfigSnapshot {
+	out := &ConfigSnapshot{
+		Services:          append([]Service(nil), s.Services...),
+		Routes:            append([]Route(nil), s.Routes...),
+		ProtoMappings:     append([]ProtoMapping(nil), s.ProtoMappings...),
+		RateLimitPolicies: append([]RateLimitPolicy(nil), s.RateLimitPolicies...),
+		Quotas:            append([]Quota(nil), s.Quotas...),
+	}
+
+nextService:
+	for _, svc := range changes.Services {
+		for i := range out.Services {
+			if svc.ID != 0 && out.Services[i].ID == svc.ID {
+				out.Services[i] = svc
+				continue nextService
+			}
+		}
+		out.Services = append(out.Services, svc)
+	}
+
+nextRoute:
+	for _, r := range changes.Routes {
+		for i := range out.Routes {
+			if r.ID != 0 && out.Routes[i].ID == r.ID {
+				out.Routes[i] = r
+				continue nextRoute
+			}
+		}
+		out.Routes = append(out.Routes, r)
+	}
+
+nextMapping:
+	for _, m := range changes.ProtoMappings {
+		for i := range out.ProtoMappings {
+			if m.ID != 0 && out.ProtoMappings[i].ID == m.ID {
+				out.ProtoMappings[i] = m
+				continue nextMapping
+			}
+		}
+		out.ProtoMappings = append(out.ProtoMappings, m)
+	}
+
+nextPolicy:
+	for _, p := range changes.RateLimitPolicies {
+		for i := range out.RateLimitPolicies {
+			if p.ID != 0 && out.RateLimitPolicies[i].ID == p.ID {
+				out.RateLimitPolicies[i] = p
+				continue nextPolicy
+			}
+		}
+		out.RateLimitPolicies = append(out.RateLimitPolicies, p)
+	}
+
+nextQuota:
+	for _, q := range changes.Quotas {
+		for i := range out.Quotas {
+			if q.ID != 0 && out.Quotas[i].ID == q.ID {
+				out.Quotas[i] = q
+				continue nextQuota
+			}
+		}
+		out.Quotas = append(out.Quotas, q)
+	}
+
+	return out
+}
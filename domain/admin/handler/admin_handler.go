@@ -5,15 +5,29 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	customMw "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route/middleware"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/logbuffer"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/metrics"
+	"gorm.io/gorm"
 )
 
-type AdminHandler struct{}
+// Gateway is the running router managed by the admin API
+type Gateway interface {
+	Reload() error
+	Validate(snap *database.ConfigSnapshot) []database.ConfigProblem
+	MiddlewareSchemas() []customMw.MiddlewareSchema
+}
+
+type AdminHandler struct {
+	gateway Gateway
+}
 
-func NewAdminHandler() *AdminHandler {
-	return &AdminHandler{}
+func NewAdminHandler(gateway Gateway) *AdminHandler {
+	return &AdminHandler{gateway: gateway}
 }
 
 // --- Service Handlers ---
@@ -32,11 +46,12 @@ func (h *AdminHandler) CreateService(c echo.Context) error {
 	if err := c.Bind(service); err != nil {
 		return err
 	}
-	db := database.GetDB()
-	if err := db.Create(service).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Created Service: "+service.Name, func(tx *gorm.DB) error {
+		return tx.Create(service).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
-	util.LogCreate("Service", "admin", service.Name)
+	util.LogCreate("Service", actor(c), service.Name)
 	return c.JSON(http.StatusCreated, service)
 }
 
@@ -50,18 +65,23 @@ func (h *AdminHandler) UpdateService(c echo.Context) error {
 	if err := c.Bind(&service); err != nil {
 		return err
 	}
-	db.Save(&service)
-	util.LogUpdate("Service", "admin", service.Name)
+	if err := h.commit(c, "Updated Service: "+service.Name, func(tx *gorm.DB) error {
+		return tx.Save(&service).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogUpdate("Service", actor(c), service.Name)
 	return c.JSON(http.StatusOK, service)
 }
 
 func (h *AdminHandler) DeleteService(c echo.Context) error {
 	id := c.Param("id")
-	db := database.GetDB()
-	if err := db.Delete(&database.Service{}, id).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Deleted Service ID: "+id, func(tx *gorm.DB) error {
+		return tx.Delete(&database.Service{}, id).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
-	util.LogDelete("Service", "admin", "ID: "+id)
+	util.LogDelete("Service", actor(c), "ID: "+id)
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -81,11 +101,12 @@ func (h *AdminHandler) CreateRoute(c echo.Context) error {
 	if err := c.Bind(route); err != nil {
 		return err
 	}
-	db := database.GetDB()
-	if err := db.Create(route).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Created Route: "+route.Path, func(tx *gorm.DB) error {
+		return tx.Create(route).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
-	util.LogCreate("Route", "admin", route.Path)
+	util.LogCreate("Route", actor(c), route.Path)
 	return c.JSON(http.StatusCreated, route)
 }
 
@@ -99,21 +120,31 @@ func (h *AdminHandler) UpdateRoute(c echo.Context) error {
 	if err := c.Bind(&route); err != nil {
 		return err
 	}
-	db.Save(&route)
-	util.LogUpdate("Route", "admin", route.Path)
+	if err := h.commit(c, "Updated Route: "+route.Path, func(tx *gorm.DB) error {
+		return tx.Save(&route).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogUpdate("Route", actor(c), route.Path)
 	return c.JSON(http.StatusOK, route)
 }
 
 func (h *AdminHandler) DeleteRoute(c echo.Context) error {
 	id := c.Param("id")
-	db := database.GetDB()
-	if err := db.Delete(&database.Route{}, id).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Deleted Route ID: "+id, func(tx *gorm.DB) error {
+		return tx.Delete(&database.Route{}, id).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
-	util.LogDelete("Route", "admin", "ID: "+id)
+	util.LogDelete("Route", actor(c), "ID: "+id)
 	return c.NoContent(http.StatusNoContent)
 }
 
+// GetMiddlewareSchemas lists the middleware types a route can use and their parameters
+func (h *AdminHandler) GetMiddlewareSchemas(c echo.Context) error {
+	return c.JSON(http.StatusOK, h.gateway.MiddlewareSchemas())
+}
+
 // --- Proto Mapping Handlers ---
 
 func (h *AdminHandler) GetProtoMappings(c echo.Context) error {
@@ -130,9 +161,10 @@ func (h *AdminHandler) CreateProtoMapping(c echo.Context) error {
 	if err := c.Bind(mapping); err != nil {
 		return err
 	}
-	db := database.GetDB()
-	if err := db.Create(mapping).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Created ProtoMapping: "+mapping.RPCMethod, func(tx *gorm.DB) error {
+		return tx.Create(mapping).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
 	return c.JSON(http.StatusCreated, mapping)
 }
@@ -147,17 +179,22 @@ func (h *AdminHandler) UpdateProtoMapping(c echo.Context) error {
 	if err := c.Bind(&mapping); err != nil {
 		return err
 	}
-	db.Save(&mapping)
+	if err := h.commit(c, "Updated ProtoMapping: "+mapping.RPCMethod, func(tx *gorm.DB) error {
+		return tx.Save(&mapping).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
 	return c.JSON(http.StatusOK, mapping)
 }
 
 func (h *AdminHandler) DeleteProtoMapping(c echo.Context) error {
 	id := c.Param("id")
-	db := database.GetDB()
-	if err := db.Delete(&database.ProtoMapping{}, id).Error; err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	if err := h.commit(c, "Deleted ProtoMapping ID: "+id, func(tx *gorm.DB) error {
+		return tx.Delete(&database.ProtoMapping{}, id).Error
+	}); err != nil {
+		return commitError(c, err)
 	}
-	util.LogDelete("ProtoMapping", "admin", "ID: "+id)
+	util.LogDelete("ProtoMapping", actor(c), "ID: "+id)
 	return c.NoContent(http.StatusNoContent)
 }
 
@@ -199,19 +236,22 @@ func (h *AdminHandler) GetMetrics(c echo.Context) error {
 	db.Find(&services)
 
 	for _, s := range services {
-		stats := util.GetHealthStats(s.ID)
+		stats := breaker.ForService(s).Stats()
 		m := metrics.DefaultRegistry.GetServiceMetrics(s.Name)
-		m.HealthScore = stats.GetHealthScore()
-
-		status := "CLOSED"
-		switch stats.State {
-		case util.StateOpen:
-			status = "OPEN"
-		case util.StateHalfOpen:
-			status = "HALF-OPEN"
+		m.HealthScore = stats.HealthScore
+		m.CircuitStatus = stats.State.String()
+		m.InFlight, m.Queued = 0, 0
+		if bh, ok := bulkhead.Default.Lookup(breaker.ServiceKey(s.ID)); ok {
+			bs := bh.Stats()
+			m.InFlight, m.Queued = bs.InFlight, bs.Queued
+		}
+		m.AdaptiveLimit = 0
+		if l, ok := adaptive.Default.Lookup(breaker.ServiceKey(s.ID)); ok {
+			m.AdaptiveLimit = l.Stats().Limit
 		}
-		m.CircuitStatus = status
 	}
+	metrics.DefaultRegistry.SetBulkheads(bulkhead.Default.All())
+	metrics.DefaultRegistry.SetAdaptive(adaptive.Default.All())
 
 	return c.JSON(http.StatusOK, metrics.DefaultRegistry)
 }
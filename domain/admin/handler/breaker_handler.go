@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gorm.io/gorm"
+)
+
+// BreakerStatus is the breaker state of a service, its routes and its recent transitions
+type BreakerStatus struct {
+	ServiceID   uint                    `json:"service_id"`
+	ServiceName string                  `json:"service_name"`
+	Breaker     breaker.Stats           `json:"breaker"`
+	Routes      []breaker.Stats         `json:"routes"`
+	Events      []database.BreakerEvent `json:"events"`
+}
+
+// BreakerAction is the optional body of a force open or close request
+type BreakerAction struct {
+	Reason string `json:"reason"` // Shown to clients in the maintenance response when forcing open
+}
+
+func (h *AdminHandler) GetServiceBreaker(c echo.Context) error {
+	svc, err := loadService(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return h.breakerStatus(c, svc)
+}
+
+func (h *AdminHandler) ForceOpenServiceBreaker(c echo.Context) error {
+	return h.forceServiceBreaker(c, breaker.ForceOpen)
+}
+
+func (h *AdminHandler) ForceCloseServiceBreaker(c echo.Context) error {
+	return h.forceServiceBreaker(c, breaker.ForceClosed)
+}
+
+func (h *AdminHandler) ResetServiceBreaker(c echo.Context) error {
+	svc, err := loadService(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := breaker.DeleteOverride(c.Request().Context(), svc.ID); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	breaker.ForService(svc).Reset()
+	util.LogActivity("BREAKER_RESET", "Service", actor(c), "Reset circuit breaker of "+svc.Name)
+	return h.breakerStatus(c, svc)
+}
+
+func (h *AdminHandler) forceServiceBreaker(c echo.Context, mode string) error {
+	svc, err := loadService(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	action := new(BreakerAction)
+	if c.Request().ContentLength > 0 {
+		if err := c.Bind(action); err != nil {
+			return err
+		}
+	}
+	// Persisted first, so the override survives restarts and reaches the other instances
+	if err := breaker.SaveOverride(c.Request().Context(), svc.ID, mode, action.Reason, actor(c)); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if err := breaker.ForService(svc).Force(mode, action.Reason); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	message := fmt.Sprintf("Forced circuit breaker of %s %s", svc.Name, mode)
+	if action.Reason != "" {
+		message += ": " + action.Reason
+	}
+	util.LogActivity("BREAKER_FORCE_"+strings.ToUpper(mode), "Service", actor(c), message)
+	return h.breakerStatus(c, svc)
+}
+
+func (h *AdminHandler) breakerStatus(c echo.Context, svc database.Service) error {
+	status := BreakerStatus{
+		ServiceID:   svc.ID,
+		ServiceName: svc.Name,
+		Breaker:     breaker.ForService(svc).Stats(),
+		Routes:      []breaker.Stats{},
+	}
+	prefix := breaker.ServiceKey(svc.ID) + " "
+	for _, stats := range breaker.Default.All() {
+		if strings.HasPrefix(stats.Key, prefix) {
+			status.Routes = append(status.Routes, stats)
+		}
+	}
+
+	db := database.GetDB()
+	if err := db.Where("service_id = ?", svc.ID).Order("id desc").Limit(50).Find(&status.Events).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, status)
+}
+
+func loadService(id string) (database.Service, error) {
+	var svc database.Service
+	db := database.GetDB()
+	if err := db.First(&svc, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return svc, echo.NewHTTPError(http.StatusNotFound, "Service not found")
+		}
+		return svc, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return svc, nil
+}
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+	"gorm.io/gorm"
+)
+
+// PurgeCache removes cached responses of a route (?route_id=) or with a key prefix (?prefix=)
+func (h *AdminHandler) PurgeCache(c echo.Context) error {
+	routeID := c.QueryParam("route_id")
+	prefix := c.QueryParam("prefix")
+
+	var purged int
+	var target string
+	switch {
+	case routeID != "":
+		var route database.Route
+		db := database.GetDB()
+		if err := db.First(&route, routeID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return echo.NewHTTPError(http.StatusNotFound, "Route not found")
+			}
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		target = cache.RouteName(route.Method, route.Path)
+		purged = cache.Default.PurgeRoute(target)
+	case prefix != "":
+		target = "prefix " + prefix
+		purged = cache.Default.PurgePrefix(prefix)
+	default:
+		return echo.NewHTTPError(http.StatusBadRequest, "route_id or prefix is required")
+	}
+
+	util.LogActivity("CACHE_PURGE", "Cache", actor(c), fmt.Sprintf("Purged %d cached response(s) of %s", purged, target))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"purged":    purged,
+		"remaining": cache.Default.Len(),
+	})
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+)
+
+// --- Consumer Handlers ---
+//
+// Consumers and their keys are credentials rather than configuration, so they are not part
+// of config revisions and a rollback never brings a revoked key back.
+
+// defaultRotationGrace is how long replaced keys keep working after a rotation
+const defaultRotationGrace = 24 * time.Hour
+
+// IssuedKey is a new key together with its only plain text copy
+type IssuedKey struct {
+	database.ConsumerKey
+	Key string
+}
+
+type keyRequest struct {
+	ExpiresIn string `json:"expires_in"` // Lifetime of the new key, it never expires if empty
+	Grace     string `json:"grace"`      // How long the replaced keys keep working after a rotation
+}
+
+func (h *AdminHandler) GetConsumers(c echo.Context) error {
+	var consumers []database.Consumer
+	db := database.GetDB()
+	if err := db.Order("id").Find(&consumers).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, consumers)
+}
+
+func validateConsumer(cons *database.Consumer) error {
+	if cons.Name == "" {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "name is required")
+	}
+	if cons.Priority != "" && !adaptive.ValidPriority(cons.Priority) {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "priority must be high, normal or low")
+	}
+	return nil
+}
+
+func (h *AdminHandler) CreateConsumer(c echo.Context) error {
+	cons := new(database.Consumer)
+	if err := c.Bind(cons); err != nil {
+		return err
+	}
+	if err := validateConsumer(cons); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Create(cons).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogCreate("Consumer", actor(c), cons.Name)
+	return c.JSON(http.StatusCreated, cons)
+}
+
+func (h *AdminHandler) UpdateConsumer(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	if err := c.Bind(cons); err != nil {
+		return err
+	}
+	if err := validateConsumer(cons); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Save(cons).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogUpdate("Consumer", actor(c), cons.Name)
+	invalidateKeys()
+	return c.JSON(http.StatusOK, cons)
+}
+
+// DeleteConsumer removes the consumer, which stops all of its keys
+func (h *AdminHandler) DeleteConsumer(c echo.Context) error {
+	id := c.Param("id")
+	db := database.GetDB()
+	if err := db.Delete(&database.Consumer{}, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogDelete("Consumer", actor(c), "ID: "+id)
+	invalidateKeys()
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (h *AdminHandler) GetConsumerKeys(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	var keys []database.ConsumerKey
+	db := database.GetDB()
+	if err := db.Where("consumer_id = ?", cons.ID).Order("id").Find(&keys).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// CreateConsumerKey issues a new key. The key is only ever shown in this response.
+func (h *AdminHandler) CreateConsumerKey(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	var req keyRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	issued, err := issueKey(cons, req.ExpiresIn, time.Now())
+	if err != nil {
+		return err
+	}
+	util.LogActivity("ISSUE_KEY", "Consumer", actor(c), "Issued key "+issued.Prefix+" to "+cons.Name)
+	return c.JSON(http.StatusCreated, issued)
+}
+
+// RotateConsumerKeys issues a new key and lets the consumer's other keys expire after a grace
+// period, so clients can switch over without downtime
+func (h *AdminHandler) RotateConsumerKeys(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	var req keyRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	grace := defaultRotationGrace
+	if req.Grace != "" {
+		if grace, err = time.ParseDuration(req.Grace); err != nil || grace < 0 {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "grace must be a non-negative duration")
+		}
+	}
+
+	now := time.Now()
+	issued, err := issueKey(cons, req.ExpiresIn, now)
+	if err != nil {
+		return err
+	}
+	cutoff := now.Add(grace)
+	db := database.GetDB()
+	if err := db.Model(&database.ConsumerKey{}).
+		Where("consumer_id = ? AND id <> ? AND revoked = ? AND (expires_at IS NULL OR expires_at > ?)", cons.ID, issued.ID, false, cutoff).
+		Update("expires_at", cutoff).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogActivity("ROTATE_KEY", "Consumer", actor(c), "Issued key "+issued.Prefix+" to "+cons.Name+", old keys expire at "+util.TimeToString(cutoff))
+	invalidateKeys()
+	return c.JSON(http.StatusCreated, issued)
+}
+
+// RevokeConsumerKey stops a key at once
+func (h *AdminHandler) RevokeConsumerKey(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	var key database.ConsumerKey
+	db := database.GetDB()
+	if err := db.Where("consumer_id = ?", cons.ID).First(&key, c.Param("keyId")).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Key not found")
+	}
+	if !key.Revoked {
+		now := time.Now()
+		key.Revoked = true
+		key.RevokedAt = &now
+		if err := db.Save(&key).Error; err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		util.LogActivity("REVOKE_KEY", "Consumer", actor(c), "Revoked key "+key.Prefix+" of "+cons.Name)
+		invalidateKeys()
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+// RotateSigningSecret generates a new request signing secret for the consumer, replacing the
+// old one at once. The secret is only ever shown in this response.
+func (h *AdminHandler) RotateSigningSecret(c echo.Context) error {
+	cons, err := findConsumer(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	cons.SigningSecret = base64.RawURLEncoding.EncodeToString(b)
+	db := database.GetDB()
+	if err := db.Model(cons).Update("signing_secret", cons.SigningSecret).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogActivity("ROTATE_SECRET", "Consumer", actor(c), "Generated signing secret of "+cons.Name)
+	invalidateKeys()
+	return c.JSON(http.StatusCreated, map[string]string{"Consumer": cons.Name, "SigningSecret": cons.SigningSecret})
+}
+
+func findConsumer(id string) (*database.Consumer, error) {
+	var cons database.Consumer
+	db := database.GetDB()
+	if err := db.First(&cons, id).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Consumer not found")
+	}
+	return &cons, nil
+}
+
+// issueKey stores a new key of the consumer, expiring after expiresIn if set
+func issueKey(cons *database.Consumer, expiresIn string, now time.Time) (*IssuedKey, error) {
+	key, prefix, hash, err := consumer.GenerateKey()
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	issued := &IssuedKey{ConsumerKey: database.ConsumerKey{ConsumerID: cons.ID, Prefix: prefix, Hash: hash}, Key: key}
+	if expiresIn != "" {
+		ttl, err := time.ParseDuration(expiresIn)
+		if err != nil || ttl <= 0 {
+			return nil, echo.NewHTTPError(http.StatusUnprocessableEntity, "expires_in must be a positive duration")
+		}
+		expiresAt := now.Add(ttl)
+		issued.ExpiresAt = &expiresAt
+	}
+	db := database.GetDB()
+	if err := db.Create(&issued.ConsumerKey).Error; err != nil {
+		return nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return issued, nil
+}
+
+// invalidateKeys applies consumer and key changes on this instance at once. Other instances
+// pick them up when their cache expires.
+func invalidateKeys() {
+	if consumer.Default != nil {
+		consumer.Default.Invalidate()
+	}
+}
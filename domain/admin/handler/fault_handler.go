@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/fault"
+	"gorm.io/gorm"
+)
+
+// --- Fault Injection Handlers ---
+//
+// Faults are chaos experiments rather than configuration, so they are not part of
+// config revisions and a rollback never brings an old fault back.
+
+func (h *AdminHandler) GetFaults(c echo.Context) error {
+	var faults []database.Fault
+	db := database.GetDB()
+	query := db.Order("id")
+	if c.QueryParam("active") == util.SettingValueTrue {
+		query = query.Where("disabled = ? AND expires_at > ?", false, time.Now())
+	}
+	if err := query.Find(&faults).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, faults)
+}
+
+func (h *AdminHandler) CreateFault(c echo.Context) error {
+	f := new(database.Fault)
+	if err := c.Bind(f); err != nil {
+		return err
+	}
+	if f.ExpiresAt.IsZero() {
+		f.ExpiresAt = time.Now().Add(fault.DefaultTTL)
+	}
+	if err := validateFault(f); err != nil {
+		return err
+	}
+	db := database.GetDB()
+	if err := db.Create(f).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogCreate("Fault", actor(c), f.Name+" until "+util.TimeToString(f.ExpiresAt))
+	h.reloadRoutes()
+	return c.JSON(http.StatusCreated, f)
+}
+
+func (h *AdminHandler) UpdateFault(c echo.Context) error {
+	id := c.Param("id")
+	var f database.Fault
+	db := database.GetDB()
+	if err := db.First(&f, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Fault not found")
+	}
+	if err := c.Bind(&f); err != nil {
+		return err
+	}
+	if err := validateFault(&f); err != nil {
+		return err
+	}
+	if err := db.Save(&f).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogUpdate("Fault", actor(c), f.Name+" until "+util.TimeToString(f.ExpiresAt))
+	h.reloadRoutes()
+	return c.JSON(http.StatusOK, f)
+}
+
+func (h *AdminHandler) DeleteFault(c echo.Context) error {
+	id := c.Param("id")
+	db := database.GetDB()
+	if err := db.Delete(&database.Fault{}, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogDelete("Fault", actor(c), "ID: "+id)
+	h.reloadRoutes()
+	return c.NoContent(http.StatusNoContent)
+}
+
+// validateFault checks the fault and that it targets an existing route. gRPC codes only
+// make sense on routes of gRPC services.
+func validateFault(f *database.Fault) error {
+	if _, err := fault.FromModel(*f); err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	var route database.Route
+	db := database.GetDB()
+	if err := db.Preload("Service").First(&route, f.RouteID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "route not found")
+		}
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	if f.GRPCCode != "" && route.Service.Protocol != "grpc" {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "grpc_code needs a route of a gRPC service")
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+	"gorm.io/gorm"
+)
+
+// QuotaUsageReport is the usage of one client key in one day or month
+type QuotaUsageReport struct {
+	QuotaID     uint      `json:"quota_id"`
+	Quota       string    `json:"quota"`
+	Key         string    `json:"key"`
+	PeriodStart time.Time `json:"period_start"`
+	Used        int64     `json:"used"`
+	Limit       int64     `json:"limit"`
+	Remaining   int64     `json:"remaining"`
+}
+
+// --- Quota Handlers ---
+
+func (h *AdminHandler) GetQuotas(c echo.Context) error {
+	var quotas []database.Quota
+	db := database.GetDB()
+	if err := db.Order("id").Find(&quotas).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, quotas)
+}
+
+func (h *AdminHandler) CreateQuota(c echo.Context) error {
+	q := new(database.Quota)
+	if err := c.Bind(q); err != nil {
+		return err
+	}
+	if err := h.commit(c, "Created Quota: "+q.Name, func(tx *gorm.DB) error {
+		return tx.Create(q).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogCreate("Quota", actor(c), q.Name)
+	return c.JSON(http.StatusCreated, q)
+}
+
+func (h *AdminHandler) UpdateQuota(c echo.Context) error {
+	id := c.Param("id")
+	var q database.Quota
+	db := database.GetDB()
+	if err := db.First(&q, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Quota not found")
+	}
+	if err := c.Bind(&q); err != nil {
+		return err
+	}
+	if err := h.commit(c, "Updated Quota: "+q.Name, func(tx *gorm.DB) error {
+		return tx.Save(&q).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogUpdate("Quota", actor(c), q.Name)
+	return c.JSON(http.StatusOK, q)
+}
+
+func (h *AdminHandler) DeleteQuota(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.commit(c, "Deleted Quota ID: "+id, func(tx *gorm.DB) error {
+		return tx.Delete(&database.Quota{}, id).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogDelete("Quota", actor(c), "ID: "+id)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetQuotaUsage reports usage per quota, client key and period, busiest first. It can be
+// filtered by quota_id, key and the from and to dates (2006-01-02) periods start in.
+func (h *AdminHandler) GetQuotaUsage(c echo.Context) error {
+	db := database.GetDB()
+	query := db.Model(&database.QuotaUsage{})
+	if id := c.QueryParam("quota_id"); id != "" {
+		query = query.Where("quota_id = ?", id)
+	}
+	if key := c.QueryParam("key"); key != "" {
+		query = query.Where("key = ?", key)
+	}
+	for param, cond := range map[string]string{"from": "period_start >= ?", "to": "period_start < ?"} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation("2006-01-02", value, quota.Location)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, param+" must be a date such as 2006-01-02")
+		}
+		query = query.Where(cond, t)
+	}
+
+	var usage []database.QuotaUsage
+	if err := query.Order("period_start desc, count desc").Limit(500).Find(&usage).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	var quotas []database.Quota
+	if err := db.Unscoped().Find(&quotas).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	byID := make(map[uint]database.Quota, len(quotas))
+	for _, q := range quotas {
+		byID[q.ID] = q
+	}
+
+	reports := make([]QuotaUsageReport, 0, len(usage))
+	for _, u := range usage {
+		q := byID[u.QuotaID]
+		reports = append(reports, QuotaUsageReport{
+			QuotaID:     u.QuotaID,
+			Quota:       q.Name,
+			Key:         u.Key,
+			PeriodStart: u.PeriodStart,
+			Used:        u.Count,
+			Limit:       q.Requests,
+			Remaining:   max(q.Requests-u.Count, 0),
+		})
+	}
+	return c.JSON(http.StatusOK, reports)
+}
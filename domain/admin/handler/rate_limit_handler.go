@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+	"gorm.io/gorm"
+)
+
+// RateLimitState is what a policy's store holds for one client key
+type RateLimitState struct {
+	Policy     string        `json:"policy"`
+	Key        string        `json:"key"`
+	Allowed    bool          `json:"allowed"` // Whether the next request would be allowed
+	Limit      int           `json:"limit"`
+	Remaining  int           `json:"remaining"`
+	Reset      util.Duration `json:"reset"`
+	RetryAfter util.Duration `json:"retry_after"`
+}
+
+// --- Rate Limit Policy Handlers ---
+
+func (h *AdminHandler) GetRateLimits(c echo.Context) error {
+	var policies []database.RateLimitPolicy
+	db := database.GetDB()
+	if err := db.Order("id").Find(&policies).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+func (h *AdminHandler) CreateRateLimit(c echo.Context) error {
+	policy := new(database.RateLimitPolicy)
+	if err := c.Bind(policy); err != nil {
+		return err
+	}
+	if err := h.commit(c, "Created RateLimitPolicy: "+policy.Name, func(tx *gorm.DB) error {
+		return tx.Create(policy).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogCreate("RateLimitPolicy", actor(c), policy.Name)
+	return c.JSON(http.StatusCreated, policy)
+}
+
+func (h *AdminHandler) UpdateRateLimit(c echo.Context) error {
+	id := c.Param("id")
+	var policy database.RateLimitPolicy
+	db := database.GetDB()
+	if err := db.First(&policy, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "RateLimitPolicy not found")
+	}
+	if err := c.Bind(&policy); err != nil {
+		return err
+	}
+	if err := h.commit(c, "Updated RateLimitPolicy: "+policy.Name, func(tx *gorm.DB) error {
+		return tx.Save(&policy).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogUpdate("RateLimitPolicy", actor(c), policy.Name)
+	return c.JSON(http.StatusOK, policy)
+}
+
+func (h *AdminHandler) DeleteRateLimit(c echo.Context) error {
+	id := c.Param("id")
+	if err := h.commit(c, "Deleted RateLimitPolicy ID: "+id, func(tx *gorm.DB) error {
+		return tx.Delete(&database.RateLimitPolicy{}, id).Error
+	}); err != nil {
+		return commitError(c, err)
+	}
+	util.LogDelete("RateLimitPolicy", actor(c), "ID: "+id)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// GetRateLimitState reports the limiter state of a client key, such as "ip:10.0.0.1" or
+// "api_key:12", under a policy without counting a request
+func (h *AdminHandler) GetRateLimitState(c echo.Context) error {
+	id := c.Param("id")
+	key := c.QueryParam("key")
+	if key == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "key is required")
+	}
+
+	var row database.RateLimitPolicy
+	db := database.GetDB()
+	if err := db.First(&row, id).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "RateLimitPolicy not found")
+	}
+	policy, err := ratelimit.FromModel(row)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+	}
+
+	result, err := ratelimit.Default.Peek(c.Request().Context(), policy, policy.StoreKey(key))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, RateLimitState{
+		Policy:     policy.Name,
+		Key:        key,
+		Allowed:    result.Allowed,
+		Limit:      result.Limit,
+		Remaining:  result.Remaining,
+		Reset:      util.Duration(result.Reset),
+		RetryAfter: util.Duration(result.RetryAfter),
+	})
+}
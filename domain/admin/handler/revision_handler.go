@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gorm.io/gorm"
+)
+
+// HeaderAdminUser identifies the operator making an admin change
+const HeaderAdminUser = "X-Admin-User"
+
+// actor returns the operator recorded as the author of a change
+func actor(c echo.Context) string {
+	if user := c.Request().Header.Get(HeaderAdminUser); user != "" {
+		return user
+	}
+	return "admin"
+}
+
+// ValidationError rejects a config change that introduces new problems
+type ValidationError struct {
+	Problems []database.ConfigProblem
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("config change rejected: %d problem(s) found", len(e.Problems))
+}
+
+// commit applies a config change and records the resulting revision in one transaction,
+// then reloads the running router. The change is rolled back if it introduces validation errors.
+func (h *AdminHandler) commit(c echo.Context, message string, change func(tx *gorm.DB) error) error {
+	db := database.GetDB()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		before, err := database.CaptureSnapshot(tx)
+		if err != nil {
+			return err
+		}
+		if err := change(tx); err != nil {
+			return err
+		}
+		after, err := database.CaptureSnapshot(tx)
+		if err != nil {
+			return err
+		}
+
+		if problems := database.NewErrors(h.gateway.Validate(before), h.gateway.Validate(after)); len(problems) > 0 {
+			return &ValidationError{Problems: problems}
+		}
+
+		_, err = database.RecordRevision(tx, actor(c), message)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	h.reloadRoutes()
+	return nil
+}
+
+// commitError renders a failed commit, listing the problems when validation rejected it
+func commitError(c echo.Context, err error) error {
+	if verr, ok := err.(*ValidationError); ok {
+		return c.JSON(http.StatusUnprocessableEntity, map[string]interface{}{
+			"message":  verr.Error(),
+			"problems": verr.Problems,
+		})
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+}
+
+func (h *AdminHandler) reloadRoutes() {
+	if err := h.gateway.Reload(); err != nil {
+		log.Printf("Error reloading routes: %v", err)
+	}
+}
+
+// Validate is a dry-run: it overlays the proposed services, routes and proto mappings
+// on the current configuration and returns every problem found without saving anything
+func (h *AdminHandler) Validate(c echo.Context) error {
+	proposed := new(database.ConfigSnapshot)
+	if err := c.Bind(proposed); err != nil {
+		return err
+	}
+
+	current, err := database.CaptureSnapshot(database.GetDB())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	problems := h.gateway.Validate(current.Overlay(proposed))
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"valid":    !database.HasErrors(problems),
+		"problems": problems,
+	})
+}
+
+// --- Config Revision Handlers ---
+
+func (h *AdminHandler) GetRevisions(c echo.Context) error {
+	var revisions []database.ConfigRevision
+	db := database.GetDB()
+	if err := db.Omit("snapshot").Order("id desc").Limit(100).Find(&revisions).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, revisions)
+}
+
+func (h *AdminHandler) GetRevision(c echo.Context) error {
+	rev, snap, err := loadRevision(c.Param("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"revision": rev,
+		"snapshot": snap,
+	})
+}
+
+// DiffRevisions compares two revisions given as ?from=<id>&to=<id>
+func (h *AdminHandler) DiffRevisions(c echo.Context) error {
+	from, fromSnap, err := loadRevision(c.QueryParam("from"))
+	if err != nil {
+		return err
+	}
+	to, toSnap, err := loadRevision(c.QueryParam("to"))
+	if err != nil {
+		return err
+	}
+
+	changes := database.DiffSnapshots(fromSnap, toSnap)
+	if changes == nil {
+		changes = []database.ConfigChange{}
+	}
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"from":    from.ID,
+		"to":      to.ID,
+		"changes": changes,
+	})
+}
+
+// RollbackRevision restores the configuration of an earlier revision and records it as a new one
+func (h *AdminHandler) RollbackRevision(c echo.Context) error {
+	target, snap, err := loadRevision(c.Param("id"))
+	if err != nil {
+		return err
+	}
+
+	var rev *database.ConfigRevision
+	db := database.GetDB()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Revisions may predate checks added since, so they are validated like any other change
+		current, err := database.CaptureSnapshot(tx)
+		if err != nil {
+			return err
+		}
+		if problems := database.NewErrors(h.gateway.Validate(current), h.gateway.Validate(snap)); len(problems) > 0 {
+			return &ValidationError{Problems: problems}
+		}
+
+		if err := database.RestoreSnapshot(tx, snap); err != nil {
+			return err
+		}
+		rev, err = database.RecordRevision(tx, actor(c), fmt.Sprintf("Rolled back to revision %d", target.ID))
+		return err
+	})
+	if err != nil {
+		return commitError(c, err)
+	}
+
+	h.reloadRoutes()
+	util.LogActivity("ROLLBACK", "Config", actor(c), fmt.Sprintf("Rolled back to revision %d (new revision %d)", target.ID, rev.ID))
+	return c.JSON(http.StatusOK, rev)
+}
+
+func loadRevision(id string) (*database.ConfigRevision, *database.ConfigSnapshot, error) {
+	if id == "" {
+		return nil, nil, echo.NewHTTPError(http.StatusBadRequest, "Revision ID is required")
+	}
+
+	var rev database.ConfigRevision
+	db := database.GetDB()
+	if err := db.First(&rev, id).Error; err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusNotFound, "Revision not found")
+	}
+
+	snap, err := rev.Decode()
+	if err != nil {
+		return nil, nil, echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return &rev, snap, nil
+}
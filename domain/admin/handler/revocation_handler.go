@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/jwt"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+)
+
+// --- Token Revocation Handlers ---
+
+// defaultRevocationTTL is how long an entry without an expiry is kept. It should outlive the
+// access tokens the auth service issues.
+const defaultRevocationTTL = 24 * time.Hour
+
+// revocationRequest names the tokens to revoke, either by pasting one of them or by kind and value
+type revocationRequest struct {
+	Token     string     `json:"token"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Reason    string     `json:"reason"`
+}
+
+func (h *AdminHandler) GetRevocations(c echo.Context) error {
+	entries, err := revocation.Default.List(c.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// CreateRevocation revokes a token, or with "sid" every token of a session. A pasted token is
+// revoked together with its session until it expires.
+func (h *AdminHandler) CreateRevocation(c echo.Context) error {
+	var req revocationRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+	if req.Reason == "" {
+		req.Reason = "revoked by " + actor(c)
+	}
+
+	var entries []revocation.Entry
+	if req.Token != "" {
+		// An admin vouches for the token, so it does not have to be verified
+		claims, err := jwt.UnverifiedClaims(req.Token)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+		if entries, err = revocation.ForToken(claims, req.Reason); err != nil {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, err.Error())
+		}
+	} else {
+		if req.Kind != revocation.KindToken && req.Kind != revocation.KindSession {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, `kind must be "jti" or "sid"`)
+		}
+		if req.Value == "" {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "value is required")
+		}
+		entry := revocation.Entry{Kind: req.Kind, Value: req.Value, ExpiresAt: time.Now().Add(defaultRevocationTTL), Reason: req.Reason}
+		if req.ExpiresAt != nil {
+			entry.ExpiresAt = *req.ExpiresAt
+		}
+		entries = append(entries, entry)
+	}
+
+	for _, e := range entries {
+		if !e.ExpiresAt.After(time.Now()) {
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "token has already expired")
+		}
+		if err := revocation.Default.Revoke(c.Request().Context(), e); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		util.LogActivity("REVOKE", "Token", actor(c), "Revoked "+e.Key()+" until "+util.TimeToString(e.ExpiresAt))
+	}
+	return c.JSON(http.StatusCreated, entries)
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+// --- Upstream Signing Key Handlers ---
+//
+// Signing keys are credentials rather than configuration, so they are not part of config
+// revisions and a rollback never brings an old key back.
+
+// GetServiceSigningKey reports the ID of the key calls to the service are signed with
+func (h *AdminHandler) GetServiceSigningKey(c echo.Context) error {
+	var key database.ServiceSigningKey
+	db := database.GetDB()
+	if err := db.Where("service_id = ?", c.Param("id")).First(&key).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Service has no signing key")
+	}
+	return c.JSON(http.StatusOK, key)
+}
+
+// signingKeyRequest optionally supplies the new key, so services can trust it before the
+// gateway starts using it
+type signingKeyRequest struct {
+	KeyID  string `json:"key_id"`
+	Secret string `json:"secret"`
+}
+
+// RotateServiceSigningKey replaces the key calls to the service are signed with. Unless the
+// request supplies one, a key is generated and its secret is only ever shown in this response.
+func (h *AdminHandler) RotateServiceSigningKey(c echo.Context) error {
+	var svc database.Service
+	db := database.GetDB()
+	if err := db.First(&svc, c.Param("id")).Error; err != nil {
+		return echo.NewHTTPError(http.StatusNotFound, "Service not found")
+	}
+	var req signingKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return err
+	}
+
+	if req.KeyID == "" {
+		kid := make([]byte, 8)
+		if _, err := rand.Read(kid); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		req.KeyID = hex.EncodeToString(kid)
+	}
+	if req.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+		}
+		req.Secret = base64.RawURLEncoding.EncodeToString(secret)
+	} else if len(req.Secret) < 32 {
+		return echo.NewHTTPError(http.StatusUnprocessableEntity, "secret must be at least 32 characters")
+	}
+
+	var key database.ServiceSigningKey
+	db.Where("service_id = ?", svc.ID).First(&key)
+	key.ServiceID = svc.ID
+	key.KeyID = req.KeyID
+	key.Secret = req.Secret
+	if err := db.Save(&key).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogActivity("ROTATE_KEY", "Service", actor(c), "Set signing key "+key.KeyID+" of "+svc.Name)
+	h.reloadRoutes()
+	return c.JSON(http.StatusCreated, map[string]string{"Service": svc.Name, "KeyID": key.KeyID, "Secret": key.Secret})
+}
+
+// DeleteServiceSigningKey stops signing calls to the service
+func (h *AdminHandler) DeleteServiceSigningKey(c echo.Context) error {
+	id := c.Param("id")
+	db := database.GetDB()
+	if err := db.Unscoped().Where("service_id = ?", id).Delete(&database.ServiceSigningKey{}).Error; err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	util.LogDelete("Signing key", actor(c), "Service ID: "+id)
+	h.reloadRoutes()
+	return c.NoContent(http.StatusNoContent)
+}
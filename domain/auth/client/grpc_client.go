@@ -11,6 +11,7 @@ import (
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth"
 	pb "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/proto/auth"
 	util "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/client"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
 	"google.golang.org/grpc"
 )
 
@@ -32,7 +33,7 @@ func NewGrpcAuthClient() *GrpcAuthClient {
 			return
 		}
 
-		conn := util.Dial(cfg.AuthServiceGRPCAddr)
+		conn := util.Dial(cfg.AuthServiceGRPCAddr, gatewayauth.UnaryClientInterceptor)
 		client := pb.NewAuthServiceClient(conn)
 		grpcInstance = &GrpcAuthClient{
 			client: client,
@@ -56,7 +57,7 @@ func (c *GrpcAuthClient) Login(ctx context.Context, request *auth.LoginRequest)
 
 	resp, err := c.client.Login(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("login failed: %v", err)
+		return nil, fmt.Errorf("login failed: %w", err)
 	}
 
 	result := map[string]interface{}{
@@ -88,7 +89,7 @@ func (c *GrpcAuthClient) CheckPhone(ctx context.Context, request *auth.CheckPhon
 
 	resp, err := c.client.CheckPhone(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("check phone failed: %v", err)
+		return nil, fmt.Errorf("check phone failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -111,7 +112,7 @@ func (c *GrpcAuthClient) RefreshToken(ctx context.Context, request *auth.Refresh
 
 	resp, err := c.client.RefreshToken(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("refresh token failed: %v", err)
+		return nil, fmt.Errorf("refresh token failed: %w", err)
 	}
 
 	result := map[string]interface{}{
@@ -143,7 +144,7 @@ func (c *GrpcAuthClient) Logout(ctx context.Context, request *auth.RefreshTokenR
 
 	resp, err := c.client.Logout(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("logout failed: %v", err)
+		return nil, fmt.Errorf("logout failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -170,7 +171,7 @@ func (c *GrpcAuthClient) ActivationInitiate(ctx context.Context, request *auth.A
 
 	resp, err := c.client.InitiateActivation(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("activation initiate failed: %v", err)
+		return nil, fmt.Errorf("activation initiate failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -214,7 +215,7 @@ func (c *GrpcAuthClient) ActivationComplete(ctx context.Context, request *auth.A
 
 	resp, err := c.client.CompleteActivation(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("activation complete failed: %v", err)
+		return nil, fmt.Errorf("activation complete failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -237,7 +238,7 @@ func (c *GrpcAuthClient) OtpSend(ctx context.Context, request *auth.OtpRequest)
 
 	resp, err := c.client.SendOTP(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("send OTP failed: %v", err)
+		return nil, fmt.Errorf("send OTP failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -261,7 +262,7 @@ func (c *GrpcAuthClient) OtpVerify(ctx context.Context, request *auth.OtpRequest
 
 	resp, err := c.client.VerifyOTP(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("verify OTP failed: %v", err)
+		return nil, fmt.Errorf("verify OTP failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -284,7 +285,7 @@ func (c *GrpcAuthClient) RegisterRequest(ctx context.Context, request *auth.Logi
 
 	resp, err := c.client.Register(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("register request failed: %v", err)
+		return nil, fmt.Errorf("register request failed: %w", err)
 	}
 
 	return map[string]interface{}{
@@ -329,7 +330,7 @@ func (c *GrpcAuthClient) RegisterComplete(ctx context.Context, request *auth.Act
 
 	resp, err := c.client.CompleteRegistration(ctx, req)
 	if err != nil {
-		return nil, fmt.Errorf("register complete failed: %v", err)
+		return nil, fmt.Errorf("register complete failed: %w", err)
 	}
 
 	result := map[string]interface{}{
@@ -5,9 +5,12 @@ import (
 	"net/http"
 
 	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth/client"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
 )
 
 // ClientFunc represents a generic client function signature
@@ -22,8 +25,9 @@ type RequestValidator interface {
 type AuthHandler struct {
 	client      client.AuthClient
 	clientFunc  func(ctx context.Context, client client.AuthClient, request interface{}) (map[string]interface{}, error)
-	requestType func() interface{} // Factory function to create new request instance
-	operation   string             // For error messages
+	requestType func() interface{}         // Factory function to create new request instance
+	operation   string                     // For error messages
+	onSuccess   func(c echo.Context) error // Called after the auth service accepted the request, an error fails it
 }
 
 // Handle processes the request generically
@@ -47,10 +51,18 @@ func (h *AuthHandler) Handle(c echo.Context) error {
 	}
 
 	// Call the client function
-	result, err := h.clientFunc(ctx, h.client, req)
+	result, err := h.invoke(ctx, c, req)
+	if breaker.IsRejected(err) {
+		return breaker.RejectionError(err)
+	}
 	if err != nil {
 		return echo.NewHTTPError(http.StatusInternalServerError, h.operation+" failed")
 	}
+	if h.onSuccess != nil {
+		if err := h.onSuccess(c); err != nil {
+			return err
+		}
+	}
 
 	// Build response safely
 	resp, err := h.buildResponse(result)
@@ -61,6 +73,22 @@ func (h *AuthHandler) Handle(c echo.Context) error {
 	return c.JSON(http.StatusOK, resp)
 }
 
+// invoke calls the client function through the circuit breaker of the route's service
+func (h *AuthHandler) invoke(ctx context.Context, c echo.Context, req interface{}) (map[string]interface{}, error) {
+	svc, ok := c.Get(util.ContextServiceKey).(database.Service)
+	if !ok {
+		return h.clientFunc(ctx, h.client, req)
+	}
+
+	done, err := breaker.ForService(svc).Allow()
+	if err != nil {
+		return nil, err
+	}
+	result, err := h.clientFunc(ctx, h.client, req)
+	done(!breaker.IsFailure(err))
+	return result, err
+}
+
 // buildResponse safely builds the response
 func (h *AuthHandler) buildResponse(result map[string]interface{}) (*domain.ClientResponse, error) {
 	if result == nil {
@@ -118,9 +146,11 @@ func NewRefreshTokenHandler() *AuthHandler {
 }
 
 func NewLogoutHandler() *AuthHandler {
-	return createRestHandler(func(ctx context.Context, c client.AuthClient, req interface{}) (map[string]interface{}, error) {
+	h := createRestHandler(func(ctx context.Context, c client.AuthClient, req interface{}) (map[string]interface{}, error) {
 		return c.Logout(ctx, req.(*auth.RefreshTokenRequest))
 	}, func() interface{} { return &auth.RefreshTokenRequest{} }, "Logout")
+	h.onSuccess = revokeAccessToken
+	return h
 }
 
 func NewActivationInitiateHandler() *AuthHandler {
@@ -3,10 +3,12 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -14,6 +16,8 @@ import (
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth/client"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
 )
 
 // MockAuthClient is a mock implementation of the AuthClient interface
@@ -115,3 +119,80 @@ func TestLoginHandler(t *testing.T) {
 		assert.Equal(t, "Login successful", response["message"])
 	}
 }
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	store := revocation.NewMemoryStore()
+	defer func(old revocation.Store) { revocation.Default = old }(revocation.Default)
+	revocation.Default = store
+
+	mockClient := new(MockAuthClient)
+	mockClient.On("Logout", mock.Anything, mock.Anything).Return(map[string]interface{}{"code": "SUCCESS"}, nil)
+	h := &AuthHandler{
+		client: mockClient,
+		clientFunc: func(ctx context.Context, client client.AuthClient, request interface{}) (map[string]interface{}, error) {
+			return client.Logout(ctx, request.(*auth.RefreshTokenRequest))
+		},
+		requestType: func() interface{} { return &auth.RefreshTokenRequest{} },
+		operation:   "Logout",
+		onSuccess:   revokeAccessToken,
+	}
+
+	e := echo.New()
+	e.Validator = &domain.CustomValidator{Validator: nil}
+	send := func(ctx context.Context, claims map[string]interface{}) error {
+		req := httptest.NewRequest(http.MethodPost, "/logout", strings.NewReader(`{"refreshToken":"r-1"}`)).WithContext(ctx)
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := e.NewContext(req, httptest.NewRecorder())
+		if claims != nil {
+			c.Set(util.ContextJwtClaimKey, claims)
+		}
+		return h.Handle(c)
+	}
+	logout := func(claims map[string]interface{}) {
+		assert.NoError(t, send(context.Background(), claims))
+	}
+
+	// Without the jwt middleware there is no verified token to revoke
+	logout(nil)
+	entries, _ := store.List(context.Background())
+	assert.Empty(t, entries)
+
+	exp := float64(time.Now().Add(time.Hour).Unix())
+	logout(map[string]interface{}{"sub": "agent-1", "jti": "t-1", "sid": "s-1", "exp": exp})
+	revoked, err := revocation.IsRevoked(context.Background(), store, map[string]interface{}{"jti": "t-2", "sid": "s-1"})
+	assert.NoError(t, err)
+	assert.True(t, revoked, "other tokens of the session are revoked too")
+
+	// The revocation outlives a client that hung up, and is retried when the store fails
+	flaky := &flakyRevocations{Store: store, failures: 2}
+	revocation.Default = flaky
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.NoError(t, send(ctx, map[string]interface{}{"sub": "agent-2", "jti": "t-3", "exp": exp}))
+	revoked, _ = revocation.IsRevoked(context.Background(), store, map[string]interface{}{"jti": "t-3"})
+	assert.True(t, revoked)
+
+	// If it keeps failing, so does the logout
+	flaky.failures = revokeAttempts
+	err = send(context.Background(), map[string]interface{}{"sub": "agent-3", "jti": "t-4", "exp": exp})
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusServiceUnavailable, he.Code)
+	}
+}
+
+// flakyRevocations fails the next revocations, and any made on a cancelled context
+type flakyRevocations struct {
+	revocation.Store
+	failures int
+}
+
+func (s *flakyRevocations) Revoke(ctx context.Context, e revocation.Entry) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("database unavailable")
+	}
+	return s.Store.Revoke(ctx, e)
+}
@@ -8,6 +8,7 @@ import (
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth/client"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -33,11 +34,19 @@ func (h *AuthHandler) HandleGrpc(c echo.Context) error {
 	}
 
 	// Call the client function
-	result, err := h.clientFunc(ctx, h.client, req)
+	result, err := h.invoke(ctx, c, req)
+	if breaker.IsRejected(err) {
+		return breaker.RejectionError(err)
+	}
 	if err != nil {
 		// Handle gRPC specific errors
 		return h.handleGRPCError(c, err)
 	}
+	if h.onSuccess != nil {
+		if err := h.onSuccess(c); err != nil {
+			return err
+		}
+	}
 
 	// Build response safely
 	resp, err := h.buildResponseGRPC(result)
@@ -164,9 +173,11 @@ func NewRefreshTokenHandlerGRPC() *AuthHandler {
 }
 
 func NewLogoutHandlerGRPC() *AuthHandler {
-	return createGrpcHandler(func(ctx context.Context, c client.AuthClient, req interface{}) (map[string]interface{}, error) {
+	h := createGrpcHandler(func(ctx context.Context, c client.AuthClient, req interface{}) (map[string]interface{}, error) {
 		return c.Logout(ctx, req.(*auth.RefreshTokenRequest))
 	}, func() interface{} { return &auth.RefreshTokenRequest{} }, "Logout")
+	h.onSuccess = revokeAccessToken
+	return h
 }
 
 func NewActivationInitiateHandlerGRPC() *AuthHandler {
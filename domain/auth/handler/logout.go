@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// revokeAttempts and revokeTimeout bound how long a logout keeps trying to revoke the token
+const (
+	revokeAttempts = 3
+	revokeTimeout  = 5 * time.Second
+)
+
+// revokeAccessToken puts the caller's access token and its session on the revocation list, so
+// they stop working before the token expires. Only a token verified by the route's jwt
+// middleware is revoked, otherwise a forged token could end someone else's session. The
+// revocation outlives a client that hangs up, and if it keeps failing the logout fails too,
+// so the client does not go on believing the token is dead.
+func revokeAccessToken(c echo.Context) error {
+	ctx := c.Request().Context()
+	claims, ok := c.Get(util.ContextJwtClaimKey).(map[string]interface{})
+	if !ok {
+		tracing.Warn(ctx, "Logout", "No verified access token to revoke, the route has no jwt middleware")
+		return nil
+	}
+	entries, err := revocation.ForToken(claims, "logout")
+	if err != nil {
+		tracing.Warn(ctx, "Logout", "Cannot revoke access token: "+err.Error())
+		return nil
+	}
+
+	revokeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), revokeTimeout)
+	defer cancel()
+	for _, e := range entries {
+		if err := revoke(revokeCtx, e); err != nil {
+			tracing.Error(ctx, "Logout", "Failed to revoke "+e.Key()+": "+err.Error())
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Logout failed, the access token is still valid")
+		}
+	}
+	tracing.Info(ctx, "Logout", fmt.Sprintf("Revoked access token of %v until %s", claims["sub"], util.TimeToString(entries[0].ExpiresAt)))
+	return nil
+}
+
+// revoke retries a failed revocation a few times, backing off in between
+func revoke(ctx context.Context, e revocation.Entry) error {
+	var err error
+	for attempt := 1; attempt <= revokeAttempts; attempt++ {
+		if err = revocation.Default.Revoke(ctx, e); err == nil {
+			return nil
+		}
+		if attempt < revokeAttempts {
+			select {
+			case <-time.After(time.Duration(attempt) * 100 * time.Millisecond):
+			case <-ctx.Done():
+				return err
+			}
+		}
+	}
+	return err
+}
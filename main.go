@@ -11,7 +11,13 @@ import (
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/logbuffer"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
 )
 
 func main() {
@@ -21,7 +27,17 @@ func main() {
 	cfg := config.Load()
 
 	database.Init()
+	breaker.Default.Subscribe(breaker.StoreEvent)
+	quota.Default = quota.NewDatabaseStore(database.GetDB())
+	consumer.Default = consumer.NewAuthenticator(database.GetDB(), consumer.DefaultCacheTTL)
+	signature.Default = signature.NewDatabaseStore(database.GetDB())
+	revocation.Default = revocation.NewCachedStore(revocation.NewDatabaseStore(database.GetDB()), revocation.DefaultCacheTTL)
+	if cfg.RateLimitStore == ratelimit.StoreDatabase {
+		ratelimit.Default = ratelimit.NewDatabaseStore(database.GetDB())
+	}
 	cron.StartHealthChecker()
+	cron.StartBreakerSync()
+	cron.StartIdempotencySweep()
 
 	e := route.Init()
 	data, err := util.Json.MarshalIndent(e.Routes(), "", "  ")
@@ -6,6 +6,7 @@ import (
 	"github.com/labstack/echo/v4"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/auth/client"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
 )
 
 // DynamicHandler resolves the service and method from DB and dispatches the call
@@ -25,6 +26,9 @@ func (h *DynamicHandler) Handle(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusNotFound, "Endpoint configuration not found")
 	}
 
+	// 2. Expose the upstream service to handlers, e.g. for its circuit breaker
+	c.Set(util.ContextServiceKey, dbRoute.Service)
+
 	// 3. Dispatch to handler or generic proxy
 	finalHandler := h.resolveHandler(c, dbRoute)
 
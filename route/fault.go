@@ -0,0 +1,40 @@
+package route
+
+import (
+	"log"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/fault"
+)
+
+// loadFaults reads the enabled faults that have not expired, skipping invalid ones
+func loadFaults() ([]fault.Fault, error) {
+	db := database.GetDB()
+	var rows []database.Fault
+	if err := db.Where("disabled = ? AND expires_at > ?", false, time.Now()).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var faults []fault.Fault
+	for _, row := range rows {
+		f, err := fault.FromModel(row)
+		if err != nil {
+			log.Printf("Fault %d %s: skipping: %v", row.ID, row.Name, err)
+			continue
+		}
+		faults = append(faults, f)
+	}
+	return faults, nil
+}
+
+// faultsFor returns the faults injected into a route
+func faultsFor(faults []fault.Fault, route Route) []fault.Fault {
+	var out []fault.Fault
+	for _, f := range faults {
+		if f.RouteID == route.ID {
+			out = append(out, f)
+		}
+	}
+	return out
+}
@@ -0,0 +1,169 @@
+package route
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	customMw "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route/middleware"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+)
+
+// routeTable is an immutable set of gateway routes built from the database
+type routeTable struct {
+	router   *echo.Router
+	notFound echo.HandlerFunc // Still counts against the global rate limits
+	maxParam int
+	count    int
+}
+
+// Gateway dispatches upstream traffic through a route table that can be rebuilt at runtime,
+// so config changes and rollbacks take effect without a restart
+type Gateway struct {
+	echo   *echo.Echo
+	table  atomic.Pointer[routeTable]
+	reload sync.Mutex
+}
+
+// NewGateway creates a gateway bound to the echo instance and loads the initial routes
+func NewGateway(e *echo.Echo) *Gateway {
+	g := &Gateway{echo: e}
+	g.table.Store(&routeTable{router: echo.NewRouter(e), notFound: echo.NotFoundHandler})
+	if err := g.Reload(); err != nil {
+		log.Printf("Error loading routes from DB: %v", err)
+	}
+	return g
+}
+
+// Reload rebuilds the route table from the database and swaps it in atomically
+func (g *Gateway) Reload() error {
+	g.reload.Lock()
+	defer g.reload.Unlock()
+
+	routes, err := loadRoutesFromDB()
+	if err != nil {
+		return err
+	}
+	policies, err := loadRateLimitPolicies()
+	if err != nil {
+		return err
+	}
+	quotas, err := loadQuotas()
+	if err != nil {
+		return err
+	}
+	serviceMw, err := loadServiceMiddleware()
+	if err != nil {
+		return err
+	}
+	faults, err := loadFaults()
+	if err != nil {
+		return err
+	}
+	signers, err := loadSigners()
+	if err != nil {
+		return err
+	}
+
+	table := &routeTable{
+		router:   echo.NewRouter(g.echo),
+		notFound: rateLimitMiddleware(anonymous(policiesFor(policies, Route{})), ratelimit.Default)(echo.NotFoundHandler),
+	}
+	for _, route := range routes {
+		h := NewDynamicHandler(route.Endpoint)
+		limits := policiesFor(policies, route)
+		mw := []echo.MiddlewareFunc{rateLimitMiddleware(anonymous(limits), ratelimit.Default)}
+		// Load shedding runs after authentication, so it goes by the consumer's priority
+		verified := []echo.MiddlewareFunc{
+			rateLimitMiddleware(authenticated(limits), ratelimit.Default),
+			quotaMiddleware(quotasFor(quotas, route), quota.Default),
+		}
+		mw = append(mw, chainMiddleware(route, append(verified, serviceMw[route.ServiceID]...)...)...)
+		if signer, ok := signers[route.ServiceID]; ok {
+			mw = append(mw, customMw.GatewayTokenMiddleware(signer))
+		}
+		// Faults act like the upstream misbehaving, so the route's own middleware sees them
+		mw = append(mw, customMw.FaultMiddleware(faultsFor(faults, route)))
+		table.router.Add(route.Method, route.Path, applyMiddleware(h.Handle, mw...))
+		if n := countParams(route.Path); n > table.maxParam {
+			table.maxParam = n
+		}
+		table.count++
+	}
+
+	g.table.Store(table)
+	log.Printf("Gateway routes loaded: %d", table.count)
+	return nil
+}
+
+// loadServiceMiddleware applies every service's circuit breaker policy and forced state, and
+// builds the load shedding and bulkhead middleware of the services that have them. All
+// routes of a service share them.
+func loadServiceMiddleware() (map[uint][]echo.MiddlewareFunc, error) {
+	db := database.GetDB()
+	var services []database.Service
+	if err := db.Find(&services).Error; err != nil {
+		return nil, err
+	}
+
+	out := make(map[uint][]echo.MiddlewareFunc)
+	for _, svc := range services {
+		breaker.ConfigureService(svc)
+		key := breaker.ServiceKey(svc.ID)
+		if policy, ok, err := adaptive.ParsePolicy(svc.AdaptiveConcurrency); err != nil {
+			log.Printf("Service %s: skipping invalid adaptive concurrency policy: %v", svc.Name, err)
+		} else if ok {
+			out[svc.ID] = append(out[svc.ID], customMw.AdaptiveConcurrencyMiddleware(key, policy))
+		}
+		if policy, ok, err := bulkhead.ParsePolicy(svc.Bulkhead); err != nil {
+			log.Printf("Service %s: skipping invalid bulkhead policy: %v", svc.Name, err)
+		} else if ok {
+			out[svc.ID] = append(out[svc.ID], customMw.BulkheadMiddleware(key, policy))
+		}
+	}
+	if err := breaker.SyncOverrides(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Handle finds the matching route in the current table and runs it
+func (g *Gateway) Handle(c echo.Context) error {
+	table := g.table.Load()
+
+	// Contexts pooled before a reload may be sized for fewer path params
+	if table.maxParam > len(c.ParamValues()) {
+		c.SetParamValues(make([]string, table.maxParam)...)
+	}
+
+	// Find leaves the context untouched when nothing matches, so clear the catch-all match first
+	c.SetHandler(table.notFound)
+	c.SetPath("")
+	c.SetParamNames()
+
+	table.router.Find(c.Request().Method, echo.GetPath(c.Request()), c)
+	return c.Handler()(c)
+}
+
+func applyMiddleware(h echo.HandlerFunc, middleware ...echo.MiddlewareFunc) echo.HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
+func countParams(path string) int {
+	n := 0
+	for i := 0; i < len(path); i++ {
+		if path[i] == ':' || path[i] == '*' {
+			n++
+		}
+	}
+	return n
+}
@@ -1,14 +1,341 @@
 package route
 
 import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
 	customMw "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route/middleware"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/idempotency"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
 )
 
-var middlewareHandler = map[string]echo.MiddlewareFunc{
-	"timeout":         customMw.TimeoutMiddleware(10 * time.Second),
-	"retry":           customMw.RetryMiddleware(3),
-	"circuit-breaker": customMw.CircuitBreakerMiddleware("default"),
+// middlewareType builds a fresh middleware instance for each route from its spec
+type middlewareType struct {
+	schema customMw.MiddlewareSchema
+	params func(route Route) interface{} // Config with defaults that the spec parameters are decoded into
+	build  func(params interface{}, route Route) echo.MiddlewareFunc
+}
+
+var middlewareTypes = map[string]middlewareType{
+	"timeout": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "timeout",
+			Description: "Fails the request with 504 when the upstream does not answer in time",
+			Params: []customMw.ParamSchema{
+				{Name: "duration", Type: "duration", Default: "10s", Description: "Maximum time to wait for the upstream"},
+				{Name: "deadline_header", Type: "string", Default: customMw.DefaultDeadlineHeader, Description: "Header that tells REST upstreams the milliseconds left, empty to not send it"},
+			},
+		},
+		params: func(route Route) interface{} {
+			return &customMw.TimeoutConfig{Duration: util.Duration(10 * time.Second), DeadlineHeader: customMw.DefaultDeadlineHeader}
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.TimeoutWithConfig(*params.(*customMw.TimeoutConfig))
+		},
+	},
+	"retry": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "retry",
+			Description: "Calls the upstream again when it fails",
+			Params: []customMw.ParamSchema{
+				{Name: "attempts", Type: "integer", Default: 3, Description: "Total number of attempts including the first"},
+				{Name: "on", Type: "integer[]", Description: "Status codes to retry on, defaults to 5xx and 408"},
+				{Name: "backoff", Type: "duration", Default: "100ms", Description: "Base delay, doubled after every attempt and jittered"},
+				{Name: "max_backoff", Type: "duration", Default: "2s", Description: "Upper bound of a single delay"},
+				{Name: "budget", Type: "duration", Default: "10s", Description: "Overall time for all attempts and delays"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "Requests with larger bodies are sent once"},
+				{Name: "non_idempotent", Type: "boolean", Default: false, Description: "Also retry POST and PATCH requests without an Idempotency-Key"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultRetryConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.RetryWithConfig(*params.(*customMw.RetryConfig))
+		},
+	},
+	"idempotency": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "idempotency",
+			Description: "Forwards the first request with an Idempotency-Key and answers duplicates with its stored response",
+			Params: []customMw.ParamSchema{
+				{Name: "ttl", Type: "duration", Default: "24h0m0s", Description: "How long a key and its response are kept"},
+				{Name: "lease", Type: "duration", Default: "1m0s", Description: "How long a request in flight holds its key, at least until its deadline"},
+				{Name: "wait", Type: "duration", Default: "10s", Description: "How long a duplicate waits for the first request to finish"},
+				{Name: "required", Type: "boolean", Default: false, Description: "Reject requests without an Idempotency-Key"},
+				{Name: "store", Type: "string", Default: customMw.IdempotencyStoreMemory, Description: "\"memory\" for this instance only or \"database\" to share keys between instances"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "Larger request bodies are rejected with 413"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultIdempotencyConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			config := *params.(*customMw.IdempotencyConfig)
+			var store idempotency.Store = idempotency.Memory
+			if config.Store == customMw.IdempotencyStoreDatabase {
+				store = idempotency.NewDatabaseStore(database.GetDB())
+			}
+			return customMw.IdempotencyMiddleware(config, store, route.Method+" "+route.Path)
+		},
+	},
+	"cache": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "cache",
+			Description: "Serves GET responses from the gateway cache, keyed by method, path, query and the vary headers",
+			Params: []customMw.ParamSchema{
+				{Name: "ttl", Type: "duration", Default: "1m0s", Description: "How long a response is fresh"},
+				{Name: "stale_while_revalidate", Type: "duration", Default: "0s", Description: "How long an expired response is served while it is refreshed in the background"},
+				{Name: "vary", Type: "string[]", Description: "Request headers that are part of the cache key"},
+				{Name: "respect_cache_control", Type: "boolean", Default: true, Description: "Follow the upstream's max-age, stale-while-revalidate, no-store and private"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "Larger responses are not cached"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultCacheConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.CacheMiddleware(*params.(*customMw.CacheConfig), cache.Default, cache.RouteName(route.Method, route.Path))
+		},
+	},
+	"coalesce": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "coalesce",
+			Description: "Collapses concurrent identical GET requests into one upstream call and shares its response",
+			Params: []customMw.ParamSchema{
+				{Name: "vary", Type: "string[]", Description: "Request headers that are part of the key, like the cache key"},
+			},
+		},
+		params: func(route Route) interface{} {
+			return &customMw.CoalesceConfig{}
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.CoalesceMiddleware(*params.(*customMw.CoalesceConfig), cache.RouteName(route.Method, route.Path))
+		},
+	},
+	"fallback": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "fallback",
+			Description: "Answers with a degraded response marked by X-Gateway-Fallback when the upstream fails or its breaker is open",
+			Params: []customMw.ParamSchema{
+				{Name: "mode", Type: "string", Default: customMw.FallbackStale, Description: "\"stale\" last good response, \"static\" configured body or \"service\" alternate upstream"},
+				{Name: "on", Type: "integer[]", Description: "Status codes that trigger the fallback, defaults to 5xx"},
+				{Name: "max_age", Type: "duration", Default: "10m0s", Description: "stale: oldest good response that may be served"},
+				{Name: "vary", Type: "string[]", Description: "stale: request headers that are part of the key"},
+				{Name: "status", Type: "integer", Default: http.StatusOK, Description: "static: status of the configured response"},
+				{Name: "body", Type: "string", Description: "static: body of the configured response"},
+				{Name: "content_type", Type: "string", Default: echo.MIMEApplicationJSON, Description: "static: content type of the configured body"},
+				{Name: "service_id", Type: "integer", Description: "service: alternate service to call"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "service: requests with larger bodies get no fallback"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultFallbackConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			config := *params.(*customMw.FallbackConfig)
+			return customMw.FallbackMiddleware(config, cache.Fallback, cache.RouteName(route.Method, route.Path), alternateService(config.ServiceID))
+		},
+	},
+	"circuit-breaker": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "circuit-breaker",
+			Description: "Gives the route its own breaker on top of the service breaker and rejects requests with 503 while it is open",
+			Params: []customMw.ParamSchema{
+				{Name: "mode", Type: "string", Default: breaker.ModeConsecutive, Description: "\"consecutive\" failures or failure \"rate\" in the window"},
+				{Name: "threshold", Type: "integer", Default: 5, Description: "Consecutive failures that open the breaker"},
+				{Name: "failure_rate", Type: "number", Default: 50, Description: "Percentage of failed calls in the window that opens the breaker"},
+				{Name: "min_requests", Type: "integer", Default: 10, Description: "Calls needed in the window before the failure rate counts"},
+				{Name: "window", Type: "duration", Default: "1m0s", Description: "Rolling window for the failure rate"},
+				{Name: "open_timeout", Type: "duration", Default: "30s", Description: "How long the breaker stays open before probing"},
+				{Name: "half_open_requests", Type: "integer", Default: 1, Description: "Probe calls allowed while half-open"},
+			},
+		},
+		params: func(route Route) interface{} {
+			policy := breaker.DefaultPolicy()
+			return &policy
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			key := breaker.RouteKey(route.ServiceID, route.Method, route.Path)
+			return customMw.CircuitBreakerMiddleware(key, *params.(*breaker.Policy))
+		},
+	},
+	"bulkhead": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "bulkhead",
+			Description: "Limits the concurrent requests of the route, queueing the overflow, and rejects requests with 503 once the queue is full",
+			Params: []customMw.ParamSchema{
+				{Name: "max_concurrent", Type: "integer", Default: 100, Description: "Requests handled at once"},
+				{Name: "max_queue", Type: "integer", Default: 50, Description: "Requests that may wait for a slot, 0 to reject at once"},
+				{Name: "queue_timeout", Type: "duration", Default: "1s", Description: "How long a queued request waits for a slot"},
+			},
+		},
+		params: func(route Route) interface{} {
+			policy := bulkhead.DefaultPolicy()
+			return &policy
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			key := breaker.RouteKey(route.ServiceID, route.Method, route.Path)
+			return customMw.BulkheadMiddleware(key, *params.(*bulkhead.Policy))
+		},
+	},
+	"hedge": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "hedge",
+			Description: "Sends a second attempt to a REST upstream when the first is slower than usual, answers with whichever responds first and cancels the other",
+			Params: []customMw.ParamSchema{
+				{Name: "percentile", Type: "number", Default: 95, Description: "Hedge once the attempt is slower than this percentile of the route's recent latencies, 0 to always use delay"},
+				{Name: "delay", Type: "duration", Default: "200ms", Description: "Delay used until enough latencies are known or when percentile is 0"},
+				{Name: "min_delay", Type: "duration", Default: "10ms", Description: "Lower bound of the percentile delay"},
+				{Name: "max_rate", Type: "number", Default: 0.1, Description: "Hedges allowed per request, 0.1 hedges at most one request in ten"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "Requests with larger bodies are not hedged"},
+				{Name: "service_id", Type: "integer", Description: "Service whose host the hedge is sent to, defaults to the route's own upstream"},
+				{Name: "non_idempotent", Type: "boolean", Default: false, Description: "Also hedge POST and PATCH requests"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultHedgeConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			config := *params.(*customMw.HedgeConfig)
+			key := breaker.RouteKey(route.ServiceID, route.Method, route.Path)
+			return customMw.HedgeMiddleware(config, hedge.Default.Get(key, config.Policy, hedgeTarget(config.ServiceID)))
+		},
+	},
+	"jwt": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "jwt",
+			Description: "Verifies the bearer token's signature, expiry, issuer and audience and rejects invalid and revoked tokens with 401 before the upstream is called",
+			Params: []customMw.ParamSchema{
+				{Name: "issuer", Type: "string", Description: "Required \"iss\" claim, any issuer if empty"},
+				{Name: "audience", Type: "string[]", Description: "Accepted \"aud\" values, any audience if empty"},
+				{Name: "jwks", Type: "string", Description: "URL or file of a JSON Web Key Set"},
+				{Name: "jwks_ttl", Type: "duration", Default: "1h0m0s", Description: "How long fetched keys are used before fetching them again. Unknown key IDs fetch the set early"},
+				{Name: "public_keys", Type: "string[]", Description: "PEM encoded public keys or certificates"},
+				{Name: "secret_env", Type: "string", Description: "Environment variable holding an HMAC secret"},
+				{Name: "leeway", Type: "duration", Default: "30s", Description: "Allowed clock skew for expiry and not-before, at most 5m"},
+				{Name: "optional", Type: "boolean", Default: false, Description: "Let requests without a token through, still rejecting invalid ones"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultJWTConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.JWTMiddleware(*params.(*customMw.JWTConfig), revocation.Default)
+		},
+	},
+	"api-key": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "api-key",
+			Description: "Authenticates the consumer by API key and checks its scopes and allowed routes. Missing or invalid keys are rejected with 401, forbidden consumers with 403",
+			Params: []customMw.ParamSchema{
+				{Name: "header", Type: "string", Default: util.ApiKey, Description: "Request header carrying the key"},
+				{Name: "scopes", Type: "string[]", Description: "Scopes the consumer must have"},
+				{Name: "optional", Type: "boolean", Default: false, Description: "Let requests without a key through, still rejecting invalid ones"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultAPIKeyConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.APIKeyMiddleware(*params.(*customMw.APIKeyConfig), route.Method, route.Path, route.Tag, consumer.Default)
+		},
+	},
+	"signature": {
+		schema: customMw.MiddlewareSchema{
+			Name:        "signature",
+			Description: "Verifies the HMAC-SHA256 request signature made with the consumer's signing secret, rejecting stale timestamps and replayed nonces, and checks the consumer's scopes and allowed routes",
+			Params: []customMw.ParamSchema{
+				{Name: "headers", Type: "string[]", Description: "Request headers covered by the signature, in order"},
+				{Name: "tolerance", Type: "duration", Default: "5m0s", Description: "How far the timestamp may be from the gateway's clock"},
+				{Name: "max_body_size", Type: "integer", Default: 1 << 20, Description: "Larger request bodies are rejected rather than buffered"},
+				{Name: "scopes", Type: "string[]", Description: "Scopes the consumer must have"},
+			},
+		},
+		params: func(route Route) interface{} {
+			config := customMw.DefaultSignatureConfig()
+			return &config
+		},
+		build: func(params interface{}, route Route) echo.MiddlewareFunc {
+			return customMw.SignatureMiddleware(*params.(*customMw.SignatureConfig), route.Method, route.Path, route.Tag, consumer.Default, signature.Default)
+		},
+	},
+}
+
+// hedgeTarget is the upstream URL of the service hedges are sent to, nil for the route's own upstream
+func hedgeTarget(id uint) *url.URL {
+	if id == 0 {
+		return nil
+	}
+	var svc database.Service
+	if err := database.GetDB().First(&svc, id).Error; err != nil {
+		return nil
+	}
+	target, err := url.Parse(svc.BaseURL)
+	if err != nil {
+		return nil
+	}
+	return target
+}
+
+// alternateService proxies to the service with the given ID, looked up on every call like routes are
+func alternateService(id uint) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var svc database.Service
+		if err := database.GetDB().First(&svc, id).Error; err != nil {
+			return echo.NewHTTPError(http.StatusBadGateway, "Fallback service not found")
+		}
+		return NewGenericProxyHandler(svc).Handle(c)
+	}
+}
+
+// decodeMiddleware resolves the middleware type of a spec and decodes its parameters
+func decodeMiddleware(spec customMw.MiddlewareSpec, route Route) (middlewareType, interface{}, error) {
+	mt, ok := middlewareTypes[spec.Name]
+	if !ok {
+		return mt, nil, fmt.Errorf("unknown middleware %q", spec.Name)
+	}
+	params := mt.params(route)
+	if err := spec.Decode(params); err != nil {
+		return mt, nil, err
+	}
+	return mt, params, nil
+}
+
+// buildMiddleware creates the middleware instance for one route
+func buildMiddleware(spec customMw.MiddlewareSpec, route Route) (echo.MiddlewareFunc, error) {
+	mt, params, err := decodeMiddleware(spec, route)
+	if err != nil {
+		return nil, err
+	}
+	return mt.build(params, route), nil
+}
+
+// MiddlewareSchemas lists every middleware type and its parameters
+func (g *Gateway) MiddlewareSchemas() []customMw.MiddlewareSchema {
+	schemas := make([]customMw.MiddlewareSchema, 0, len(middlewareTypes))
+	for _, mt := range middlewareTypes {
+		schemas = append(schemas, mt.schema)
+	}
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Name < schemas[j].Name })
+	return schemas
 }
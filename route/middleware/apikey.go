@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// APIKeyConfig are the parameters of the api-key middleware
+type APIKeyConfig struct {
+	Header   string   `json:"header"`   // Request header carrying the key
+	Scopes   []string `json:"scopes"`   // The consumer must have all of these
+	Optional bool     `json:"optional"` // Let requests without a key through, still rejecting invalid ones
+}
+
+// DefaultAPIKeyConfig reads the key from the gateway's API key header
+func DefaultAPIKeyConfig() APIKeyConfig {
+	return APIKeyConfig{Header: util.ApiKey}
+}
+
+func (c *APIKeyConfig) Validate() error {
+	if c.Header == "" {
+		return errors.New("header is required")
+	}
+	return nil
+}
+
+// KeyAuthenticator resolves an API key to the consumer it was issued to
+type KeyAuthenticator interface {
+	Authenticate(ctx context.Context, key string) (consumer.Identity, error)
+}
+
+// APIKeyMiddleware authenticates the request's API key and stores the consumer's name under
+// util.ContextConsumerKey for the traffic log and metrics, and the key's ID under
+// util.ContextAPIKeyIDKey for rate limits. The consumer's priority, if it has one, goes under
+// util.ContextPriorityKey for load shedding. Missing or invalid keys are rejected
+// with 401, consumers lacking a scope or not allowed on the route with 403.
+func APIKeyMiddleware(config APIKeyConfig, method, path, tag string, auth KeyAuthenticator) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			key := c.Request().Header.Get(config.Header)
+			if key == "" {
+				if config.Optional {
+					return next(c)
+				}
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing API key")
+			}
+
+			identity, err := auth.Authenticate(ctx, key)
+			if err != nil {
+				tracing.Warn(ctx, "APIKey", "Rejected key: "+err.Error())
+				if errors.Is(err, consumer.ErrInvalidKey) || errors.Is(err, consumer.ErrExpired) ||
+					errors.Is(err, consumer.ErrRevoked) || errors.Is(err, consumer.ErrDisabled) {
+					return echo.NewHTTPError(http.StatusUnauthorized, "Invalid API key: "+err.Error())
+				}
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Cannot verify API key")
+			}
+			c.Set(util.ContextConsumerKey, identity.Consumer)
+			c.Set(util.ContextAPIKeyIDKey, identity.KeyID)
+			if identity.Priority != "" {
+				c.Set(util.ContextPriorityKey, identity.Priority)
+			}
+
+			if !identity.HasScopes(config.Scopes) {
+				tracing.Warn(ctx, "APIKey", fmt.Sprintf("Consumer %s lacks scopes %v", identity.Consumer, config.Scopes))
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+			if !identity.AllowsRoute(method, path, tag) {
+				tracing.Warn(ctx, "APIKey", fmt.Sprintf("Consumer %s is not allowed on %s %s", identity.Consumer, method, path))
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+
+			tracing.Info(ctx, "APIKey", "Authenticated consumer "+identity.Consumer)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+)
+
+type stubKeys map[string]consumer.Identity
+
+func (s stubKeys) Authenticate(ctx context.Context, key string) (consumer.Identity, error) {
+	if key == "revoked" {
+		return consumer.Identity{}, consumer.ErrRevoked
+	}
+	if id, ok := s[key]; ok {
+		return id, nil
+	}
+	return consumer.Identity{}, consumer.ErrInvalidKey
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	keys := stubKeys{
+		"reader":  {Consumer: "reader", Scopes: []string{"read"}},
+		"writer":  {Consumer: "writer", Scopes: []string{"read", "write"}},
+		"limited": {Consumer: "limited", Scopes: []string{"read", "write"}, AllowedRoutes: []string{"GET /other"}},
+	}
+	config := DefaultAPIKeyConfig()
+	config.Scopes = []string{"write"}
+
+	e := echo.New()
+	var consumerName interface{}
+	h := APIKeyMiddleware(config, http.MethodPost, "/orders", "orders", keys)(func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	})
+	serve := func(key string) error {
+		req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+		if key != "" {
+			req.Header.Set(util.ApiKey, key)
+		}
+		c := e.NewContext(req, httptest.NewRecorder())
+		err := h(c)
+		consumerName = c.Get(util.ContextConsumerKey)
+		return err
+	}
+
+	status := func(err error) int {
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code
+		}
+		return http.StatusOK
+	}
+	assert.Equal(t, http.StatusUnauthorized, status(serve("")))
+	assert.Equal(t, http.StatusUnauthorized, status(serve("made-up")))
+	assert.Equal(t, http.StatusUnauthorized, status(serve("revoked")))
+	assert.Equal(t, http.StatusForbidden, status(serve("reader")))
+	assert.Equal(t, "reader", consumerName, "rejected consumers are still logged")
+	assert.Equal(t, http.StatusForbidden, status(serve("limited")))
+	assert.NoError(t, serve("writer"))
+	assert.Equal(t, "writer", consumerName)
+
+	config.Optional = true
+	h = APIKeyMiddleware(config, http.MethodPost, "/orders", "orders", keys)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	assert.NoError(t, serve(""))
+	assert.Nil(t, consumerName)
+	assert.Equal(t, http.StatusUnauthorized, status(serve("made-up")))
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/authz"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// AuthorizationMiddleware checks the claims verified by the jwt middleware against the
+// route's policy. Requests without claims get 401 and denied requests 403, and every
+// decision is written to the trace.
+func AuthorizationMiddleware(policy authz.Policy) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			claims, ok := c.Get(util.ContextJwtClaimKey).(map[string]interface{})
+			if !ok {
+				tracing.Warn(ctx, "Authz", "Denied: no verified token")
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing bearer token")
+			}
+
+			decision := policy.Evaluate(claims, c.Param)
+			if !decision.Allowed {
+				tracing.Warn(ctx, "Authz", "Denied: "+decision.Reason)
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+			tracing.Info(ctx, "Authz", "Allowed: "+decision.Reason)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/authz"
+)
+
+func TestAuthorizationMiddleware(t *testing.T) {
+	policy, _, err := authz.ParsePolicy(`{"rules": [{"claim": "role", "op": "in", "values": ["agent", "supervisor"]}]}`)
+	assert.NoError(t, err)
+	handler := AuthorizationMiddleware(policy)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e := echo.New()
+
+	status := func(claims map[string]interface{}) int {
+		c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+		if claims != nil {
+			c.Set(util.ContextJwtClaimKey, claims)
+		}
+		if err := handler(c); err != nil {
+			return err.(*echo.HTTPError).Code
+		}
+		return c.Response().Status
+	}
+
+	assert.Equal(t, http.StatusOK, status(map[string]interface{}{"role": "supervisor"}))
+	assert.Equal(t, http.StatusForbidden, status(map[string]interface{}{"role": "customer"}))
+	assert.Equal(t, http.StatusUnauthorized, status(nil))
+}
@@ -0,0 +1,311 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/deadline"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/metrics"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// HeaderCache reports whether the response came from the gateway cache: HIT, STALE or MISS
+const HeaderCache = "X-Cache"
+
+// CacheConfig are the parameters of the cache middleware
+type CacheConfig struct {
+	TTL                  util.Duration `json:"ttl"`                    // How long a response is fresh
+	StaleWhileRevalidate util.Duration `json:"stale_while_revalidate"` // How long an expired response is served while it is refreshed
+	Vary                 []string      `json:"vary"`                   // Request headers that are part of the cache key
+	RespectCacheControl  bool          `json:"respect_cache_control"`  // Follow the upstream's max-age, no-store and private
+	MaxBodySize          int           `json:"max_body_size"`          // Larger responses are not cached
+}
+
+// DefaultCacheConfig caches responses for a minute and follows upstream Cache-Control
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{
+		TTL:                 util.Duration(time.Minute),
+		RespectCacheControl: true,
+		MaxBodySize:         1 << 20,
+	}
+}
+
+func (c *CacheConfig) Validate() error {
+	if c.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if c.StaleWhileRevalidate < 0 {
+		return errors.New("stale_while_revalidate must not be negative")
+	}
+	if c.MaxBodySize < 1 {
+		return errors.New("max_body_size must be positive")
+	}
+	return nil
+}
+
+// CacheKey identifies a request by method, path, query and the given request headers
+func CacheKey(req *http.Request, vary []string) string {
+	var b strings.Builder
+	b.WriteString(req.Method)
+	b.WriteString(" ")
+	b.WriteString(req.URL.Path)
+	if query := req.URL.Query(); len(query) > 0 {
+		b.WriteString("?")
+		b.WriteString(query.Encode()) // Sorted by key
+	}
+
+	names := make([]string, len(vary))
+	for i, name := range vary {
+		names[i] = http.CanonicalHeaderKey(name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteString(": ")
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// CacheMiddleware serves GET requests of a route from store. route names the route in
+// metrics and purges. Requests carrying credentials are cached per client, and clients are
+// told to keep those responses private.
+func CacheMiddleware(config CacheConfig, store *cache.Store, route string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet || cacheControl(req.Header)["no-store"] != "" {
+				return next(c)
+			}
+
+			now := time.Now()
+			private := credentials(c) != ""
+			key := withCredentials(c, CacheKey(req, config.Vary))
+			if entry, ok := store.Get(key, now); ok && cacheControl(req.Header)["no-cache"] == "" {
+				if entry.Fresh(now) {
+					metrics.RecordCache(route, metrics.CacheHit)
+					return serveEntry(c, entry, "HIT", now, private)
+				}
+				metrics.RecordCache(route, metrics.CacheStale)
+				if store.StartRevalidation(key) {
+					tracing.Info(req.Context(), "Cache", "Serving stale response and revalidating in background")
+					go revalidate(newRevalidation(c, next), config, store, route, key)
+				}
+				return serveEntry(c, entry, "STALE", now, private)
+			}
+			metrics.RecordCache(route, metrics.CacheMiss)
+
+			// Keep the upstream's Cache-Control in the recording, it decides whether to store
+			c.Set(util.ContextCacheControlKey, "")
+			writer := c.Response().Writer
+			rec := record(c.Response())
+			err := next(c)
+			restoreWriter(c.Response(), writer)
+
+			c.Set(util.ContextCacheControlKey, nil)
+			if err == nil {
+				if entry, ok := newEntry(config, key, route, rec, time.Now()); ok {
+					store.Set(entry)
+					c.Set(util.ContextCacheControlKey, entryCacheControl(entry, time.Now(), private))
+				}
+			}
+			c.Response().Header().Set(HeaderCache, "MISS")
+			return rec.finish(c.Response(), writer, err)
+		}
+	}
+}
+
+// revalidation is what a background refresh needs of the request that triggered it. It is
+// copied before the handler returns, since echo reuses the context afterwards.
+type revalidation struct {
+	echo        *echo.Echo
+	next        echo.HandlerFunc
+	req         *http.Request
+	cancel      context.CancelFunc
+	path        string
+	paramNames  []string
+	paramValues []string
+	values      map[string]interface{}
+}
+
+// revalidationKeys are the context values of the request the rest of the chain reads
+var revalidationKeys = []string{util.ContextRouterKey, util.ContextConsumerKey, util.ContextJwtClaimKey, util.ContextPriorityKey}
+
+// newRevalidation copies the request onto a context detached from the client
+func newRevalidation(c echo.Context, next echo.HandlerFunc) *revalidation {
+	values := make(map[string]interface{})
+	for _, key := range revalidationKeys {
+		if v := c.Get(key); v != nil {
+			values[key] = v
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if name, ok := deadline.Header(c.Request().Context()); ok {
+		ctx = deadline.WithHeader(ctx, name)
+	}
+	return &revalidation{
+		echo:        c.Echo(),
+		next:        next,
+		req:         c.Request().Clone(ctx),
+		cancel:      cancel,
+		path:        c.Path(),
+		paramNames:  append([]string(nil), c.ParamNames()...),
+		paramValues: append([]string(nil), c.ParamValues()...),
+		values:      values,
+	}
+}
+
+// revalidate refreshes a stale entry after the client request has finished
+func revalidate(r *revalidation, config CacheConfig, store *cache.Store, route, key string) {
+	defer store.FinishRevalidation(key)
+	defer r.cancel()
+
+	rec := newResponseRecorder()
+	bc := r.echo.NewContext(r.req, rec)
+	bc.SetPath(r.path)
+	bc.SetParamNames(r.paramNames...)
+	bc.SetParamValues(r.paramValues...)
+	for key, v := range r.values {
+		bc.Set(key, v)
+	}
+
+	if err := r.next(bc); err != nil {
+		return
+	}
+	if entry, ok := newEntry(config, key, route, rec, time.Now()); ok {
+		store.Set(entry)
+	}
+}
+
+// newEntry turns a recorded response into a cache entry if it may be cached
+func newEntry(config CacheConfig, key, route string, rec *responseRecorder, now time.Time) (*cache.Entry, bool) {
+	if rec.status != http.StatusOK || rec.body.Len() > config.MaxBodySize || rec.header.Get("Set-Cookie") != "" {
+		return nil, false
+	}
+
+	// The key only covers the configured headers, so responses that vary on others cannot be shared
+	for _, value := range rec.header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			name = strings.TrimSpace(name)
+			// An unencoded body suits every client whatever encoding they accept
+			if strings.EqualFold(name, echo.HeaderAcceptEncoding) && rec.header.Get(echo.HeaderContentEncoding) == "" {
+				continue
+			}
+			if name != "" && !varies(config.Vary, name) {
+				return nil, false
+			}
+		}
+	}
+	if rec.header.Get(echo.HeaderContentEncoding) != "" && !varies(config.Vary, echo.HeaderAcceptEncoding) {
+		return nil, false
+	}
+
+	ttl := time.Duration(config.TTL)
+	stale := time.Duration(config.StaleWhileRevalidate)
+	if config.RespectCacheControl {
+		directives := cacheControl(rec.header)
+		if directives["no-store"] != "" || directives["private"] != "" || directives["no-cache"] != "" {
+			return nil, false
+		}
+		if age, ok := directiveSeconds(directives, "s-maxage"); ok {
+			ttl = age
+		} else if age, ok := directiveSeconds(directives, "max-age"); ok {
+			ttl = age
+		}
+		if age, ok := directiveSeconds(directives, "stale-while-revalidate"); ok {
+			stale = age
+		}
+	}
+	if ttl <= 0 {
+		return nil, false
+	}
+
+	header := rec.header.Clone()
+	header.Del(HeaderCache)
+	return &cache.Entry{
+		Key:        key,
+		Route:      route,
+		Status:     rec.status,
+		Header:     header,
+		Body:       append([]byte(nil), rec.body.Bytes()...),
+		StoredAt:   now,
+		FreshUntil: now.Add(ttl),
+		StaleUntil: now.Add(ttl + stale),
+	}, true
+}
+
+func serveEntry(c echo.Context, entry *cache.Entry, outcome string, now time.Time, private bool) error {
+	res := c.Response()
+	for k, v := range entry.Header {
+		res.Header()[k] = v
+	}
+	res.Header().Set(HeaderCache, outcome)
+	res.Header().Set("Age", strconv.Itoa(int(now.Sub(entry.StoredAt).Seconds())))
+	c.Set(util.ContextCacheControlKey, entryCacheControl(entry, now, private))
+	res.WriteHeader(entry.Status)
+	_, err := res.Write(entry.Body)
+	return err
+}
+
+// entryCacheControl lets clients cache the response for as long as the gateway does. Personal
+// responses are kept out of shared caches along the way.
+func entryCacheControl(entry *cache.Entry, now time.Time, private bool) string {
+	remaining := int(entry.FreshUntil.Sub(now).Seconds())
+	if remaining < 0 {
+		remaining = 0
+	}
+	if private {
+		return "private, max-age=" + strconv.Itoa(remaining)
+	}
+	return "public, max-age=" + strconv.Itoa(remaining)
+}
+
+// cacheControl parses the Cache-Control header into lower case directives. Directives
+// without a value map to themselves so they can be tested for presence.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(value, ",") {
+			name, arg, found := strings.Cut(strings.TrimSpace(part), "=")
+			name = strings.ToLower(name)
+			if name == "" {
+				continue
+			}
+			if !found {
+				arg = name
+			}
+			directives[name] = strings.Trim(arg, `"`)
+		}
+	}
+	return directives
+}
+
+func directiveSeconds(directives map[string]string, name string) (time.Duration, bool) {
+	value, ok := directives[name]
+	if !ok {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, false
+	}
+	return time.Duration(seconds) * time.Second, true
+}
+
+func varies(vary []string, name string) bool {
+	for _, v := range vary {
+		if strings.EqualFold(v, name) {
+			return true
+		}
+	}
+	return false
+}
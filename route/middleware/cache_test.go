@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+)
+
+func serveCached(mw echo.MiddlewareFunc, h echo.HandlerFunc, target string, header http.Header) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if err := mw(h)(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func countingUpstream(calls *int32, cacheControl string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		n := atomic.AddInt32(calls, 1)
+		if cacheControl != "" {
+			c.Response().Header().Set("Cache-Control", cacheControl)
+		}
+		return c.String(http.StatusOK, c.Request().URL.RawQuery+"#"+strconv.Itoa(int(n)))
+	}
+}
+
+func TestCacheServesFreshResponses(t *testing.T) {
+	var calls int32
+	config := DefaultCacheConfig()
+	config.Vary = []string{"Accept-Language"}
+	mw := CacheMiddleware(config, cache.NewStore(100), "GET /ref/provinces")
+	h := countingUpstream(&calls, "")
+
+	first := serveCached(mw, h, "/ref/provinces?b=2&a=1", nil)
+	assert.Equal(t, "MISS", first.Header().Get(HeaderCache))
+
+	second := serveCached(mw, h, "/ref/provinces?a=1&b=2", nil)
+	assert.Equal(t, "HIT", second.Header().Get(HeaderCache))
+	assert.Equal(t, first.Body.String(), second.Body.String())
+
+	// Vary headers and the query are part of the key
+	serveCached(mw, h, "/ref/provinces?a=1&b=2", http.Header{"Accept-Language": {"id"}})
+	serveCached(mw, h, "/ref/provinces?a=2", nil)
+	assert.Equal(t, int32(3), calls)
+
+	// Clients can bypass the cache
+	bypass := serveCached(mw, h, "/ref/provinces?a=1&b=2", http.Header{"Cache-Control": {"no-cache"}})
+	assert.Equal(t, "MISS", bypass.Header().Get(HeaderCache))
+	assert.Equal(t, int32(4), calls)
+}
+
+func TestCacheFollowsUpstreamCacheControl(t *testing.T) {
+	var calls int32
+	mw := CacheMiddleware(DefaultCacheConfig(), cache.NewStore(100), "GET /profile")
+	h := countingUpstream(&calls, "private, max-age=60")
+	serveCached(mw, h, "/profile", nil)
+	serveCached(mw, h, "/profile", nil)
+	assert.Equal(t, int32(2), calls)
+
+	store := cache.NewStore(100)
+	mw = CacheMiddleware(DefaultCacheConfig(), store, "GET /ref/cities")
+	serveCached(mw, countingUpstream(&calls, "max-age=5"), "/ref/cities", nil)
+	entry, ok := store.Get("GET /ref/cities", time.Now())
+	if assert.True(t, ok) {
+		assert.WithinDuration(t, time.Now().Add(5*time.Second), entry.FreshUntil, time.Second)
+	}
+}
+
+func TestCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	store := cache.NewStore(100)
+	config := DefaultCacheConfig()
+	config.TTL = util.Duration(time.Millisecond)
+	config.StaleWhileRevalidate = util.Duration(time.Minute)
+	mw := CacheMiddleware(config, store, "GET /ref/provinces")
+	h := countingUpstream(&calls, "")
+
+	serveCached(mw, h, "/ref/provinces", nil)
+	time.Sleep(5 * time.Millisecond)
+
+	stale := serveCached(mw, h, "/ref/provinces", nil)
+	assert.Equal(t, "STALE", stale.Header().Get(HeaderCache))
+	assert.Equal(t, "#1", stale.Body.String())
+
+	// The background refresh replaces the entry
+	assert.Eventually(t, func() bool {
+		entry, ok := store.Get("GET /ref/provinces", time.Now())
+		return ok && string(entry.Body) == "#2"
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestCacheKeepsCredentialedResponsesApart(t *testing.T) {
+	var calls int32
+	mw := CacheMiddleware(DefaultCacheConfig(), cache.NewStore(100), "GET /accounts")
+	h := countingUpstream(&calls, "")
+	alice := http.Header{echo.HeaderAuthorization: {"Bearer alice"}}
+
+	first := serveCached(mw, h, "/accounts", alice)
+	assert.Equal(t, "MISS", first.Header().Get(HeaderCache))
+	assert.Equal(t, "MISS", serveCached(mw, h, "/accounts", http.Header{echo.HeaderAuthorization: {"Bearer bob"}}).Header().Get(HeaderCache))
+	assert.Equal(t, "MISS", serveCached(mw, h, "/accounts", nil).Header().Get(HeaderCache))
+	assert.Equal(t, int32(3), calls)
+
+	again := serveCached(mw, h, "/accounts", alice)
+	assert.Equal(t, "HIT", again.Header().Get(HeaderCache))
+	assert.Equal(t, first.Body.String(), again.Body.String())
+}
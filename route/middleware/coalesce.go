@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/metrics"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// HeaderCoalesced marks a response shared from another identical request
+const HeaderCoalesced = "X-Gateway-Coalesced"
+
+// CoalesceConfig are the parameters of the coalesce middleware
+type CoalesceConfig struct {
+	Vary []string `json:"vary"` // Request headers that are part of the key, like the cache key
+}
+
+// flight is an upstream call that identical requests wait on
+type flight struct {
+	done   chan struct{}
+	status int
+	header http.Header
+	body   []byte // Shared by every waiter, never written after done is closed
+	err    error
+}
+
+// CoalesceMiddleware collapses concurrent identical GET requests of a route into one upstream call.
+// Every waiter gets the status, headers and body of that call. Requests with credentials are
+// only collapsed with those of the same client.
+func CoalesceMiddleware(config CoalesceConfig, route string) echo.MiddlewareFunc {
+	var mu sync.Mutex
+	flights := make(map[string]*flight)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if req.Method != http.MethodGet {
+				return next(c)
+			}
+			key := withCredentials(c, CacheKey(req, config.Vary))
+
+			mu.Lock()
+			if f, ok := flights[key]; ok {
+				mu.Unlock()
+				metrics.RecordCoalesce(route, true)
+				tracing.Info(req.Context(), "Coalesce", "Waiting for identical request in flight")
+				select {
+				case <-f.done:
+				case <-req.Context().Done():
+					return echo.NewHTTPError(http.StatusRequestTimeout, "Request cancelled")
+				}
+				if f.err != nil && f.body == nil {
+					return f.err
+				}
+				res := c.Response()
+				for k, v := range f.header {
+					res.Header()[k] = append([]string(nil), v...)
+				}
+				res.Header().Set(HeaderCoalesced, "true")
+				res.WriteHeader(f.status)
+				_, err := res.Write(f.body)
+				return err
+			}
+			f := &flight{done: make(chan struct{}), err: echo.NewHTTPError(http.StatusBadGateway, "Upstream call failed")}
+			flights[key] = f
+			mu.Unlock()
+			metrics.RecordCoalesce(route, false)
+
+			// Release the waiters even if the handler panics
+			defer func() {
+				mu.Lock()
+				delete(flights, key)
+				mu.Unlock()
+				close(f.done)
+			}()
+
+			writer := c.Response().Writer
+			rec := record(c.Response())
+			err := next(c)
+			restoreWriter(c.Response(), writer)
+
+			f.status = rec.status
+			f.header = rec.header.Clone()
+			f.err = err
+			if err == nil || rec.body.Len() > 0 {
+				f.body = append([]byte(nil), rec.body.Bytes()...)
+			}
+
+			return rec.finish(c.Response(), writer, err)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/metrics"
+)
+
+func TestCoalesceCollapsesIdenticalRequests(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := func(c echo.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		c.Response().Header().Set("X-Upstream", "ref")
+		return c.String(http.StatusOK, "provinces")
+	}
+	route := "GET /ref/provinces coalesce-test"
+	mw := CoalesceMiddleware(CoalesceConfig{}, route)
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 5)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = serveCached(mw, h, "/ref/provinces", nil)
+		}(i)
+	}
+	assert.Eventually(t, func() bool {
+		stats := metrics.DefaultRegistry.CoalesceStats(route)
+		return stats.Upstream+stats.Collapsed == 5
+	}, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, int64(4), metrics.DefaultRegistry.CoalesceStats(route).Collapsed)
+	coalesced := 0
+	for _, rec := range results {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "provinces", rec.Body.String())
+		assert.Equal(t, "ref", rec.Header().Get("X-Upstream"))
+		if rec.Header().Get(HeaderCoalesced) == "true" {
+			coalesced++
+		}
+	}
+	assert.Equal(t, 4, coalesced)
+
+	// Once the call finished, the next request goes upstream again
+	serveCached(mw, h, "/ref/provinces", nil)
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestCoalesceKeepsClientsApart(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := func(c echo.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return c.String(http.StatusOK, c.Request().Header.Get(echo.HeaderAuthorization))
+	}
+	route := "GET /accounts coalesce-test"
+	mw := CoalesceMiddleware(CoalesceConfig{}, route)
+
+	var wg sync.WaitGroup
+	users := []string{"Bearer alice", "Bearer bob"}
+	results := make([]*httptest.ResponseRecorder, len(users))
+	for i, user := range users {
+		wg.Add(1)
+		go func(i int, user string) {
+			defer wg.Done()
+			results[i] = serveCached(mw, h, "/accounts", http.Header{echo.HeaderAuthorization: {user}})
+		}(i, user)
+	}
+	assert.Eventually(t, func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	for i, user := range users {
+		assert.Equal(t, user, results[i].Body.String())
+		assert.Empty(t, results[i].Header().Get(HeaderCoalesced))
+	}
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
+)
+
+// credentialHeaders carry who the client is, so responses to requests with them may be personal
+var credentialHeaders = []string{
+	echo.HeaderAuthorization, "Proxy-Authorization", echo.HeaderCookie,
+	util.ApiKey, "X-Api-Key", "Client-Secret", signature.HeaderClientID,
+}
+
+// credentials identifies who sent the request by a hash of its credential headers and the
+// consumer it authenticated as, so keys built from it are not shared between clients and do
+// not hold secrets. It is empty for anonymous requests.
+func credentials(c echo.Context) string {
+	h := sha256.New()
+	found := false
+	for _, name := range credentialHeaders {
+		for _, value := range c.Request().Header.Values(name) {
+			h.Write([]byte(name + ": " + value + "\n"))
+			found = true
+		}
+	}
+	if consumer, ok := c.Get(util.ContextConsumerKey).(string); ok && consumer != "" {
+		h.Write([]byte("Consumer: " + consumer + "\n"))
+		found = true
+	}
+	if !found {
+		return ""
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// withCredentials extends a request key with the client's credentials, if it has any
+func withCredentials(c echo.Context, key string) string {
+	if id := credentials(c); id != "" {
+		return key + "\nCredentials: " + id
+	}
+	return key
+}
+
+// caller identifies the client the route authenticated by its API key, consumer or token
+// subject, which stay the same when the client renews its credentials. Other requests are
+// identified by their credentials, and anonymous requests by nothing.
+func caller(c echo.Context) string {
+	if id, ok := c.Get(util.ContextAPIKeyIDKey).(uint); ok {
+		return "api_key:" + strconv.FormatUint(uint64(id), 10)
+	}
+	if consumer, ok := c.Get(util.ContextConsumerKey).(string); ok && consumer != "" {
+		return "consumer:" + consumer
+	}
+	if claims, ok := c.Get(util.ContextJwtClaimKey).(map[string]interface{}); ok && claims["sub"] != nil {
+		return "sub:" + fmt.Sprint(claims["sub"])
+	}
+	if id := credentials(c); id != "" {
+		return "credentials:" + id
+	}
+	return ""
+}
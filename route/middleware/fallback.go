@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// HeaderFallback names the fallback that produced a degraded response
+const HeaderFallback = "X-Gateway-Fallback"
+
+const (
+	FallbackStale   = "stale"
+	FallbackStatic  = "static"
+	FallbackService = "service"
+)
+
+// FallbackConfig are the parameters of the fallback middleware
+type FallbackConfig struct {
+	Mode        string        `json:"mode"`          // "stale", "static" or "service"
+	On          []int         `json:"on"`            // Status codes that trigger the fallback, defaults to 5xx
+	MaxAge      util.Duration `json:"max_age"`       // stale: oldest good response that may be served
+	Vary        []string      `json:"vary"`          // stale: request headers that are part of the key
+	Status      int           `json:"status"`        // static: status of the configured response
+	Body        string        `json:"body"`          // static: body of the configured response
+	ContentType string        `json:"content_type"`  // static: content type of the configured body
+	ServiceID   uint          `json:"service_id"`    // service: alternate service to call
+	MaxBodySize int64         `json:"max_body_size"` // service: requests with larger bodies get no fallback
+}
+
+// DefaultFallbackConfig serves the last good response up to 10 minutes old
+func DefaultFallbackConfig() FallbackConfig {
+	return FallbackConfig{
+		Mode:        FallbackStale,
+		MaxAge:      util.Duration(10 * time.Minute),
+		Status:      http.StatusOK,
+		ContentType: echo.MIMEApplicationJSON,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+func (c *FallbackConfig) Validate() error {
+	switch c.Mode {
+	case FallbackStale:
+		if c.MaxAge <= 0 {
+			return errors.New("max_age must be positive")
+		}
+	case FallbackStatic:
+		if c.Status < 100 || c.Status > 599 {
+			return errors.New("status must be a valid HTTP status")
+		}
+	case FallbackService:
+		if c.ServiceID == 0 {
+			return errors.New("service_id is required")
+		}
+		if c.MaxBodySize < 0 {
+			return errors.New("max_body_size must not be negative")
+		}
+	default:
+		return errors.New("mode must be \"stale\", \"static\" or \"service\"")
+	}
+	for _, code := range c.On {
+		if code < 400 || code > 599 {
+			return errors.New("on must only list error statuses")
+		}
+	}
+	return nil
+}
+
+func (c *FallbackConfig) triggers(code int) bool {
+	if len(c.On) == 0 {
+		return code >= http.StatusInternalServerError
+	}
+	for _, v := range c.On {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// FallbackMiddleware answers with a degraded response when the upstream fails or its breaker
+// is open. Good GET responses are kept in store for the stale mode, alternate calls the
+// fallback service in the service mode, which buffers request bodies up to MaxBodySize to
+// send them again. Stale responses of requests with credentials are only served to the same client.
+func FallbackMiddleware(config FallbackConfig, store *cache.Store, route string, alternate echo.HandlerFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			key := withCredentials(c, route+"\n"+CacheKey(req, config.Vary))
+
+			var body []byte
+			replayable := config.Mode == FallbackService
+			if replayable {
+				var err error
+				body, replayable, err = bufferBody(req, config.MaxBodySize)
+				if err != nil {
+					return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+				}
+				if replayable && body != nil {
+					req.Body = io.NopCloser(bytes.NewReader(body))
+				}
+			}
+
+			writer := c.Response().Writer
+			rec := record(c.Response())
+			err := next(c)
+			restoreWriter(c.Response(), writer)
+
+			code := rec.status
+			if he, ok := err.(*echo.HTTPError); ok {
+				code = he.Code
+			} else if err != nil {
+				code = http.StatusInternalServerError
+			}
+
+			if !config.triggers(code) {
+				if config.Mode == FallbackStale && err == nil && req.Method == http.MethodGet && rec.status == http.StatusOK {
+					now := time.Now()
+					store.Set(&cache.Entry{
+						Key:        key,
+						Route:      route,
+						Status:     rec.status,
+						Header:     rec.header.Clone(),
+						Body:       append([]byte(nil), rec.body.Bytes()...),
+						StoredAt:   now,
+						FreshUntil: now.Add(time.Duration(config.MaxAge)),
+					})
+				}
+				return rec.finish(c.Response(), writer, err)
+			}
+
+			switch config.Mode {
+			case FallbackStale:
+				entry, ok := store.Get(key, time.Now())
+				if !ok {
+					tracing.Warn(ctx, "Fallback", "No recent good response to fall back on")
+					break
+				}
+				tracing.Warn(ctx, "Fallback", "Upstream failed, serving last good response")
+				c.Response().Header().Set("Warning", `110 - "Response is Stale"`)
+				return serveFallback(c, FallbackStale, entry.Status, entry.Header, entry.Body)
+
+			case FallbackStatic:
+				tracing.Warn(ctx, "Fallback", "Upstream failed, serving static response")
+				header := http.Header{}
+				if config.ContentType != "" {
+					header.Set(echo.HeaderContentType, config.ContentType)
+				}
+				c.Response().Header().Set("Warning", `199 - "Degraded response"`)
+				return serveFallback(c, FallbackStatic, config.Status, header, []byte(config.Body))
+
+			case FallbackService:
+				if !replayable {
+					tracing.Warn(ctx, "Fallback", "Upstream failed, request body too large to send to the fallback service")
+					break
+				}
+				tracing.Warn(ctx, "Fallback", "Upstream failed, calling fallback service")
+				req.Body = io.NopCloser(bytes.NewReader(body))
+				alt := record(c.Response())
+				altErr := alternate(c)
+				restoreWriter(c.Response(), writer)
+				if altErr == nil && alt.status < http.StatusInternalServerError {
+					c.Response().Header().Set("Warning", `199 - "Degraded response"`)
+					return serveFallback(c, FallbackService, alt.status, alt.header, alt.body.Bytes())
+				}
+				tracing.Error(ctx, "Fallback", "Fallback service failed too")
+			}
+			return rec.finish(c.Response(), writer, err)
+		}
+	}
+}
+
+func serveFallback(c echo.Context, mode string, status int, header http.Header, body []byte) error {
+	res := c.Response()
+	for k, v := range header {
+		res.Header()[k] = append([]string(nil), v...)
+	}
+	res.Header().Set(HeaderFallback, mode)
+	res.WriteHeader(status)
+	_, err := res.Write(body)
+	return err
+}
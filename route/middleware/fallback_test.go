@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/cache"
+)
+
+func TestFallbackServesLastGoodResponse(t *testing.T) {
+	healthy := true
+	h := func(c echo.Context) error {
+		if !healthy {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Service temporarily unavailable (Circuit Breaker OPEN)")
+		}
+		return c.String(http.StatusOK, "provinces")
+	}
+	mw := FallbackMiddleware(DefaultFallbackConfig(), cache.NewStore(10), "GET /ref/provinces", nil)
+
+	ok := serveCached(mw, h, "/ref/provinces", nil)
+	assert.Equal(t, "", ok.Header().Get(HeaderFallback))
+
+	healthy = false
+	degraded := serveCached(mw, h, "/ref/provinces", nil)
+	assert.Equal(t, http.StatusOK, degraded.Code)
+	assert.Equal(t, "provinces", degraded.Body.String())
+	assert.Equal(t, FallbackStale, degraded.Header().Get(HeaderFallback))
+	assert.Contains(t, degraded.Header().Get("Warning"), "110")
+
+	// Nothing to fall back on for other keys
+	failed := serveCached(mw, h, "/ref/provinces?page=2", nil)
+	assert.Equal(t, http.StatusServiceUnavailable, failed.Code)
+
+	// Nor for other clients
+	healthy = true
+	serveCached(mw, h, "/ref/provinces", http.Header{echo.HeaderAuthorization: {"Bearer alice"}})
+	healthy = false
+	failed = serveCached(mw, h, "/ref/provinces", http.Header{echo.HeaderAuthorization: {"Bearer bob"}})
+	assert.Equal(t, http.StatusServiceUnavailable, failed.Code)
+	degraded = serveCached(mw, h, "/ref/provinces", http.Header{echo.HeaderAuthorization: {"Bearer alice"}})
+	assert.Equal(t, FallbackStale, degraded.Header().Get(HeaderFallback))
+}
+
+func TestFallbackStaticAndService(t *testing.T) {
+	down := func(c echo.Context) error {
+		return c.String(http.StatusBadGateway, "bad gateway")
+	}
+
+	config := FallbackConfig{Mode: FallbackStatic, Status: http.StatusOK, Body: `{"data":[]}`, ContentType: echo.MIMEApplicationJSON}
+	rec := serveCached(FallbackMiddleware(config, cache.NewStore(10), "GET /ref/cities", nil), down, "/ref/cities", nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `{"data":[]}`, rec.Body.String())
+	assert.Equal(t, FallbackStatic, rec.Header().Get(HeaderFallback))
+
+	alternate := func(c echo.Context) error {
+		return c.String(http.StatusOK, "from replica")
+	}
+	config = FallbackConfig{Mode: FallbackService, ServiceID: 2}
+	rec = serveCached(FallbackMiddleware(config, cache.NewStore(10), "GET /ref/cities", alternate), down, "/ref/cities", nil)
+	assert.Equal(t, "from replica", rec.Body.String())
+	assert.Equal(t, FallbackService, rec.Header().Get(HeaderFallback))
+
+	// A failing alternate leaves the original failure
+	rec = serveCached(FallbackMiddleware(config, cache.NewStore(10), "GET /ref/cities", down), down, "/ref/cities", nil)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(HeaderFallback))
+}
+
+func TestFallbackServiceSendsBodyAgain(t *testing.T) {
+	down := func(c echo.Context) error {
+		io.ReadAll(c.Request().Body)
+		return c.String(http.StatusBadGateway, "bad gateway")
+	}
+	alternate := func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		return c.String(http.StatusOK, string(body))
+	}
+	config := FallbackConfig{Mode: FallbackService, ServiceID: 2, MaxBodySize: 8}
+	mw := FallbackMiddleware(config, cache.NewStore(10), "POST /transfers", alternate)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/transfers", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		if err := mw(down)(c); err != nil {
+			c.Echo().HTTPErrorHandler(err, c)
+		}
+		return rec
+	}
+
+	rec := send(`{"a":1}`)
+	assert.Equal(t, `{"a":1}`, rec.Body.String())
+	assert.Equal(t, FallbackService, rec.Header().Get(HeaderFallback))
+
+	// Larger bodies are not buffered, so they cannot be sent to the fallback service
+	rec = send(`{"amount":100}`)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "", rec.Header().Get(HeaderFallback))
+}
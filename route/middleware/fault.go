@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/fault"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// FaultMiddleware injects the faults that match the request. Latency is added before the
+// next fault is considered, while an abort or a broken body ends the injection.
+func FaultMiddleware(faults []fault.Fault) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(faults) == 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			now := time.Now()
+			for _, f := range faults {
+				if !f.Matches(c.Request(), now) {
+					continue
+				}
+				tracing.Warn(ctx, "Fault", "Injected "+f.String())
+
+				switch f.Type {
+				case fault.TypeLatency:
+					select {
+					case <-time.After(f.Delay):
+					case <-ctx.Done():
+						return echo.NewHTTPError(http.StatusRequestTimeout, "Request cancelled")
+					}
+				case fault.TypeAbort:
+					return f.Abort()
+				default:
+					writer := c.Response().Writer
+					rec := record(c.Response())
+					err := next(c)
+					body := f.Mangle(rec.body.Bytes())
+					rec.body.Reset()
+					rec.body.Write(body)
+					rec.header.Del(echo.HeaderContentLength)
+					return rec.finish(c.Response(), writer, err)
+				}
+			}
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/fault"
+)
+
+func TestFaultInjection(t *testing.T) {
+	e := echo.New()
+	expires := time.Now().Add(time.Minute)
+	upstream := func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "healthy"})
+	}
+
+	faults := []fault.Fault{
+		{Name: "slow", Type: fault.TypeLatency, Delay: 20 * time.Millisecond, Percentage: 100, ExpiresAt: expires},
+		{Name: "cut", Type: fault.TypeTruncate, Percentage: 100, HeaderName: "X-Chaos", ExpiresAt: expires},
+		{Name: "down", Type: fault.TypeAbort, Status: http.StatusServiceUnavailable, Percentage: 100, HeaderName: "X-Chaos-Abort", ExpiresAt: expires},
+	}
+	handler := FaultMiddleware(faults)(upstream)
+
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	assert.NoError(t, handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	assert.JSONEq(t, `{"status":"healthy"}`, rec.Body.String())
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Chaos", "1")
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(req, rec)))
+	assert.Equal(t, `{"status":`, rec.Body.String(), "half of the body is sent")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Chaos-Abort", "1")
+	err := handler(e.NewContext(req, httptest.NewRecorder()))
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusServiceUnavailable, he.Code)
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
+)
+
+// GatewayTokenMiddleware has the upstream calls of the request signed with the service's key.
+// The token carries the request ID, the consumer and the claims verified by the jwt middleware.
+func GatewayTokenMiddleware(signer *gatewayauth.Signer) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			id := gatewayauth.Identity{RequestID: c.Response().Header().Get(echo.HeaderXRequestID)}
+			if id.RequestID == "" {
+				id.RequestID = c.Request().Header.Get(echo.HeaderXRequestID)
+			}
+			id.Consumer, _ = c.Get(util.ContextConsumerKey).(string)
+			id.Claims, _ = c.Get(util.ContextJwtClaimKey).(map[string]interface{})
+
+			req := c.Request()
+			c.SetRequest(req.WithContext(gatewayauth.WithSigner(req.Context(), signer, id)))
+			return next(c)
+		}
+	}
+}
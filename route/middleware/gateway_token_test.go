@@ -0,0 +1,48 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
+)
+
+func TestGatewayTokenMiddleware(t *testing.T) {
+	keys := map[string][]byte{"k1": []byte("secret")}
+	signer := &gatewayauth.Signer{KeyID: "k1", Secret: keys["k1"], Audience: "orders", TTL: gatewayauth.DefaultTTL}
+
+	var claims *gatewayauth.Claims
+	upstream := httptest.NewServer(gatewayauth.NewVerifier("orders", keys).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, _ = gatewayauth.FromContext(r.Context())
+	})))
+	defer upstream.Close()
+
+	e := echo.New()
+	h := GatewayTokenMiddleware(signer)(func(c echo.Context) error {
+		req, _ := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, upstream.URL+"/orders", nil)
+		res, err := (&http.Client{Transport: &gatewayauth.Transport{Next: http.DefaultTransport}}).Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return c.NoContent(res.StatusCode)
+	})
+
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/orders", nil), rec)
+	c.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+	c.Set(util.ContextConsumerKey, "acme")
+	c.Set(util.ContextJwtClaimKey, map[string]interface{}{"sub": "user-7"})
+	require.NoError(t, h(c))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	require.NotNil(t, claims)
+	assert.Equal(t, "req-1", claims.RequestID)
+	assert.Equal(t, "acme", claims.Consumer)
+	assert.Equal(t, "user-7", claims.Subject)
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
+)
+
+// HedgeConfig are the parameters of the hedge middleware
+type HedgeConfig struct {
+	hedge.Policy
+	ServiceID     uint `json:"service_id"`     // Service hedges are sent to, 0 for the route's own upstream
+	NonIdempotent bool `json:"non_idempotent"` // Also hedge POST and PATCH
+}
+
+// DefaultHedgeConfig hedges idempotent requests slower than the p95 of the route
+func DefaultHedgeConfig() HedgeConfig {
+	return HedgeConfig{Policy: hedge.DefaultPolicy()}
+}
+
+func (c *HedgeConfig) Validate() error {
+	return c.Policy.Validate()
+}
+
+// HedgeMiddleware lets the upstream transport send a second attempt when the first one is
+// slow. The first response wins and the other attempt is cancelled. Only idempotent methods
+// are hedged, since both attempts reach the upstream and an Idempotency-Key is not enough
+// to stop a second POST.
+func HedgeMiddleware(config HedgeConfig, h *hedge.Hedger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if !idempotentMethod(req.Method) && !config.NonIdempotent {
+				return next(c)
+			}
+			c.SetRequest(req.WithContext(hedge.WithHedger(req.Context(), h)))
+			defer c.SetRequest(req)
+			return next(c)
+		}
+	}
+}
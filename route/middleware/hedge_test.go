@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
+)
+
+func TestHedgeOnlyIdempotentRequests(t *testing.T) {
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(time.Second):
+			}
+			return
+		}
+		io.WriteString(w, "ok")
+	}))
+	defer upstream.Close()
+
+	config := DefaultHedgeConfig()
+	config.Delay = util.Duration(10 * time.Millisecond)
+	config.MaxRate = 1
+	handler := HedgeMiddleware(config, hedge.NewRegistry().Get("test:hedge", config.Policy, nil))(func(c echo.Context) error {
+		req, _ := http.NewRequestWithContext(c.Request().Context(), c.Request().Method, upstream.URL, nil)
+		res, err := hedge.Transport.RoundTrip(req)
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		c.Response().Header().Set(hedge.HeaderHedged, res.Header.Get(hedge.HeaderHedged))
+		return c.NoContent(res.StatusCode)
+	})
+
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	start := time.Now()
+	assert.NoError(t, handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)))
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, "true", rec.Header().Get(hedge.HeaderHedged))
+	assert.Equal(t, int32(2), calls.Load())
+
+	calls.Store(0)
+	rec = httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(httptest.NewRequest(http.MethodPost, "/", nil), rec)))
+	assert.Empty(t, rec.Header().Get(hedge.HeaderHedged))
+	assert.Equal(t, int32(1), calls.Load(), "POST without an Idempotency-Key is sent once")
+
+	calls.Store(0)
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set(HeaderIdempotencyKey, "k1")
+	assert.NoError(t, handler(e.NewContext(req, rec)))
+	assert.Empty(t, rec.Header().Get(hedge.HeaderHedged))
+	assert.Equal(t, int32(1), calls.Load(), "POST with an Idempotency-Key is sent once")
+}
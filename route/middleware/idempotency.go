@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/idempotency"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// HeaderIdempotentReplayed marks a response served from the idempotency store
+const HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+const (
+	IdempotencyStoreMemory   = "memory"
+	IdempotencyStoreDatabase = "database"
+)
+
+// IdempotencyConfig are the parameters of the idempotency middleware
+type IdempotencyConfig struct {
+	TTL         util.Duration `json:"ttl"`           // How long a key and its response are kept
+	Lease       util.Duration `json:"lease"`         // How long a request in flight holds its key, at least until its deadline
+	Wait        util.Duration `json:"wait"`          // How long a duplicate waits for the first request to finish
+	Required    bool          `json:"required"`      // Reject requests without an Idempotency-Key
+	Store       string        `json:"store"`         // "memory" or "database"
+	MaxBodySize int64         `json:"max_body_size"` // Larger bodies are rejected rather than buffered
+}
+
+// idempotencyStoreTimeout bounds storing the outcome once the client may be gone
+const idempotencyStoreTimeout = 5 * time.Second
+
+// DefaultIdempotencyConfig keeps keys in memory for 24 hours
+func DefaultIdempotencyConfig() IdempotencyConfig {
+	return IdempotencyConfig{
+		TTL:         util.Duration(24 * time.Hour),
+		Lease:       util.Duration(time.Minute),
+		Wait:        util.Duration(10 * time.Second),
+		Store:       IdempotencyStoreMemory,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+func (c *IdempotencyConfig) Validate() error {
+	if c.TTL <= 0 {
+		return errors.New("ttl must be positive")
+	}
+	if c.Lease <= 0 || c.Lease > c.TTL {
+		return errors.New("lease must be positive and not above ttl")
+	}
+	if c.Wait <= 0 {
+		return errors.New("wait must be positive")
+	}
+	if c.Store != IdempotencyStoreMemory && c.Store != IdempotencyStoreDatabase {
+		return errors.New("store must be \"memory\" or \"database\"")
+	}
+	if c.MaxBodySize < 0 {
+		return errors.New("max_body_size must not be negative")
+	}
+	return nil
+}
+
+// IdempotencyMiddleware forwards the first request with an Idempotency-Key and stores its response.
+// Duplicates wait for the first request and get the stored response. Keys are scoped to the route.
+func IdempotencyMiddleware(config IdempotencyConfig, store idempotency.Store, scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			value := req.Header.Get(HeaderIdempotencyKey)
+			if value == "" {
+				if config.Required {
+					return echo.NewHTTPError(http.StatusBadRequest, HeaderIdempotencyKey+" header is required")
+				}
+				return next(c)
+			}
+
+			body, ok, err := bufferBody(req, config.MaxBodySize)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+			}
+			if !ok {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+			// Keys are only unique per client, so the caller is part of the key
+			key := scope + " " + value
+			if id := caller(c); id != "" {
+				key += "\nCaller: " + id
+			}
+			fingerprint := requestFingerprint(req, body)
+
+			// The key is only held for a short lease while the request is in flight, so a crashed
+			// instance does not block retries until the TTL runs out
+			lease := time.Duration(config.Lease)
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) > lease {
+				lease = time.Until(deadline)
+			}
+			existing, created, err := store.Begin(ctx, key, fingerprint, lease)
+			if err != nil {
+				// Fail open, a broken store must not take the route down
+				tracing.Error(ctx, "Idempotency", "Store unavailable, forwarding without idempotency: "+err.Error())
+				return next(c)
+			}
+
+			if !created {
+				if existing.Fingerprint != fingerprint {
+					return echo.NewHTTPError(http.StatusUnprocessableEntity, HeaderIdempotencyKey+" was already used with a different request")
+				}
+				if !existing.Completed {
+					tracing.Info(ctx, "Idempotency", "Waiting for the in-flight request with the same key")
+					waitCtx, cancel := context.WithTimeout(ctx, time.Duration(config.Wait))
+					existing, err = idempotency.Wait(waitCtx, store, key, 50*time.Millisecond)
+					cancel()
+					if errors.Is(err, idempotency.ErrNotFound) {
+						// The first request failed and released the key
+						return echo.NewHTTPError(http.StatusConflict, "The original request failed, retry with the same "+HeaderIdempotencyKey)
+					}
+					if err != nil {
+						return echo.NewHTTPError(http.StatusConflict, "A request with this "+HeaderIdempotencyKey+" is still in progress")
+					}
+				}
+				tracing.Info(ctx, "Idempotency", "Replaying stored response")
+				return replayRecord(c, existing)
+			}
+
+			writer := c.Response().Writer
+			rec := record(c.Response())
+			err = next(c)
+			restoreWriter(c.Response(), writer)
+
+			// Record the outcome even if the client went away or the route timed out, or the
+			// key would stay in progress until it expires
+			storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), idempotencyStoreTimeout)
+			defer cancel()
+
+			// Failures are not stored so the client can retry with the same key
+			if (err != nil && rec.body.Len() == 0) || rec.status >= http.StatusInternalServerError {
+				if releaseErr := store.Release(storeCtx, key); releaseErr != nil {
+					tracing.Error(ctx, "Idempotency", "Failed to release key: "+releaseErr.Error())
+				}
+			} else {
+				completed := &idempotency.Record{Key: key, Fingerprint: fingerprint, Status: rec.status, Header: rec.header, Body: rec.body.Bytes(), ExpiresAt: time.Now().Add(time.Duration(config.TTL))}
+				if completeErr := store.Complete(storeCtx, completed); completeErr != nil {
+					tracing.Error(ctx, "Idempotency", "Failed to store response: "+completeErr.Error())
+				}
+			}
+
+			return rec.finish(c.Response(), writer, err)
+		}
+	}
+}
+
+func requestFingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(req.Method + " " + req.URL.RequestURI() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func replayRecord(c echo.Context, record *idempotency.Record) error {
+	res := c.Response()
+	for k, v := range record.Header {
+		res.Header()[k] = v
+	}
+	res.Header().Set(HeaderIdempotentReplayed, strconv.FormatBool(true))
+	res.WriteHeader(record.Status)
+	_, err := res.Write(record.Body)
+	return err
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/idempotency"
+)
+
+func serveIdempotent(mw echo.MiddlewareFunc, h echo.HandlerFunc, key, body string) *httptest.ResponseRecorder {
+	e := echo.New()
+	req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if err := mw(h)(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	var calls int32
+	h := func(c echo.Context) error {
+		n := atomic.AddInt32(&calls, 1)
+		body, _ := io.ReadAll(c.Request().Body)
+		c.Response().Header().Set("X-Payment", "p1")
+		return c.String(http.StatusCreated, string(body)+":"+strconv.Itoa(int(n)))
+	}
+	mw := IdempotencyMiddleware(DefaultIdempotencyConfig(), idempotency.NewMemoryStore(), "POST /payments")
+
+	first := serveIdempotent(mw, h, "k1", "pay")
+	second := serveIdempotent(mw, h, "k1", "pay")
+
+	assert.Equal(t, int32(1), calls)
+	assert.Equal(t, http.StatusCreated, second.Code)
+	assert.Equal(t, first.Body.String(), second.Body.String())
+	assert.Equal(t, "p1", second.Header().Get("X-Payment"))
+	assert.Equal(t, "true", second.Header().Get(HeaderIdempotentReplayed))
+
+	mismatch := serveIdempotent(mw, h, "k1", "pay twice")
+	assert.Equal(t, http.StatusUnprocessableEntity, mismatch.Code)
+
+	// Requests without a key are forwarded as they are
+	serveIdempotent(mw, h, "", "pay")
+	assert.Equal(t, int32(2), calls)
+}
+
+func TestIdempotencyConcurrentDuplicatesWait(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	h := func(c echo.Context) error {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return c.String(http.StatusOK, "done")
+	}
+	mw := IdempotencyMiddleware(DefaultIdempotencyConfig(), idempotency.NewMemoryStore(), "POST /payments")
+
+	var wg sync.WaitGroup
+	results := make([]*httptest.ResponseRecorder, 3)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = serveIdempotent(mw, h, "k1", "pay")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls)
+	for _, rec := range results {
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "done", rec.Body.String())
+	}
+}
+
+func TestIdempotencyFailuresAreNotStored(t *testing.T) {
+	var calls int32
+	h := func(c echo.Context) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			return echo.NewHTTPError(http.StatusBadGateway, "upstream down")
+		}
+		return c.String(http.StatusOK, "done")
+	}
+	mw := IdempotencyMiddleware(DefaultIdempotencyConfig(), idempotency.NewMemoryStore(), "POST /payments")
+
+	assert.Equal(t, http.StatusBadGateway, serveIdempotent(mw, h, "k1", "pay").Code)
+	assert.Equal(t, http.StatusOK, serveIdempotent(mw, h, "k1", "pay").Code)
+	assert.Equal(t, int32(2), calls)
+}
+
+// cancelAwareStore fails like the database would on a cancelled context
+type cancelAwareStore struct {
+	*idempotency.MemoryStore
+}
+
+func (s cancelAwareStore) Complete(ctx context.Context, record *idempotency.Record) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Complete(ctx, record)
+}
+
+func (s cancelAwareStore) Release(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.MemoryStore.Release(ctx, key)
+}
+
+func TestIdempotencyOutcomeOutlivesClient(t *testing.T) {
+	store := cancelAwareStore{idempotency.NewMemoryStore()}
+	mw := IdempotencyMiddleware(DefaultIdempotencyConfig(), store, "POST /payments")
+
+	send := func(key string, h echo.HandlerFunc) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("pay")).WithContext(ctx)
+		req.Header.Set(HeaderIdempotencyKey, key)
+		c := echo.New().NewContext(req, httptest.NewRecorder())
+		mw(func(c echo.Context) error {
+			cancel() // The client goes away while the upstream call is in flight
+			return h(c)
+		})(c)
+	}
+
+	send("done", func(c echo.Context) error { return c.String(http.StatusCreated, "paid") })
+	record, err := store.Get(context.Background(), "POST /payments done")
+	if assert.NoError(t, err) {
+		assert.True(t, record.Completed)
+	}
+
+	send("failed", func(c echo.Context) error { return c.String(http.StatusBadGateway, "down") })
+	_, err = store.Get(context.Background(), "POST /payments failed")
+	assert.ErrorIs(t, err, idempotency.ErrNotFound)
+}
+
+func TestIdempotencyLease(t *testing.T) {
+	store := idempotency.NewMemoryStore()
+	config := DefaultIdempotencyConfig()
+	config.Lease = util.Duration(time.Minute)
+	mw := IdempotencyMiddleware(config, store, "POST /payments")
+
+	var claimed *idempotency.Record
+	serveIdempotent(mw, func(c echo.Context) error {
+		claimed, _ = store.Get(c.Request().Context(), "POST /payments k1")
+		return c.String(http.StatusCreated, "paid")
+	}, "k1", "pay")
+	if assert.NotNil(t, claimed) {
+		assert.WithinDuration(t, time.Now().Add(time.Minute), claimed.ExpiresAt, 5*time.Second)
+	}
+
+	record, err := store.Get(context.Background(), "POST /payments k1")
+	if assert.NoError(t, err) {
+		assert.WithinDuration(t, time.Now().Add(time.Duration(config.TTL)), record.ExpiresAt, 5*time.Second)
+	}
+}
+
+func TestIdempotencyKeysPerCaller(t *testing.T) {
+	mw := IdempotencyMiddleware(DefaultIdempotencyConfig(), idempotency.NewMemoryStore(), "POST /payments")
+	h := func(c echo.Context) error {
+		return c.String(http.StatusCreated, fmt.Sprint(c.Get(util.ContextJwtClaimKey).(map[string]interface{})["sub"]))
+	}
+	send := func(sub string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("pay"))
+		req.Header.Set(HeaderIdempotencyKey, "k1")
+		rec := httptest.NewRecorder()
+		c := echo.New().NewContext(req, rec)
+		c.Set(util.ContextJwtClaimKey, map[string]interface{}{"sub": sub})
+		mw(h)(c)
+		return rec
+	}
+
+	assert.Equal(t, "alice", send("alice").Body.String())
+	rec := send("bob")
+	assert.Equal(t, "bob", rec.Body.String())
+	assert.Empty(t, rec.Header().Get(HeaderIdempotentReplayed))
+	rec = send("alice")
+	assert.Equal(t, "alice", rec.Body.String())
+	assert.Equal(t, "true", rec.Header().Get(HeaderIdempotentReplayed))
+}
+
+func TestIdempotencyRejectsLargeBodies(t *testing.T) {
+	config := DefaultIdempotencyConfig()
+	config.MaxBodySize = 4
+	mw := IdempotencyMiddleware(config, idempotency.NewMemoryStore(), "POST /payments")
+	rec := serveIdempotent(mw, func(c echo.Context) error { return c.NoContent(http.StatusCreated) }, "k1", "too large")
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
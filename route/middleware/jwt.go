@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/jwt"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// JWTConfig are the parameters of the jwt middleware
+type JWTConfig struct {
+	Issuer     string        `json:"issuer"`      // Required "iss", any issuer if empty
+	Audience   []string      `json:"audience"`    // "aud" must contain one of these, any audience if empty
+	JWKS       string        `json:"jwks"`        // URL or file of a JSON Web Key Set
+	JWKSTTL    util.Duration `json:"jwks_ttl"`    // How long fetched keys are used before fetching them again
+	PublicKeys []string      `json:"public_keys"` // PEM encoded public keys or certificates
+	SecretEnv  string        `json:"secret_env"`  // Environment variable holding an HMAC secret
+	Leeway     util.Duration `json:"leeway"`      // Allowed clock skew for expiry and not-before
+	Optional   bool          `json:"optional"`    // Let requests without a token through, still rejecting invalid ones
+}
+
+// DefaultJWTConfig refreshes JWKS keys hourly and allows 30 seconds of clock skew
+func DefaultJWTConfig() JWTConfig {
+	return JWTConfig{
+		JWKSTTL: util.Duration(jwt.DefaultJWKSTTL),
+		Leeway:  util.Duration(30 * time.Second),
+	}
+}
+
+func (c *JWTConfig) Validate() error {
+	if c.JWKS == "" && len(c.PublicKeys) == 0 && c.SecretEnv == "" {
+		return errors.New("one of jwks, public_keys or secret_env is required")
+	}
+	for i, pem := range c.PublicKeys {
+		if _, err := jwt.ParsePublicKey([]byte(pem)); err != nil {
+			return fmt.Errorf("public_keys[%d]: %v", i, err)
+		}
+	}
+	if c.SecretEnv != "" && os.Getenv(c.SecretEnv) == "" {
+		return fmt.Errorf("secret_env %s is not set", c.SecretEnv)
+	}
+	if c.JWKSTTL <= 0 {
+		return errors.New("jwks_ttl must be positive")
+	}
+	if c.Leeway < 0 || time.Duration(c.Leeway) > jwt.MaxLeeway {
+		return fmt.Errorf("leeway must be between 0 and %s", jwt.MaxLeeway)
+	}
+	return nil
+}
+
+// verifier builds the token verifier from the configured key sources
+func (c *JWTConfig) verifier() *jwt.Verifier {
+	var static jwt.StaticKeys
+	for _, pem := range c.PublicKeys {
+		if key, err := jwt.ParsePublicKey([]byte(pem)); err == nil {
+			static = append(static, key)
+		}
+	}
+	if secret := os.Getenv(c.SecretEnv); c.SecretEnv != "" && secret != "" {
+		static = append(static, jwt.Key{Public: []byte(secret)})
+	}
+
+	keys := jwt.MultiKeySet{static}
+	if c.JWKS != "" {
+		keys = append(keys, jwt.JWKS(c.JWKS, time.Duration(c.JWKSTTL)))
+	}
+	return &jwt.Verifier{Keys: keys, Issuer: c.Issuer, Audience: c.Audience, Leeway: time.Duration(c.Leeway)}
+}
+
+// JWTMiddleware verifies the bearer token before the upstream is called and stores its claims
+// under util.ContextJwtClaimKey and the raw token under util.ContextTokenValueKey.
+// Missing, invalid and revoked tokens are rejected with 401.
+func JWTMiddleware(config JWTConfig, revoked revocation.Store) echo.MiddlewareFunc {
+	verifier := config.verifier()
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			token, ok := BearerToken(c.Request())
+			if !ok {
+				if config.Optional {
+					return next(c)
+				}
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "Missing bearer token")
+			}
+
+			claims, err := verifier.Verify(ctx, token)
+			if err != nil {
+				tracing.Warn(ctx, "JWT", "Rejected token: "+err.Error())
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token: "+err.Error())
+			}
+			isRevoked, err := revocation.IsRevoked(ctx, revoked, claims)
+			if err != nil {
+				tracing.Error(ctx, "JWT", "Cannot check revocation list: "+err.Error())
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Cannot verify token")
+			}
+			if isRevoked {
+				tracing.Warn(ctx, "JWT", fmt.Sprintf("Rejected revoked token of %v", claims["sub"]))
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid token: token revoked")
+			}
+
+			tracing.Info(ctx, "JWT", fmt.Sprintf("Verified token of %v", claims["sub"]))
+			c.Set(util.ContextJwtClaimKey, claims)
+			c.Set(util.ContextTokenValueKey, token)
+			return next(c)
+		}
+	}
+}
+
+// BearerToken reads the token of an "Authorization: Bearer" header
+func BearerToken(req *http.Request) (string, bool) {
+	auth := req.Header.Get(echo.HeaderAuthorization)
+	if len(auth) <= len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len("Bearer "):]), true
+}
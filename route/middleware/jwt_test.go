@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/jwt"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/revocation"
+)
+
+func hs256(secret, payload string) string {
+	input := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(input))
+	return input + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "s3cret")
+	config := DefaultJWTConfig()
+	config.SecretEnv = "TEST_JWT_SECRET"
+	assert.NoError(t, config.Validate())
+
+	// Revocations only outlive tokens by jwt.MaxLeeway
+	tooLong := config
+	tooLong.Leeway = util.Duration(jwt.MaxLeeway + time.Second)
+	assert.Error(t, tooLong.Validate())
+
+	called := false
+	handler := JWTMiddleware(config, revocation.NewMemoryStore())(func(c echo.Context) error {
+		called = true
+		claims := c.Get(util.ContextJwtClaimKey).(map[string]interface{})
+		return c.String(http.StatusOK, claims["sub"].(string))
+	})
+	e := echo.New()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer "+hs256("s3cret", `{"sub":"agent-1","exp":4102444800}`))
+	rec := httptest.NewRecorder()
+	assert.NoError(t, handler(e.NewContext(req, rec)))
+	assert.Equal(t, "agent-1", rec.Body.String())
+
+	for _, auth := range []string{"", "Bearer " + hs256("wrong", `{"sub":"agent-1","exp":4102444800}`), "Bearer " + hs256("s3cret", `{"sub":"agent-1","exp":946684800}`)} {
+		called = false
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, auth)
+		rec := httptest.NewRecorder()
+		err := handler(e.NewContext(req, rec))
+		if he, ok := err.(*echo.HTTPError); assert.True(t, ok, auth) {
+			assert.Equal(t, http.StatusUnauthorized, he.Code)
+		}
+		assert.False(t, called, "the upstream is not called")
+		assert.NotEmpty(t, rec.Header().Get(echo.HeaderWWWAuthenticate))
+	}
+}
+
+func TestJWTMiddlewareRevoked(t *testing.T) {
+	t.Setenv("TEST_JWT_SECRET", "s3cret")
+	config := DefaultJWTConfig()
+	config.SecretEnv = "TEST_JWT_SECRET"
+	store := revocation.NewMemoryStore()
+	handler := JWTMiddleware(config, store)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	e := echo.New()
+	serve := func(claims string) error {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+hs256("s3cret", claims))
+		return handler(e.NewContext(req, httptest.NewRecorder()))
+	}
+
+	token := `{"sub":"agent-1","jti":"t-1","sid":"s-1","exp":4102444800}`
+	sibling := `{"sub":"agent-1","jti":"t-2","sid":"s-1","exp":4102444800}`
+	assert.NoError(t, serve(token))
+
+	require.NoError(t, store.Revoke(context.Background(), revocation.Entry{Kind: revocation.KindToken, Value: "t-1", ExpiresAt: time.Now().Add(time.Hour)}))
+	if he, ok := serve(token).(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusUnauthorized, he.Code)
+	}
+	assert.NoError(t, serve(sibling), "other tokens of the session still work")
+
+	require.NoError(t, store.Revoke(context.Background(), revocation.Entry{Kind: revocation.KindSession, Value: "s-1", ExpiresAt: time.Now().Add(time.Hour)}))
+	assert.Error(t, serve(sibling))
+}
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -28,6 +29,32 @@ func MetricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 
 		metrics.Record(service, path, status, duration)
 
+		// The error handler has not written the response yet, so take the status from the error
+		if he, ok := err.(*echo.HTTPError); ok {
+			status = he.Code
+		} else if ae, ok := err.(util.AppError); ok {
+			status = ae.HTTPStatus()
+		} else if err != nil {
+			status = http.StatusInternalServerError
+		}
+		if consumer, ok := c.Get(util.ContextConsumerKey).(string); ok {
+			metrics.RecordConsumer(consumer, status)
+		}
+		if observers, ok := c.Get(util.ContextLatencyObserverKey).([]LatencyObserver); ok {
+			for _, observe := range observers {
+				observe(duration, status)
+			}
+		}
+
 		return err
 	}
 }
+
+// LatencyObserver is told the duration and status of a request once it is done
+type LatencyObserver func(latency time.Duration, status int)
+
+// ObserveLatency registers fn to be called by MetricsMiddleware with the measured latency
+func ObserveLatency(c echo.Context, fn LatencyObserver) {
+	observers, _ := c.Get(util.ContextLatencyObserverKey).([]LatencyObserver)
+	c.Set(util.ContextLatencyObserverKey, append(observers, fn))
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// responseRecorder holds a response in memory so it can be discarded or replayed
+type responseRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (r *responseRecorder) Header() http.Header {
+	return r.header
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	return r.body.Write(b)
+}
+
+// Flush is a no-op, the response is only sent once it is complete
+func (r *responseRecorder) Flush() {}
+
+// record points the echo response at a fresh recorder and returns it
+func record(res *echo.Response) *responseRecorder {
+	rec := newResponseRecorder()
+	res.Writer = rec
+	res.Committed = false
+	res.Status = http.StatusOK
+	res.Size = 0
+	return rec
+}
+
+// restoreWriter points the echo response back at w, discarding what was recorded
+func restoreWriter(res *echo.Response, w http.ResponseWriter) {
+	res.Writer = w
+	res.Committed = false
+	res.Status = http.StatusOK
+	res.Size = 0
+}
+
+// replay writes a recorded response to w through the echo response
+func (r *responseRecorder) replay(res *echo.Response, w http.ResponseWriter) error {
+	res.Writer = w
+	for k, v := range r.header {
+		res.Header()[k] = v
+	}
+	res.WriteHeader(r.status)
+	_, err := res.Write(r.body.Bytes())
+	return err
+}
+
+// finish sends the recorded response to w, or leaves an error without a response to the error handler
+func (r *responseRecorder) finish(res *echo.Response, w http.ResponseWriter, err error) error {
+	if err != nil && r.body.Len() == 0 {
+		return err
+	}
+	if replayErr := r.replay(res, w); replayErr != nil {
+		return replayErr
+	}
+	return err
+}
@@ -2,113 +2,129 @@ package middleware
 
 import (
 	"context"
+	"errors"
 	"net/http"
-	"sync"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/deadline"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
 )
 
+// DefaultDeadlineHeader carries the time left for a REST upstream to answer, in milliseconds
+const DefaultDeadlineHeader = "X-Request-Deadline"
+
+// TimeoutConfig are the parameters of the timeout middleware
+type TimeoutConfig struct {
+	Duration       util.Duration `json:"duration"`
+	DeadlineHeader string        `json:"deadline_header"` // Header that tells REST upstreams the time left, empty to not send it
+}
+
+func (c *TimeoutConfig) Validate() error {
+	if c.Duration <= 0 {
+		return errors.New("duration must be positive")
+	}
+	return nil
+}
+
 // TimeoutMiddleware sets a context timeout for the request
 func TimeoutMiddleware(timeout time.Duration) echo.MiddlewareFunc {
+	return TimeoutWithConfig(TimeoutConfig{Duration: util.Duration(timeout), DeadlineHeader: DefaultDeadlineHeader})
+}
+
+// TimeoutWithConfig gives the request a deadline. The handler runs on the request goroutine and
+// the upstream calls it makes are cancelled with the request context, so nothing writes to the
+// response after the middleware returns. gRPC calls forward the deadline as grpc-timeout,
+// REST calls made through deadline.Transport in the configured header.
+func TimeoutWithConfig(config TimeoutConfig) echo.MiddlewareFunc {
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			ctx, cancel := context.WithTimeout(c.Request().Context(), timeout)
+			req := c.Request()
+			ctx, cancel := context.WithTimeout(req.Context(), time.Duration(config.Duration))
 			defer cancel()
+			if config.DeadlineHeader != "" {
+				ctx = deadline.WithHeader(ctx, config.DeadlineHeader)
+			}
 
-			c.SetRequest(c.Request().WithContext(ctx))
-
-			done := make(chan error, 1)
-			go func() {
-				done <- next(c)
-			}()
+			c.SetRequest(req.WithContext(ctx))
+			defer c.SetRequest(req)
 
-			select {
-			case err := <-done:
-				return err
-			case <-ctx.Done():
+			err := next(c)
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) && !c.Response().Committed {
+				tracing.Warn(ctx, "Timeout", "Upstream did not answer within "+time.Duration(config.Duration).String())
 				return echo.NewHTTPError(http.StatusGatewayTimeout, "Gateway Timeout")
 			}
+			return err
 		}
 	}
 }
 
-// RetryMiddleware retries the request if it fails with a 5xx error
-func RetryMiddleware(maxRetries int) echo.MiddlewareFunc {
+// CircuitBreakerMiddleware rejects requests while the breaker for key is open and
+// records the outcome of every request it lets through
+func CircuitBreakerMiddleware(key string, policy breaker.Policy) echo.MiddlewareFunc {
+	cb := breaker.Default.Get(key, policy)
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			var err error
-			for i := 0; i < maxRetries; i++ {
-				err = next(c)
-				if err == nil {
-					return nil
-				}
-
-				// Only retry on server errors or timeouts
-				he, ok := err.(*echo.HTTPError)
-				if ok && he.Code < 500 && he.Code != http.StatusRequestTimeout {
-					return err
+			done, err := cb.Allow()
+			if err != nil {
+				var maintenance *breaker.MaintenanceError
+				if errors.As(err, &maintenance) {
+					return breaker.RejectionError(err)
 				}
-
-				// Wait before retry
-				time.Sleep(time.Duration(i*100) * time.Millisecond)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Circuit breaker open for route: "+c.Path())
 			}
+
+			err = next(c)
+			done(!breaker.IsFailure(err) && c.Response().Status < http.StatusInternalServerError)
 			return err
 		}
 	}
 }
 
-// Simple Circuit Breaker
-type circuitBreaker struct {
-	failures     int
-	threshold    int
-	lastFailure  time.Time
-	resetTimeout time.Duration
-	mu           sync.RWMutex
-}
-
-var breakers = make(map[string]*circuitBreaker)
-var breakersMu sync.RWMutex
-
-func getBreaker(service string) *circuitBreaker {
-	breakersMu.Lock()
-	defer breakersMu.Unlock()
-
-	if _, ok := breakers[service]; !ok {
-		breakers[service] = &circuitBreaker{
-			threshold:    5,
-			resetTimeout: 30 * time.Second,
+// BulkheadMiddleware bounds the concurrent requests sharing the bulkhead of key. Requests
+// that find the bulkhead and its queue full, or time out in the queue, get a 503.
+func BulkheadMiddleware(key string, policy bulkhead.Policy) echo.MiddlewareFunc {
+	b := bulkhead.Default.Get(key, policy)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			release, err := b.Acquire(ctx)
+			if err != nil {
+				tracing.Warn(ctx, "Bulkhead", "Rejected by bulkhead "+key+": "+err.Error())
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Service busy, please try again")
+			}
+			defer release()
+			return next(c)
 		}
 	}
-	return breakers[service]
 }
 
-func CircuitBreakerMiddleware(service string) echo.MiddlewareFunc {
-	cb := getBreaker(service)
+// AdaptiveConcurrencyMiddleware sheds requests beyond the concurrency the limiter of key
+// currently allows, low priorities first. The limiter learns from the latency measured by
+// MetricsMiddleware. The priority is the authenticated consumer's. The policy's priority
+// header, if it names one, is only trusted from authenticated consumers without a priority
+// of their own, so anonymous clients cannot jump the queue.
+func AdaptiveConcurrencyMiddleware(key string, policy adaptive.Policy) echo.MiddlewareFunc {
+	l := adaptive.Default.Get(key, policy)
 	return func(next echo.HandlerFunc) echo.HandlerFunc {
 		return func(c echo.Context) error {
-			cb.mu.RLock()
-			if cb.failures >= cb.threshold && time.Since(cb.lastFailure) < cb.resetTimeout {
-				cb.mu.RUnlock()
-				return echo.NewHTTPError(http.StatusServiceUnavailable, "Circuit breaker open for service: "+service)
+			priority, _ := c.Get(util.ContextPriorityKey).(string)
+			if consumer, _ := c.Get(util.ContextConsumerKey).(string); priority == "" && consumer != "" && policy.PriorityHeader != "" {
+				priority = c.Request().Header.Get(policy.PriorityHeader)
 			}
-			cb.mu.RUnlock()
-
-			err := next(c)
 
-			cb.mu.Lock()
-			defer cb.mu.Unlock()
-			if err != nil {
-				he, ok := err.(*echo.HTTPError)
-				if ok && he.Code >= 500 {
-					cb.failures++
-					cb.lastFailure = time.Now()
-				}
-			} else {
-				cb.failures = 0
+			release, ok := l.Acquire(priority)
+			if !ok {
+				tracing.Warn(c.Request().Context(), "Adaptive", "Shed "+priority+" priority request by concurrency limit of "+key)
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Service busy, please try again")
 			}
-
-			return err
+			defer release()
+			ObserveLatency(c, l.Observe)
+			return next(c)
 		}
 	}
 }
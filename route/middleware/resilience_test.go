@@ -0,0 +1,154 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/deadline"
+)
+
+func TestTimeoutCancelsUpstream(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil)
+	c := e.NewContext(req, rec)
+
+	upstreamCancelled := false
+	slow := func(c echo.Context) error {
+		select {
+		case <-c.Request().Context().Done():
+			upstreamCancelled = true
+			return echo.NewHTTPError(http.StatusBadGateway, "upstream cancelled")
+		case <-time.After(time.Second):
+			return c.String(http.StatusOK, "too late")
+		}
+	}
+
+	config := TimeoutConfig{Duration: util.Duration(20 * time.Millisecond)}
+	err := TimeoutWithConfig(config)(slow)(c)
+
+	assert.True(t, upstreamCancelled)
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusGatewayTimeout, he.Code)
+	}
+	assert.Same(t, req, c.Request(), "the original request is restored")
+	assert.False(t, c.Response().Committed)
+}
+
+func TestTimeoutForwardsDeadline(t *testing.T) {
+	var forwarded string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = r.Header.Get(DefaultDeadlineHeader)
+	}))
+	defer upstream.Close()
+
+	e := echo.New()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	call := func(c echo.Context) error {
+		req, _ := http.NewRequestWithContext(c.Request().Context(), http.MethodGet, upstream.URL, nil)
+		client := &http.Client{Transport: &deadline.Transport{Next: http.DefaultTransport}}
+		res, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		res.Body.Close()
+		return c.NoContent(http.StatusOK)
+	}
+
+	assert.NoError(t, TimeoutMiddleware(2*time.Second)(call)(c))
+	ms, err := strconv.Atoi(forwarded)
+	if assert.NoError(t, err) {
+		assert.True(t, ms > 1000 && ms <= 2000, "forwarded %dms", ms)
+	}
+}
+
+func TestBulkheadRejectsWhenFull(t *testing.T) {
+	e := echo.New()
+	block := make(chan struct{})
+	handler := BulkheadMiddleware("test:bulkhead", bulkhead.Policy{MaxConcurrent: 1})(func(c echo.Context) error {
+		<-block
+		return c.String(http.StatusOK, "ok")
+	})
+
+	done := make(chan error)
+	go func() {
+		done <- handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	}()
+	b, _ := bulkhead.Default.Lookup("test:bulkhead")
+	assert.Eventually(t, func() bool { return b.Stats().InFlight == 1 }, time.Second, time.Millisecond)
+
+	err := handler(e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder()))
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusServiceUnavailable, he.Code)
+	}
+
+	close(block)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 0, b.Stats().InFlight)
+}
+
+func TestAdaptiveConcurrencyLearnsFromMetrics(t *testing.T) {
+	e := echo.New()
+	policy := adaptive.DefaultPolicy()
+	policy.InitialLimit = 10
+	handler := MetricsMiddleware(AdaptiveConcurrencyMiddleware("test:adaptive", policy)(func(c echo.Context) error {
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "Gateway Timeout")
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Error(t, handler(e.NewContext(req, httptest.NewRecorder())))
+
+	l, _ := adaptive.Default.Lookup("test:adaptive")
+	assert.Equal(t, adaptive.Stats{Key: "test:adaptive", Limit: 9}, l.Stats())
+}
+
+func TestAdaptivePriorityOnlyFromConsumers(t *testing.T) {
+	e := echo.New()
+	policy := adaptive.DefaultPolicy()
+	policy.InitialLimit = 10
+	policy.PriorityHeader = "X-Priority"
+	key := "test:adaptive-priority"
+	handler := AdaptiveConcurrencyMiddleware(key, policy)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+
+	// Nine of ten slots taken leaves room for high priority requests only
+	l := adaptive.Default.Get(key, policy)
+	for i := 0; i < 9; i++ {
+		release, ok := l.Acquire(adaptive.PriorityHigh)
+		assert.True(t, ok)
+		defer release()
+	}
+
+	serve := func(consumer, priority, header string) error {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Priority", header)
+		c := e.NewContext(req, httptest.NewRecorder())
+		if consumer != "" {
+			c.Set(util.ContextConsumerKey, consumer)
+		}
+		if priority != "" {
+			c.Set(util.ContextPriorityKey, priority)
+		}
+		return handler(c)
+	}
+
+	assert.Error(t, serve("", "", adaptive.PriorityHigh), "anonymous clients cannot claim a priority")
+	assert.NoError(t, serve("acme", "", adaptive.PriorityHigh))
+	assert.NoError(t, serve("acme", adaptive.PriorityHigh, ""))
+	assert.Error(t, serve("acme", adaptive.PriorityLow, adaptive.PriorityHigh), "the consumer's priority wins")
+
+	policy.PriorityHeader = ""
+	handler = AdaptiveConcurrencyMiddleware(key, policy)(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	assert.Error(t, serve("acme", "", adaptive.PriorityHigh), "the header is opt-in")
+}
@@ -0,0 +1,218 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+const (
+	// HeaderIdempotencyKey marks a request as safe to repeat
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderAttempts reports how many times the gateway called the upstream
+	HeaderAttempts = "X-Gateway-Attempts"
+)
+
+// RetryConfig are the parameters of the retry middleware
+type RetryConfig struct {
+	Attempts      int           `json:"attempts"`
+	On            []int         `json:"on"`             // Status codes to retry on, defaults to 5xx and 408
+	Backoff       util.Duration `json:"backoff"`        // Base delay, doubled after every attempt and jittered
+	MaxBackoff    util.Duration `json:"max_backoff"`    // Upper bound of a single delay
+	Budget        util.Duration `json:"budget"`         // Overall time for all attempts and delays
+	MaxBodySize   int64         `json:"max_body_size"`  // Requests with larger bodies are sent once
+	NonIdempotent bool          `json:"non_idempotent"` // Also retry POST and PATCH without an Idempotency-Key
+}
+
+// DefaultRetryConfig makes 3 attempts within 10 seconds
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		Attempts:    3,
+		Backoff:     util.Duration(100 * time.Millisecond),
+		MaxBackoff:  util.Duration(2 * time.Second),
+		Budget:      util.Duration(10 * time.Second),
+		MaxBodySize: 1 << 20,
+	}
+}
+
+func (c *RetryConfig) Validate() error {
+	if c.Attempts < 1 {
+		return errors.New("attempts must be at least 1")
+	}
+	for _, code := range c.On {
+		if code < 400 || code > 599 {
+			return fmt.Errorf("cannot retry on status %d", code)
+		}
+	}
+	if c.Backoff < 0 || c.MaxBackoff < c.Backoff {
+		return errors.New("backoff must not be negative or larger than max_backoff")
+	}
+	if c.Budget <= 0 {
+		return errors.New("budget must be positive")
+	}
+	if c.MaxBodySize < 0 {
+		return errors.New("max_body_size must not be negative")
+	}
+	return nil
+}
+
+func (c *RetryConfig) retryable(code int) bool {
+	if len(c.On) == 0 {
+		return code >= 500 || code == http.StatusRequestTimeout
+	}
+	for _, v := range c.On {
+		if v == code {
+			return true
+		}
+	}
+	return false
+}
+
+// repeatable reports whether the request may be sent more than once
+func (c *RetryConfig) repeatable(req *http.Request) bool {
+	return repeatable(req, c.NonIdempotent)
+}
+
+// repeatable reports whether the request is idempotent, marked with an Idempotency-Key
+// or configured to be sent more than once anyway
+func repeatable(req *http.Request, nonIdempotent bool) bool {
+	return idempotentMethod(req.Method) || nonIdempotent || req.Header.Get(HeaderIdempotencyKey) != ""
+}
+
+// idempotentMethod reports whether requests with method have the same effect when sent twice
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// delay is the jittered exponential backoff before the given retry, counting from 1
+func (c *RetryConfig) delay(retry int) time.Duration {
+	d := time.Duration(c.Backoff) << (retry - 1)
+	if d > time.Duration(c.MaxBackoff) || d <= 0 {
+		d = time.Duration(c.MaxBackoff)
+	}
+	if d == 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// RetryMiddleware retries the request if it fails with a 5xx error
+func RetryMiddleware(maxRetries int) echo.MiddlewareFunc {
+	config := DefaultRetryConfig()
+	config.Attempts = maxRetries
+	return RetryWithConfig(config)
+}
+
+// RetryWithConfig retries the request while it fails with one of the configured status codes.
+// The request body is buffered so every attempt sends it again, and each attempt writes
+// to a recorder so only the final response reaches the client. Attempts run under the
+// budget's deadline, so a slow attempt is cancelled once the budget is spent.
+func RetryWithConfig(config RetryConfig) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			if config.Attempts < 2 || !config.repeatable(req) {
+				c.Response().Header().Set(HeaderAttempts, "1")
+				return next(c)
+			}
+
+			body, ok, err := bufferBody(req, config.MaxBodySize)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+			}
+			if !ok {
+				tracing.Info(req.Context(), "Retry", "Request body exceeds retry limit, sending once")
+				c.Response().Header().Set(HeaderAttempts, "1")
+				return next(c)
+			}
+
+			ctx := req.Context()
+			deadline := time.Now().Add(time.Duration(config.Budget))
+			budgetCtx, cancel := context.WithDeadline(ctx, deadline)
+			defer cancel()
+			c.SetRequest(req.WithContext(budgetCtx))
+			defer c.SetRequest(req)
+			writer := c.Response().Writer
+
+			var rec *responseRecorder
+			attempt := 0
+			for {
+				attempt++
+				c.Request().Body = io.NopCloser(bytes.NewReader(body))
+				rec = record(c.Response())
+				err = next(c)
+
+				code := rec.status
+				if he, ok := err.(*echo.HTTPError); ok {
+					code = he.Code
+				} else if err != nil {
+					code = http.StatusInternalServerError
+				}
+				if !config.retryable(code) {
+					break
+				}
+				if attempt >= config.Attempts {
+					tracing.Warn(ctx, "Retry", fmt.Sprintf("Attempt %d/%d failed with %d, giving up", attempt, config.Attempts, code))
+					break
+				}
+
+				wait := config.delay(attempt)
+				if time.Now().Add(wait).After(deadline) {
+					tracing.Warn(ctx, "Retry", fmt.Sprintf("Attempt %d/%d failed with %d, retry budget exhausted", attempt, config.Attempts, code))
+					break
+				}
+				tracing.Info(ctx, "Retry", fmt.Sprintf("Attempt %d/%d failed with %d, retrying in %s", attempt, config.Attempts, code, wait))
+
+				select {
+				case <-time.After(wait):
+				case <-ctx.Done():
+					restoreWriter(c.Response(), writer)
+					c.Response().Header().Set(HeaderAttempts, strconv.Itoa(attempt))
+					return echo.NewHTTPError(http.StatusRequestTimeout, "Request cancelled while retrying")
+				}
+			}
+
+			restoreWriter(c.Response(), writer)
+			c.Response().Header().Set(HeaderAttempts, strconv.Itoa(attempt))
+			if attempt > 1 {
+				tracing.Info(ctx, "Retry", fmt.Sprintf("Finished after %d attempts", attempt))
+			}
+			return rec.finish(c.Response(), writer, err)
+		}
+	}
+}
+
+// bufferBody reads the request body into memory if it is at most limit bytes. A larger
+// body is left readable on the request and ok is false.
+func bufferBody(req *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	return body, true, nil
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func testRetryConfig() RetryConfig {
+	config := DefaultRetryConfig()
+	config.Backoff = util.Duration(time.Millisecond)
+	config.MaxBackoff = util.Duration(time.Millisecond)
+	return config
+}
+
+// flakyUpstream fails with 502 until the given attempt and records every body it received
+func flakyUpstream(succeedOn int, bodies *[]string) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		body, _ := io.ReadAll(c.Request().Body)
+		*bodies = append(*bodies, string(body))
+		if len(*bodies) < succeedOn {
+			return c.String(http.StatusBadGateway, "upstream down")
+		}
+		return c.String(http.StatusOK, "ok:"+string(body))
+	}
+}
+
+func serveRetry(config RetryConfig, h echo.HandlerFunc, req *http.Request) *httptest.ResponseRecorder {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(req, rec)
+	if err := RetryWithConfig(config)(h)(c); err != nil {
+		e.HTTPErrorHandler(err, c)
+	}
+	return rec
+}
+
+func TestRetryReplaysBody(t *testing.T) {
+	var bodies []string
+	req := httptest.NewRequest(http.MethodPut, "/accounts/1", strings.NewReader(`{"name":"a"}`))
+
+	rec := serveRetry(testRetryConfig(), flakyUpstream(3, &bodies), req)
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `ok:{"name":"a"}`, rec.Body.String())
+	assert.Equal(t, "3", rec.Header().Get(HeaderAttempts))
+	assert.Equal(t, []string{`{"name":"a"}`, `{"name":"a"}`, `{"name":"a"}`}, bodies)
+}
+
+func TestRetryGivesUpWithLastResponse(t *testing.T) {
+	var bodies []string
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+
+	rec := serveRetry(testRetryConfig(), flakyUpstream(10, &bodies), req)
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "upstream down", rec.Body.String())
+	assert.Equal(t, "3", rec.Header().Get(HeaderAttempts))
+	assert.Len(t, bodies, 3)
+}
+
+func TestRetryOnlyRepeatsIdempotentRequests(t *testing.T) {
+	var bodies []string
+	req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("pay"))
+	rec := serveRetry(testRetryConfig(), flakyUpstream(2, &bodies), req)
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "1", rec.Header().Get(HeaderAttempts))
+
+	bodies = nil
+	req = httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader("pay"))
+	req.Header.Set(HeaderIdempotencyKey, "k1")
+	rec = serveRetry(testRetryConfig(), flakyUpstream(2, &bodies), req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderAttempts))
+}
+
+func TestRetryStopsAtBudget(t *testing.T) {
+	config := testRetryConfig()
+	config.Attempts = 10
+	config.Backoff = util.Duration(20 * time.Millisecond)
+	config.MaxBackoff = util.Duration(20 * time.Millisecond)
+	config.Budget = util.Duration(50 * time.Millisecond)
+
+	var bodies []string
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	rec := serveRetry(config, flakyUpstream(100, &bodies), req)
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Less(t, len(bodies), 10)
+}
+
+func TestRetryBudgetCancelsSlowAttempt(t *testing.T) {
+	config := testRetryConfig()
+	config.Budget = util.Duration(50 * time.Millisecond)
+
+	attempts := 0
+	slow := func(c echo.Context) error {
+		attempts++
+		select {
+		case <-c.Request().Context().Done():
+			return echo.NewHTTPError(http.StatusGatewayTimeout, "Gateway Timeout")
+		case <-time.After(time.Second):
+			return c.String(http.StatusOK, "too late")
+		}
+	}
+
+	start := time.Now()
+	req := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+	rec := serveRetry(config, slow, req)
+
+	assert.Equal(t, http.StatusGatewayTimeout, rec.Code)
+	assert.Equal(t, 1, attempts)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestRetryLargeBodySentOnce(t *testing.T) {
+	config := testRetryConfig()
+	config.MaxBodySize = 4
+
+	var bodies []string
+	req := httptest.NewRequest(http.MethodPut, "/files", strings.NewReader("too large"))
+	rec := serveRetry(config, flakyUpstream(2, &bodies), req)
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, []string{"too large"}, bodies)
+}
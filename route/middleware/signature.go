@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// Error codes of rejected signed requests, so partners can tell the failures apart
+const (
+	CodeSignatureMissing  = "022"
+	CodeSignatureClient   = "023"
+	CodeSignatureInvalid  = "024"
+	CodeSignatureExpired  = "025"
+	CodeSignatureReplayed = "026"
+)
+
+// SignatureConfig are the parameters of the signature middleware
+type SignatureConfig struct {
+	Headers     []string      `json:"headers"`       // Request headers covered by the signature, in order
+	Tolerance   util.Duration `json:"tolerance"`     // How far the timestamp may be from the gateway's clock
+	MaxBodySize int64         `json:"max_body_size"` // Larger bodies are rejected rather than buffered
+	Scopes      []string      `json:"scopes"`        // The consumer must have all of these
+}
+
+// DefaultSignatureConfig accepts timestamps within 5 minutes and bodies up to 1 MB
+func DefaultSignatureConfig() SignatureConfig {
+	return SignatureConfig{
+		Tolerance:   util.Duration(signature.DefaultTolerance),
+		MaxBodySize: 1 << 20,
+	}
+}
+
+func (c *SignatureConfig) Validate() error {
+	if c.Tolerance <= 0 {
+		return errors.New("tolerance must be positive")
+	}
+	if c.MaxBodySize < 0 {
+		return errors.New("max_body_size must not be negative")
+	}
+	return nil
+}
+
+// SecretSource returns the consumer a client ID names and its signing secret
+type SecretSource interface {
+	SigningSecret(ctx context.Context, client string) (consumer.Identity, []byte, error)
+}
+
+// SignatureMiddleware verifies the HMAC-SHA256 signature of the request with the secret of the
+// client named in X-Client-Id. Timestamps outside the tolerance and nonces seen before are
+// rejected. Each failure has its own error code, all with status 401. Like the api-key
+// middleware, consumers lacking a scope or not allowed on the route are rejected with 403.
+func SignatureMiddleware(config SignatureConfig, method, path, tag string, secrets SecretSource, nonces signature.NonceStore) echo.MiddlewareFunc {
+	tolerance := time.Duration(config.Tolerance)
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			req := c.Request()
+			ctx := req.Context()
+			client := req.Header.Get(signature.HeaderClientID)
+			sig := req.Header.Get(signature.HeaderSignature)
+			if client == "" || sig == "" {
+				return reject(ctx, CodeSignatureMissing, signature.ErrMissing)
+			}
+
+			body, ok, err := bufferBody(req, config.MaxBodySize)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body")
+			}
+			if !ok {
+				return echo.NewHTTPError(http.StatusRequestEntityTooLarge, "Request body too large to verify")
+			}
+			req.Body = io.NopCloser(bytes.NewReader(body))
+
+			signed := signature.FromHTTP(req, body, config.Headers)
+			now := time.Now()
+			if err := signature.CheckTimestamp(signed, now, tolerance); err != nil {
+				if errors.Is(err, signature.ErrMissing) {
+					return reject(ctx, CodeSignatureMissing, err)
+				}
+				return reject(ctx, CodeSignatureExpired, err)
+			}
+
+			identity, secret, err := secrets.SigningSecret(ctx, client)
+			if err != nil {
+				if errors.Is(err, consumer.ErrInvalidKey) || errors.Is(err, consumer.ErrDisabled) {
+					return reject(ctx, CodeSignatureClient, signature.ErrUnknownClient)
+				}
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Cannot verify signature")
+			}
+			if err := signature.Verify(secret, signed, sig); err != nil {
+				return reject(ctx, CodeSignatureInvalid, err)
+			}
+
+			// Only verified requests use up their nonce, so forged ones cannot block a real one
+			fresh, err := nonces.Use(ctx, client+":"+signed.Nonce, now.Add(2*tolerance))
+			if err != nil {
+				tracing.Error(ctx, "Signature", "Cannot record nonce: "+err.Error())
+				return echo.NewHTTPError(http.StatusServiceUnavailable, "Cannot verify signature")
+			}
+			if !fresh {
+				return reject(ctx, CodeSignatureReplayed, signature.ErrReplay)
+			}
+			c.Set(util.ContextConsumerKey, identity.Consumer)
+			if identity.Priority != "" {
+				c.Set(util.ContextPriorityKey, identity.Priority)
+			}
+
+			if !identity.HasScopes(config.Scopes) {
+				tracing.Warn(ctx, "Signature", fmt.Sprintf("Consumer %s lacks scopes %v", identity.Consumer, config.Scopes))
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+			if !identity.AllowsRoute(method, path, tag) {
+				tracing.Warn(ctx, "Signature", fmt.Sprintf("Consumer %s is not allowed on %s %s", identity.Consumer, method, path))
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+
+			tracing.Info(ctx, "Signature", "Verified request of "+identity.Consumer)
+			return next(c)
+		}
+	}
+}
+
+func reject(ctx context.Context, code string, err error) error {
+	tracing.Warn(ctx, "Signature", "Rejected request: "+err.Error())
+	return util.NewGenericException(code, "Invalid signature: "+err.Error(), http.StatusUnauthorized)
+}
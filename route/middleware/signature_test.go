@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/consumer"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
+)
+
+// stubSecrets hands every client the secret "s3cret" and its identity in the map
+type stubSecrets map[string]consumer.Identity
+
+func (s stubSecrets) SigningSecret(ctx context.Context, client string) (consumer.Identity, []byte, error) {
+	if identity, ok := s[client]; ok {
+		return identity, []byte("s3cret"), nil
+	}
+	return consumer.Identity{}, nil, consumer.ErrInvalidKey
+}
+
+func TestSignatureMiddleware(t *testing.T) {
+	config := DefaultSignatureConfig()
+	config.Headers = []string{"X-Account-Number"}
+	config.Scopes = []string{"payments"}
+	secrets := stubSecrets{
+		"acme":    {Consumer: "acme", Scopes: []string{"payments"}},
+		"reports": {Consumer: "reports", Scopes: []string{"reports"}},
+		"other":   {Consumer: "other", Scopes: []string{"payments"}, AllowedRoutes: []string{"GET /api/balance"}},
+	}
+
+	e := echo.New()
+	var upstreamBody string
+	nonces := signature.NewMemoryStore(100)
+	h := SignatureMiddleware(config, http.MethodPost, "/api/pay", "pay", secrets, nonces)(func(c echo.Context) error {
+		b := make([]byte, 64)
+		n, _ := c.Request().Body.Read(b)
+		upstreamBody = string(b[:n])
+		return c.String(http.StatusOK, c.Get(util.ContextConsumerKey).(string))
+	})
+
+	signed := func(client, secret, nonce string, at time.Time, body string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/api/pay", strings.NewReader(body))
+		req.Header.Set(signature.HeaderClientID, client)
+		req.Header.Set(signature.HeaderTimestamp, strconv.FormatInt(at.Unix(), 10))
+		req.Header.Set(signature.HeaderNonce, nonce)
+		req.Header.Set("X-Account-Number", "123")
+		req.Header.Set(signature.HeaderSignature, signature.Sign([]byte(secret), signature.FromHTTP(req, []byte(body), config.Headers)))
+		return req
+	}
+	serve := func(req *http.Request) (int, string) {
+		rec := httptest.NewRecorder()
+		err := h(e.NewContext(req, rec))
+		if ae, ok := err.(util.AppError); ok {
+			return ae.HTTPStatus(), ae.Code().(string)
+		}
+		if he, ok := err.(*echo.HTTPError); ok {
+			return he.Code, ""
+		}
+		require.NoError(t, err)
+		return rec.Code, rec.Body.String()
+	}
+
+	now := time.Now()
+	status, body := serve(signed("acme", "s3cret", "n-1", now, `{"amount":10}`))
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "acme", body)
+	assert.Equal(t, `{"amount":10}`, upstreamBody, "the upstream still gets the body")
+
+	_, code := serve(signed("acme", "s3cret", "n-1", now, `{"amount":10}`))
+	assert.Equal(t, CodeSignatureReplayed, code)
+
+	_, code = serve(httptest.NewRequest(http.MethodPost, "/api/pay", nil))
+	assert.Equal(t, CodeSignatureMissing, code)
+
+	_, code = serve(signed("nobody", "s3cret", "n-2", now, ""))
+	assert.Equal(t, CodeSignatureClient, code)
+
+	_, code = serve(signed("acme", "wrong", "n-3", now, ""))
+	assert.Equal(t, CodeSignatureInvalid, code)
+
+	req := signed("acme", "s3cret", "n-4", now, "")
+	req.Header.Set("X-Account-Number", "456")
+	status, code = serve(req)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, CodeSignatureInvalid, code)
+
+	_, code = serve(signed("acme", "s3cret", "n-5", now.Add(-10*time.Minute), ""))
+	assert.Equal(t, CodeSignatureExpired, code)
+
+	// Rejected requests do not use up their nonce
+	status, _ = serve(signed("acme", "s3cret", "n-3", now, ""))
+	assert.Equal(t, http.StatusOK, status)
+
+	// Consumers are held to their scopes and allowed routes
+	status, _ = serve(signed("reports", "s3cret", "n-6", now, ""))
+	assert.Equal(t, http.StatusForbidden, status)
+	status, _ = serve(signed("other", "s3cret", "n-7", now, ""))
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// A full nonce store is an outage, not a replay
+	h = SignatureMiddleware(config, http.MethodPost, "/api/pay", "pay", secrets, signature.NewMemoryStore(0))(func(c echo.Context) error {
+		return c.NoContent(http.StatusOK)
+	})
+	status, _ = serve(signed("acme", "s3cret", "n-8", now, ""))
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+}
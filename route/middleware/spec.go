@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// MiddlewareSpec is one entry of a route's middleware list. It is either a bare name
+// such as "timeout" or an object with parameters such as {"name":"timeout","duration":"3s"}.
+type MiddlewareSpec struct {
+	Name   string
+	Params map[string]json.RawMessage
+}
+
+func (s *MiddlewareSpec) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*s = MiddlewareSpec{Name: name}
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("middleware must be a name or an object with a name: %v", err)
+	}
+	raw, ok := fields["name"]
+	if !ok {
+		return fmt.Errorf("middleware object is missing \"name\"")
+	}
+	if err := json.Unmarshal(raw, &name); err != nil {
+		return fmt.Errorf("middleware name must be a string: %v", err)
+	}
+	delete(fields, "name")
+
+	*s = MiddlewareSpec{Name: name, Params: fields}
+	return nil
+}
+
+// MarshalJSON writes specs without parameters as bare names to stay compatible with older rows
+func (s MiddlewareSpec) MarshalJSON() ([]byte, error) {
+	if len(s.Params) == 0 {
+		return json.Marshal(s.Name)
+	}
+
+	fields := make(map[string]json.RawMessage, len(s.Params)+1)
+	for k, v := range s.Params {
+		fields[k] = v
+	}
+	name, _ := json.Marshal(s.Name)
+	fields["name"] = name
+	return json.Marshal(fields)
+}
+
+// Decode fills config with the spec parameters, rejecting parameters config does not know.
+// Fields already set on config act as defaults.
+func (s MiddlewareSpec) Decode(config interface{}) error {
+	if len(s.Params) > 0 {
+		data, err := json.Marshal(s.Params)
+		if err != nil {
+			return err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(config); err != nil {
+			return fmt.Errorf("invalid parameters for %q: %v", s.Name, err)
+		}
+	}
+
+	if v, ok := config.(interface{ Validate() error }); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("invalid parameters for %q: %v", s.Name, err)
+		}
+	}
+	return nil
+}
+
+// ParseSpecs decodes the JSON middleware column of a route
+func ParseSpecs(raw string) ([]MiddlewareSpec, error) {
+	if raw == "" || raw == "null" {
+		return nil, nil
+	}
+	var specs []MiddlewareSpec
+	if err := json.Unmarshal([]byte(raw), &specs); err != nil {
+		return nil, err
+	}
+	return specs, nil
+}
+
+// MiddlewareSchema describes a middleware type and its parameters for the dashboard
+type MiddlewareSchema struct {
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Params      []ParamSchema `json:"params"`
+}
+
+// ParamSchema describes a single middleware parameter
+type ParamSchema struct {
+	Name        string      `json:"name"`
+	Type        string      `json:"type"` // "duration", "integer", "number", "integer[]", "string", "string[]" or "boolean"
+	Required    bool        `json:"required"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description"`
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func TestParseSpecs(t *testing.T) {
+	specs, err := ParseSpecs(`["timeout", {"name":"retry","attempts":2,"on":[502,503]}]`)
+	if assert.NoError(t, err) && assert.Len(t, specs, 2) {
+		assert.Equal(t, "timeout", specs[0].Name)
+		assert.Empty(t, specs[0].Params)
+
+		retry := DefaultRetryConfig()
+		assert.Equal(t, "retry", specs[1].Name)
+		assert.NoError(t, specs[1].Decode(&retry))
+		expected := DefaultRetryConfig()
+		expected.Attempts = 2
+		expected.On = []int{502, 503}
+		assert.Equal(t, expected, retry)
+	}
+
+	// Legacy rows keep their bare-name format when written back
+	data, err := json.Marshal(specs)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `["timeout", {"name":"retry","attempts":2,"on":[502,503]}]`, string(data))
+
+	_, err = ParseSpecs(`[{"duration":"3s"}]`)
+	assert.Error(t, err)
+}
+
+func TestMiddlewareSpecDecode(t *testing.T) {
+	timeout := TimeoutConfig{Duration: util.Duration(10 * time.Second)}
+	assert.NoError(t, MiddlewareSpec{Name: "timeout"}.Decode(&timeout))
+	assert.Equal(t, util.Duration(10*time.Second), timeout.Duration)
+
+	specs, _ := ParseSpecs(`[{"name":"timeout","duration":"3s"}, {"name":"timeout","duraton":"3s"}, {"name":"timeout","duration":"-1s"}]`)
+	assert.NoError(t, specs[0].Decode(&timeout))
+	assert.Equal(t, util.Duration(3*time.Second), timeout.Duration)
+	assert.ErrorContains(t, specs[1].Decode(&TimeoutConfig{}), "unknown field")
+	assert.ErrorContains(t, specs[2].Decode(&TimeoutConfig{}), "duration must be positive")
+}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
 )
 
@@ -42,6 +43,9 @@ func TrafficLogger() echo.MiddlewareFunc {
 			if err != nil {
 				log.ErrorMessage = err.Error()
 			}
+			if consumer, ok := c.Get(util.ContextConsumerKey).(string); ok {
+				log.Consumer = consumer
+			}
 
 			// We use a background goroutine or just save it synchronously for now
 			// Given this is an admin dashboard, sync is fine for low traffic,
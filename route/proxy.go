@@ -1,7 +1,9 @@
 package route
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,13 +14,15 @@ import (
 	"github.com/jhump/protoreflect/grpcreflect"
 	"github.com/labstack/echo/v4"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
-	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/deadline"
+	grpcerrors "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/errors"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
-	"google.golang.org/grpc/status"
 )
 
 type GenericProxyHandler struct {
@@ -30,46 +34,45 @@ func NewGenericProxyHandler(service database.Service) *GenericProxyHandler {
 }
 
 func (h *GenericProxyHandler) Handle(c echo.Context) error {
-	stats := util.GetHealthStats(h.service.ID)
-	if !stats.ShouldAllow() {
-		tracing.Error(c.Request().Context(), "Proxy", "Circuit breaker OPEN for "+h.service.Name)
-		return echo.NewHTTPError(http.StatusServiceUnavailable, "Service temporarily unavailable (Circuit Breaker OPEN)")
+	cb := breaker.ForService(h.service)
+	done, err := cb.Allow()
+	if err != nil {
+		tracing.Error(c.Request().Context(), "Proxy", "Circuit breaker rejected call to "+h.service.Name+": "+err.Error())
+		return breaker.RejectionError(err)
 	}
 
 	tracing.Info(c.Request().Context(), "Proxy", "Interpreting request for "+h.service.Name)
 	if h.service.Protocol == "grpc" {
 		err := h.handleGRPC(c)
-		if err != nil {
-			stats.RecordFailure()
-		} else {
-			stats.RecordSuccess()
-		}
+		done(!breaker.IsFailure(err))
 		return err
 	}
 
 	target, err := url.Parse(h.service.BaseURL)
 	if err != nil {
 		tracing.Error(c.Request().Context(), "REST", "Invalid upstream URL: "+h.service.BaseURL)
-		stats.RecordFailure()
+		done(false)
 		return echo.NewHTTPError(http.StatusInternalServerError, "Invalid Upstream URL")
 	}
 
 	tracing.Info(c.Request().Context(), "REST", "Proxying to "+h.service.BaseURL)
 	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = &gatewayauth.Transport{Next: &deadline.Transport{Next: hedge.Transport}}
 
 	// Capture response to record success/failure
 	proxy.ModifyResponse = func(res *http.Response) error {
-		if res.StatusCode >= 500 {
-			stats.RecordFailure()
-		} else {
-			stats.RecordSuccess()
-		}
+		done(res.StatusCode < 500)
 		return nil
 	}
 
 	proxy.ErrorHandler = func(res http.ResponseWriter, req *http.Request, err error) {
-		stats.RecordFailure()
+		// A client hanging up says nothing about the upstream
+		done(!breaker.IsFailure(err))
 		tracing.Error(c.Request().Context(), "REST", "Proxy error: "+err.Error())
+		if errors.Is(err, context.DeadlineExceeded) {
+			c.Error(echo.NewHTTPError(http.StatusGatewayTimeout, "Gateway Timeout"))
+			return
+		}
 		c.Error(echo.NewHTTPError(http.StatusBadGateway, "Proxy error"))
 	}
 
@@ -96,7 +99,7 @@ func (h *GenericProxyHandler) handleGRPC(c echo.Context) error {
 	}
 
 	tracing.Info(c.Request().Context(), "gRPC", "Dialing "+h.service.GRPCAddr)
-	conn, err := grpc.Dial(h.service.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(h.service.GRPCAddr, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithUnaryInterceptor(gatewayauth.UnaryClientInterceptor))
 	if err != nil {
 		tracing.Error(c.Request().Context(), "gRPC", "Dial failed: "+err.Error())
 		return echo.NewHTTPError(http.StatusServiceUnavailable, "Failed to connect to gRPC service")
@@ -134,12 +137,7 @@ func (h *GenericProxyHandler) handleGRPC(c echo.Context) error {
 	err = conn.Invoke(ctx, fmt.Sprintf("/%s/%s", fullServiceName, mapping.RPCMethod), reqMsg, resMsg)
 	if err != nil {
 		tracing.Error(ctx, "gRPC", "Invocation failed: "+err.Error())
-		if s, ok := status.FromError(err); ok {
-			if s.Code() == codes.Unavailable || s.Code() == codes.Internal {
-				return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("gRPC call failed: %v", err))
-			}
-		}
-		return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("gRPC call failed: %v", err))
+		return grpcerrors.GRPCToHTTP(err)
 	}
 
 	resJSON, err := resMsg.MarshalJSON()
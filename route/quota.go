@@ -0,0 +1,115 @@
+package route
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+const (
+	HeaderQuotaLimit     = "X-Quota-Limit"
+	HeaderQuotaRemaining = "X-Quota-Remaining"
+	HeaderQuotaReset     = "X-Quota-Reset"
+)
+
+// loadQuotas reads the enabled quotas, skipping invalid ones
+func loadQuotas() ([]quota.Quota, error) {
+	db := database.GetDB()
+	var rows []database.Quota
+	if err := db.Where("disabled = ?", false).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var quotas []quota.Quota
+	for _, row := range rows {
+		q, err := quota.FromModel(row)
+		if err != nil {
+			log.Printf("Quota %d %s: skipping: %v", row.ID, row.Name, err)
+			continue
+		}
+		quotas = append(quotas, q)
+	}
+	return quotas, nil
+}
+
+// quotasFor returns the quotas that apply to a route
+func quotasFor(quotas []quota.Quota, route Route) []quota.Quota {
+	var out []quota.Quota
+	for _, q := range quotas {
+		if q.Applies(route.ServiceID, route.ID, route.Tag) {
+			out = append(out, q)
+		}
+	}
+	return out
+}
+
+// quotaMiddleware rejects a request once any of the quotas is used up for its client. It runs
+// after the route authenticates the client, so only authenticated requests count. A request
+// rejected by one quota is handed back to the quotas that already counted it. The response
+// reports the quota with the fewest requests left in X-Quota headers. Requests are let through
+// if the store fails.
+func quotaMiddleware(quotas []quota.Quota, store quota.Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(quotas) == 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			now := time.Now()
+			var taken []quotaState
+			tightest := -1
+			for _, q := range quotas {
+				key := ratelimit.ClientKey(c, q.KeyBy, q.KeyName)
+				start, end := q.Period(now)
+				used, allowed, err := store.Take(ctx, q, key, start)
+				if err != nil {
+					tracing.Error(ctx, "Quota", "Quota store failed, allowing request: "+err.Error())
+					continue
+				}
+
+				state := quotaState{quota: q, key: key, start: start, limit: q.Requests, remaining: q.Requests - used, reset: end.Sub(now)}
+				if !allowed {
+					tracing.Warn(ctx, "Quota", "Quota "+q.Name+" used up for "+key)
+					for _, t := range taken {
+						if err := store.Return(ctx, t.quota, t.key, t.start); err != nil {
+							tracing.Error(ctx, "Quota", "Cannot return request to quota "+t.quota.Name+": "+err.Error())
+						}
+					}
+					state.set(c.Response().Header())
+					c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds(state.reset)))
+					return q.Rejection()
+				}
+				if tightest < 0 || state.remaining < taken[tightest].remaining {
+					tightest = len(taken)
+				}
+				taken = append(taken, state)
+			}
+			if tightest >= 0 {
+				taken[tightest].set(c.Response().Header())
+			}
+			return next(c)
+		}
+	}
+}
+
+type quotaState struct {
+	quota     quota.Quota
+	key       string
+	start     time.Time
+	limit     int64
+	remaining int64
+	reset     time.Duration
+}
+
+func (s *quotaState) set(h http.Header) {
+	h.Set(HeaderQuotaLimit, strconv.FormatInt(s.limit, 10))
+	h.Set(HeaderQuotaRemaining, strconv.FormatInt(s.remaining, 10))
+	h.Set(HeaderQuotaReset, strconv.Itoa(seconds(s.reset)))
+}
@@ -0,0 +1,102 @@
+package route
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+)
+
+type memoryQuotaStore map[string]int64
+
+func (s memoryQuotaStore) Take(ctx context.Context, q quota.Quota, key string, start time.Time) (int64, bool, error) {
+	k := q.Name + " " + key + " " + start.String()
+	if s[k] >= q.Requests {
+		return s[k], false, nil
+	}
+	s[k]++
+	return s[k], true, nil
+}
+
+func (s memoryQuotaStore) Return(ctx context.Context, q quota.Quota, key string, start time.Time) error {
+	s[q.Name+" "+key+" "+start.String()]--
+	return nil
+}
+
+func TestQuotaMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = util.CustomHTTPErrorHandler
+	quotas := []quota.Quota{
+		{Name: "monthly", Requests: 100, Interval: quota.IntervalMonth, KeyBy: "header", KeyName: util.ApiKey, RejectCode: "016", RejectStatus: http.StatusTooManyRequests},
+		{Name: "daily", Requests: 2, Interval: quota.IntervalDay, KeyBy: "header", KeyName: util.ApiKey, RejectCode: "021", RejectStatus: http.StatusForbidden},
+	}
+	e.GET("/partners", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, quotaMiddleware(quotas, memoryQuotaStore{}))
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/partners", nil)
+		req.Header.Set(util.ApiKey, key)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send("partner-1")
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderQuotaLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderQuotaRemaining))
+	assert.NotEmpty(t, rec.Header().Get(HeaderQuotaReset))
+
+	assert.Equal(t, http.StatusOK, send("partner-1").Code)
+
+	rec = send("partner-1")
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderQuotaRemaining))
+	assert.NotEmpty(t, rec.Header().Get(echo.HeaderRetryAfter))
+	assert.JSONEq(t, `{"status": false, "code": "021", "message": "Quota exceeded", "data": null}`, rec.Body.String())
+
+	assert.Equal(t, http.StatusOK, send("partner-2").Code)
+}
+
+func TestQuotaMiddlewareConsumer(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = util.CustomHTTPErrorHandler
+	store := memoryQuotaStore{}
+	quotas := []quota.Quota{
+		{Name: "monthly", Requests: 100, Interval: quota.IntervalMonth, KeyBy: "consumer", RejectCode: "016", RejectStatus: http.StatusTooManyRequests},
+		{Name: "daily", Requests: 1, Interval: quota.IntervalDay, KeyBy: "consumer", RejectCode: "021", RejectStatus: http.StatusForbidden},
+	}
+	// Stands in for the api-key middleware, which runs first
+	authenticate := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(util.ContextConsumerKey, c.Request().Header.Get("X-Consumer"))
+			return next(c)
+		}
+	}
+	e.GET("/partners", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, authenticate, quotaMiddleware(quotas, store))
+
+	send := func(consumer string) int {
+		req := httptest.NewRequest(http.MethodGet, "/partners", nil)
+		req.Header.Set("X-Consumer", consumer)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("acme"))
+	assert.Equal(t, http.StatusForbidden, send("acme"))
+	assert.Equal(t, http.StatusOK, send("globex"))
+
+	// The request the daily quota rejected was handed back to the monthly one
+	start, _ := quotas[0].Period(time.Now())
+	assert.Equal(t, int64(1), store["monthly consumer:acme "+start.String()])
+}
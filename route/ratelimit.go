@@ -0,0 +1,119 @@
+package route
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"
+	HeaderRateLimitRemaining = "RateLimit-Remaining"
+	HeaderRateLimitReset     = "RateLimit-Reset"
+)
+
+// loadRateLimitPolicies reads the enabled policies, skipping invalid ones
+func loadRateLimitPolicies() ([]ratelimit.Policy, error) {
+	db := database.GetDB()
+	var rows []database.RateLimitPolicy
+	if err := db.Where("disabled = ?", false).Order("id").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	var policies []ratelimit.Policy
+	for _, row := range rows {
+		p, err := ratelimit.FromModel(row)
+		if err != nil {
+			log.Printf("Rate limit policy %d %s: skipping: %v", row.ID, row.Name, err)
+			continue
+		}
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// policiesFor returns the policies that apply to a route
+func policiesFor(policies []ratelimit.Policy, route Route) []ratelimit.Policy {
+	var out []ratelimit.Policy
+	for _, p := range policies {
+		if p.Applies(route.ServiceID, route.ID) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// anonymous returns the policies that can be enforced before the route authenticates the client
+func anonymous(policies []ratelimit.Policy) []ratelimit.Policy {
+	var out []ratelimit.Policy
+	for _, p := range policies {
+		if !p.Authenticated() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// authenticated returns the policies that count clients by who they authenticated as
+func authenticated(policies []ratelimit.Policy) []ratelimit.Policy {
+	var out []ratelimit.Policy
+	for _, p := range policies {
+		if p.Authenticated() {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// rateLimitMiddleware rejects a request once any of the policies is exhausted for its client.
+// The response reports the most restrictive policy in RateLimit headers. Requests are let
+// through if the store fails.
+func rateLimitMiddleware(policies []ratelimit.Policy, store ratelimit.Store) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		if len(policies) == 0 {
+			return next
+		}
+		return func(c echo.Context) error {
+			ctx := c.Request().Context()
+			var tightest *ratelimit.Result
+			for _, p := range policies {
+				key := p.StoreKey(p.ClientKey(c))
+				result, err := store.Take(ctx, p, key)
+				if err != nil {
+					tracing.Error(ctx, "RateLimit", "Rate limit store failed, allowing request: "+err.Error())
+					continue
+				}
+				if !result.Allowed {
+					tracing.Warn(ctx, "RateLimit", "Rate limited by policy "+p.Name+" for "+key)
+					setRateLimitHeaders(c.Response().Header(), result)
+					c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds(result.RetryAfter)))
+					return echo.NewHTTPError(http.StatusTooManyRequests, "Too Many Requests")
+				}
+				if tightest == nil || result.Remaining < tightest.Remaining {
+					tightest = &result
+				}
+			}
+			if tightest != nil {
+				setRateLimitHeaders(c.Response().Header(), *tightest)
+			}
+			return next(c)
+		}
+	}
+}
+
+func setRateLimitHeaders(h http.Header, result ratelimit.Result) {
+	h.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+	h.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+	h.Set(HeaderRateLimitReset, strconv.Itoa(seconds(result.Reset)))
+}
+
+// seconds rounds up so clients never come back too early
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,46 @@
+package route
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = util.CustomHTTPErrorHandler
+	policies := []ratelimit.Policy{
+		{ID: 1, Name: "global", Requests: 10, Period: time.Second, Burst: 10, KeyBy: ratelimit.KeyByIP},
+		{ID: 2, Name: "login", Requests: 2, Period: time.Minute, Burst: 2, KeyBy: ratelimit.KeyByIP},
+	}
+	e.POST("/login", func(c echo.Context) error {
+		return c.String(http.StatusOK, "ok")
+	}, rateLimitMiddleware(policies, ratelimit.NewMemoryStore(100, time.Hour)))
+
+	send := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/login", nil))
+		return rec
+	}
+
+	rec := send()
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(HeaderRateLimitReset))
+	assert.Empty(t, rec.Header().Get(echo.HeaderRetryAfter))
+
+	assert.Equal(t, http.StatusOK, send().Code)
+
+	rec = send()
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+	assert.Equal(t, "30", rec.Header().Get(echo.HeaderRetryAfter))
+	assert.JSONEq(t, `{"status": false, "code": "016", "message": "Too Many Requests", "data": null}`, rec.Body.String())
+}
@@ -1,48 +1,46 @@
 package route
 
 import (
-	"encoding/json"
 	"log"
 	"net/http"
-	"strings"
-	"sync"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
-	"golang.org/x/time/rate"
 
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain"
 	adminHandler "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/domain/admin/handler"
 	customMw "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route/middleware"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/authz"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/signature"
 )
 
 // Route for mapping from json file
 type Route struct {
-	Path       string   `json:"path"`
-	Method     string   `json:"method"`
-	Module     string   `json:"module"`
-	Tag        string   `json:"tag"`
-	Endpoint   string   `json:"endpoint_filter"`
-	Middleware []string `json:"middleware"`
+	Path       string                    `json:"path"`
+	Method     string                    `json:"method"`
+	Module     string                    `json:"module"`
+	Tag        string                    `json:"tag"`
+	Endpoint   string                    `json:"endpoint_filter"`
+	Middleware []customMw.MiddlewareSpec `json:"middleware"`
+	ID         uint                      `json:"-"`
+	ServiceID  uint                      `json:"-"`
+	Authz      string                    `json:"-"` // JSON encoded authorization policy
 }
 
 // Redundant definition removed, moved to domain
 
 // Init gateway router
 func Init() *echo.Echo {
-	routes := loadRoutesFromDB()
-
 	e := echo.New()
 	e.Validator = &domain.CustomValidator{Validator: validator.New()}
 
-	store := NewRateLimiterStore()
 	e.Use(CacheControlMiddleware)
 	e.Use(customMw.MetricsMiddleware)
 	e.Use(customMw.TrafficLogger())
-	e.Use(rateLimiterMiddleware(store))
 	// Set Bundle MiddleWare
 	e.Use(middleware.RequestID())
 	e.Pre(middleware.RemoveTrailingSlash())
@@ -51,20 +49,17 @@ func Init() *echo.Echo {
 	e.Use(middleware.Logger())
 	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
 		AllowOrigins:  []string{"*"},
-		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength, echo.HeaderAcceptEncoding, echo.HeaderAccessControlAllowOrigin, echo.HeaderAccessControlAllowHeaders, echo.HeaderContentDisposition, "X-Request-Id", "device-id", "X-Summary", "X-Account-Number", "X-Business-Name", "client-secret", "X-CSRF-Token", "x-api-key", "Cache-Control", "no-store, no-cache, must-revalidate, private"},
-		ExposeHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength, echo.HeaderAcceptEncoding, echo.HeaderAccessControlAllowOrigin, echo.HeaderAccessControlAllowHeaders, echo.HeaderContentDisposition, "X-Request-Id", "device-id", "X-Summary", "X-Account-Number", "X-Business-Name", "client-secret", "X-CSRF-Token", "x-api-key", "Cache-Control", "no-store, no-cache, must-revalidate, private"},
+		AllowHeaders:  []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength, echo.HeaderAcceptEncoding, echo.HeaderAccessControlAllowOrigin, echo.HeaderAccessControlAllowHeaders, echo.HeaderContentDisposition, "X-Request-Id", "device-id", "X-Summary", "X-Account-Number", "X-Business-Name", "client-secret", "X-CSRF-Token", "x-api-key", "Cache-Control", "no-store, no-cache, must-revalidate, private", signature.HeaderClientID, signature.HeaderTimestamp, signature.HeaderNonce, signature.HeaderSignature},
+		ExposeHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization, echo.HeaderContentLength, echo.HeaderAcceptEncoding, echo.HeaderAccessControlAllowOrigin, echo.HeaderAccessControlAllowHeaders, echo.HeaderContentDisposition, "X-Request-Id", "device-id", "X-Summary", "X-Account-Number", "X-Business-Name", "client-secret", "X-CSRF-Token", "x-api-key", "Cache-Control", "no-store, no-cache, must-revalidate, private", HeaderRateLimitLimit, HeaderRateLimitRemaining, HeaderRateLimitReset, echo.HeaderRetryAfter, HeaderQuotaLimit, HeaderQuotaRemaining, HeaderQuotaReset, hedge.HeaderHedged},
 		AllowMethods:  []string{echo.GET, echo.HEAD, echo.PUT, echo.PATCH, echo.POST, echo.DELETE},
 	}))
 
 	e.HTTPErrorHandler = util.CustomHTTPErrorHandler
 
-	for _, route := range routes {
-		h := NewDynamicHandler(route.Endpoint)
-		e.Add(route.Method, route.Path, h.Handle, chainMiddleware(route)...)
-	}
+	gateway := NewGateway(e)
 
 	// Register Admin API
-	admin := adminHandler.NewAdminHandler()
+	admin := adminHandler.NewAdminHandler(gateway)
 	a := e.Group("/admin")
 
 	// Services
@@ -72,12 +67,55 @@ func Init() *echo.Echo {
 	a.POST("/services", admin.CreateService)
 	a.PUT("/services/:id", admin.UpdateService)
 	a.DELETE("/services/:id", admin.DeleteService)
+	a.GET("/services/:id/breaker", admin.GetServiceBreaker)
+	a.POST("/services/:id/breaker/open", admin.ForceOpenServiceBreaker)
+	a.POST("/services/:id/breaker/close", admin.ForceCloseServiceBreaker)
+	a.POST("/services/:id/breaker/reset", admin.ResetServiceBreaker)
+	a.GET("/services/:id/signing-key", admin.GetServiceSigningKey)
+	a.POST("/services/:id/signing-key", admin.RotateServiceSigningKey)
+	a.DELETE("/services/:id/signing-key", admin.DeleteServiceSigningKey)
 
 	// Routes
 	a.GET("/routes", admin.GetRoutes)
 	a.POST("/routes", admin.CreateRoute)
 	a.PUT("/routes/:id", admin.UpdateRoute)
 	a.DELETE("/routes/:id", admin.DeleteRoute)
+	a.GET("/middleware", admin.GetMiddlewareSchemas)
+
+	// Rate Limits
+	a.GET("/rate-limits", admin.GetRateLimits)
+	a.POST("/rate-limits", admin.CreateRateLimit)
+	a.PUT("/rate-limits/:id", admin.UpdateRateLimit)
+	a.DELETE("/rate-limits/:id", admin.DeleteRateLimit)
+	a.GET("/rate-limits/:id/state", admin.GetRateLimitState)
+
+	// Quotas
+	a.GET("/quotas", admin.GetQuotas)
+	a.POST("/quotas", admin.CreateQuota)
+	a.GET("/quotas/usage", admin.GetQuotaUsage)
+	a.PUT("/quotas/:id", admin.UpdateQuota)
+	a.DELETE("/quotas/:id", admin.DeleteQuota)
+
+	// Fault Injection
+	a.GET("/faults", admin.GetFaults)
+	a.POST("/faults", admin.CreateFault)
+	a.PUT("/faults/:id", admin.UpdateFault)
+	a.DELETE("/faults/:id", admin.DeleteFault)
+
+	// Consumers and API Keys
+	a.GET("/consumers", admin.GetConsumers)
+	a.POST("/consumers", admin.CreateConsumer)
+	a.PUT("/consumers/:id", admin.UpdateConsumer)
+	a.DELETE("/consumers/:id", admin.DeleteConsumer)
+	a.GET("/consumers/:id/keys", admin.GetConsumerKeys)
+	a.POST("/consumers/:id/keys", admin.CreateConsumerKey)
+	a.POST("/consumers/:id/keys/rotate", admin.RotateConsumerKeys)
+	a.POST("/consumers/:id/keys/:keyId/revoke", admin.RevokeConsumerKey)
+	a.POST("/consumers/:id/signing-secret", admin.RotateSigningSecret)
+
+	// Access Token Revocation
+	a.GET("/revocations", admin.GetRevocations)
+	a.POST("/revocations", admin.CreateRevocation)
 
 	// Proto Mappings
 	a.GET("/proto-mappings", admin.GetProtoMappings)
@@ -85,105 +123,155 @@ func Init() *echo.Echo {
 	a.PUT("/proto-mappings/:id", admin.UpdateProtoMapping)
 	a.DELETE("/proto-mappings/:id", admin.DeleteProtoMapping)
 	a.GET("/metrics", admin.GetMetrics)
+	a.DELETE("/cache", admin.PurgeCache)
 	a.GET("/logs", admin.GetActivityLogs)
 	a.GET("/request-logs", admin.GetRequestLogs)
 	a.GET("/traces/:id", admin.GetTraceLogs)
 	a.GET("/server-logs", admin.GetServerLogs)
 
+	// Config Revisions
+	a.GET("/revisions", admin.GetRevisions)
+	a.GET("/revisions/diff", admin.DiffRevisions)
+	a.GET("/revisions/:id", admin.GetRevision)
+	a.POST("/revisions/:id/rollback", admin.RollbackRevision)
+	a.POST("/validate", admin.Validate)
+
 	// Serve Dashboard
 	e.Static("/dashboard", "dashboard/dist")
 	e.File("/dashboard", "dashboard/dist/index.html")
 
+	// Everything else is gateway traffic resolved against the reloadable route table
+	e.Any("/*", gateway.Handle)
+
 	return e
 }
 
-func loadRoutesFromDB() []Route {
+func loadRoutesFromDB() ([]Route, error) {
 	db := database.GetDB()
 	var dbRoutes []database.Route
 	if err := db.Find(&dbRoutes).Error; err != nil {
-		log.Printf("Error loading routes from DB: %v", err)
-		return nil
+		return nil, err
 	}
 
 	var routes []Route
 	for _, dr := range dbRoutes {
-		var mw []string
-		_ = json.Unmarshal([]byte(dr.Middleware), &mw)
-		routes = append(routes, Route{
-			Path:       dr.Path,
-			Method:     dr.Method,
-			Tag:        dr.Tag,
-			Endpoint:   dr.EndpointFilter,
-			Middleware: mw,
-		})
+		r, err := toRoute(dr)
+		if err != nil {
+			log.Printf("Route %s %s: invalid middleware %s: %v", dr.Method, dr.Path, dr.Middleware, err)
+		}
+		routes = append(routes, r)
 	}
 
-	return routes
+	return routes, nil
 }
 
-func chainMiddleware(route Route) []echo.MiddlewareFunc {
+// toRoute converts a database row, decoding its middleware specs
+func toRoute(dr database.Route) (Route, error) {
+	mw, err := customMw.ParseSpecs(dr.Middleware)
+	return Route{
+		Path:       dr.Path,
+		Method:     dr.Method,
+		Tag:        dr.Tag,
+		Endpoint:   dr.EndpointFilter,
+		Middleware: mw,
+		ID:         dr.ID,
+		ServiceID:  dr.ServiceID,
+		Authz:      dr.Authorization,
+	}, err
+}
+
+// chainMiddleware builds the route's own middleware. The authenticated middleware runs right
+// after the route's last authentication middleware, or first if it has none, so it only ever
+// sees identities that were verified.
+func chainMiddleware(route Route, authenticated ...echo.MiddlewareFunc) []echo.MiddlewareFunc {
 	var mwHandlers []echo.MiddlewareFunc
 	// init mw for router ,attach router properties
 	mwHandlers = append(mwHandlers, customMw.SetContextValue(util.ContextRouterKey, route.Tag))
-	for _, v := range route.Middleware {
-		mwHandlers = append(mwHandlers, middlewareHandler[v])
+
+	authorize, err := authorizationMiddleware(route)
+	if err != nil {
+		log.Printf("Route %s %s: denying every request, invalid authorization policy: %v", route.Method, route.Path, err)
+	}
+	// Without a jwt middleware the policy runs first and denies requests for lack of claims
+	if authorize != nil && !hasMiddleware(route, "jwt") {
+		mwHandlers = append(mwHandlers, authorize)
 	}
-	return mwHandlers
-}
 
-// CacheControlMiddleware sets cache control headers
-func CacheControlMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		c.Response().Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, private")
-		return next(c)
+	last := lastAuthentication(route)
+	if last < 0 {
+		mwHandlers = append(mwHandlers, authenticated...)
 	}
+	for i, spec := range route.Middleware {
+		if mw, err := buildMiddleware(spec, route); err != nil {
+			log.Printf("Route %s %s: skipping middleware: %v", route.Method, route.Path, err)
+		} else {
+			mwHandlers = append(mwHandlers, mw)
+		}
+		// Authorize right after authentication, before cached or coalesced responses can be served
+		if spec.Name == "jwt" && authorize != nil {
+			mwHandlers = append(mwHandlers, authorize)
+			authorize = nil
+		}
+		if i == last {
+			mwHandlers = append(mwHandlers, authenticated...)
+		}
+	}
+	return mwHandlers
 }
 
-// RateLimiterStore to store rate limiters per IP
-type RateLimiterStore struct {
-	limiters map[string]*rate.Limiter
-	mutex    sync.Mutex
-}
+// authenticationMiddleware names the middleware that establish who the client is
+var authenticationMiddleware = map[string]bool{"jwt": true, "api-key": true, "signature": true}
 
-// NewRateLimiterStore creates a new RateLimiterStore
-func NewRateLimiterStore() *RateLimiterStore {
-	return &RateLimiterStore{
-		limiters: make(map[string]*rate.Limiter),
+// lastAuthentication is the index of the route's last authentication middleware, or -1
+func lastAuthentication(route Route) int {
+	last := -1
+	for i, spec := range route.Middleware {
+		if authenticationMiddleware[spec.Name] {
+			last = i
+		}
 	}
+	return last
 }
 
-// GetLimiter retrieves the rate limiter for a specific IP, creating one if necessary
-func (store *RateLimiterStore) GetLimiter(ip string) *rate.Limiter {
-	store.mutex.Lock()
-	defer store.mutex.Unlock()
-
-	limiter, exists := store.limiters[ip]
-	if !exists {
-		limiter = rate.NewLimiter(rate.Limit(10), 5) // 2 requests per second with a burst of 5
-		store.limiters[ip] = limiter
+// authorizationMiddleware checks the route's authorization policy, if it has one. An invalid
+// policy denies every request rather than leaving the route open.
+func authorizationMiddleware(route Route) (echo.MiddlewareFunc, error) {
+	policy, ok, err := authz.ParsePolicy(route.Authz)
+	if err != nil {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(c echo.Context) error {
+				return echo.NewHTTPError(http.StatusForbidden, "Access denied")
+			}
+		}, err
 	}
+	if !ok {
+		return nil, nil
+	}
+	return customMw.AuthorizationMiddleware(policy), nil
+}
 
-	return limiter
+func hasMiddleware(route Route, name string) bool {
+	for _, spec := range route.Middleware {
+		if spec.Name == name {
+			return true
+		}
+	}
+	return false
 }
 
-// rateLimiterMiddleware creates the rate limiting middleware
-func rateLimiterMiddleware(store *RateLimiterStore) echo.MiddlewareFunc {
-	return func(next echo.HandlerFunc) echo.HandlerFunc {
-		return func(c echo.Context) error {
-			// Skip rate limiting for admin and dashboard
-			path := c.Request().URL.Path
-			if util.IsAdminPath(path) || strings.HasPrefix(path, "/dashboard") {
-				return next(c)
+// CacheControlMiddleware sets cache control headers. Responses are not cacheable unless the
+// cache middleware of the route sets a value, or an empty one to keep the upstream's header.
+func CacheControlMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		c.Response().Before(func() {
+			value, ok := c.Get(util.ContextCacheControlKey).(string)
+			if !ok {
+				value = "no-store, no-cache, must-revalidate, private"
 			}
-
-			ip := c.RealIP()
-			limiter := store.GetLimiter(ip)
-
-			if !limiter.Allow() {
-				return c.String(http.StatusTooManyRequests, "Too Many Requests")
+			if value != "" {
+				c.Response().Header().Set("Cache-Control", value)
 			}
-
-			return next(c)
-		}
+		})
+		return next(c)
 	}
 }
@@ -0,0 +1,31 @@
+package route
+
+import (
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
+)
+
+// loadSigners builds the token signer of every service that has a signing key
+func loadSigners() (map[uint]*gatewayauth.Signer, error) {
+	db := database.GetDB()
+	var keys []database.ServiceSigningKey
+	if err := db.Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	var services []database.Service
+	if err := db.Find(&services).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uint]string, len(services))
+	for _, svc := range services {
+		names[svc.ID] = svc.Name
+	}
+
+	out := make(map[uint]*gatewayauth.Signer, len(keys))
+	for _, key := range keys {
+		if name, ok := names[key.ServiceID]; ok {
+			out[key.ServiceID] = &gatewayauth.Signer{KeyID: key.KeyID, Secret: []byte(key.Secret), Audience: name, TTL: gatewayauth.DefaultTTL}
+		}
+	}
+	return out, nil
+}
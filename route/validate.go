@@ -0,0 +1,318 @@
+package route
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	customMw "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/route/middleware"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/authz"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/breaker"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/quota"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+)
+
+var httpMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodPost:    true,
+	http.MethodPut:     true,
+	http.MethodPatch:   true,
+	http.MethodDelete:  true,
+	http.MethodOptions: true,
+}
+
+// Validate checks a configuration against the handlers and middleware this gateway knows about
+func (g *Gateway) Validate(snap *database.ConfigSnapshot) []database.ConfigProblem {
+	return ValidateConfig(snap)
+}
+
+// ValidateConfig returns every problem found in the configuration
+func ValidateConfig(snap *database.ConfigSnapshot) []database.ConfigProblem {
+	v := &configValidator{services: make(map[uint]database.Service), mapped: make(map[uint]bool)}
+	for _, s := range snap.Services {
+		v.services[s.ID] = s
+	}
+	for _, m := range snap.ProtoMappings {
+		v.mapped[m.ServiceID] = true
+	}
+
+	v.validateServices(snap)
+	v.validateRoutes(snap.Routes)
+	v.validateProtoMappings(snap.ProtoMappings)
+	v.validateRateLimits(snap)
+	v.validateQuotas(snap)
+
+	if v.problems == nil {
+		return []database.ConfigProblem{}
+	}
+	return v.problems
+}
+
+type configValidator struct {
+	services map[uint]database.Service
+	mapped   map[uint]bool // Services with a proto mapping
+	problems []database.ConfigProblem
+}
+
+func (v *configValidator) report(severity, resource string, id uint, name, format string, args ...interface{}) {
+	v.problems = append(v.problems, database.ConfigProblem{
+		Severity: severity,
+		Resource: resource,
+		ID:       id,
+		Name:     name,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *configValidator) validateServices(snap *database.ConfigSnapshot) {
+	for _, s := range snap.Services {
+		if s.Name == "" {
+			v.report(database.SeverityError, "Service", s.ID, s.Name, "name is required")
+		}
+
+		if _, err := breaker.ParsePolicy(s.CircuitBreaker); err != nil {
+			v.report(database.SeverityError, "Service", s.ID, s.Name, "invalid circuit breaker policy: %v", err)
+		}
+		if _, _, err := bulkhead.ParsePolicy(s.Bulkhead); err != nil {
+			v.report(database.SeverityError, "Service", s.ID, s.Name, "invalid bulkhead policy: %v", err)
+		}
+		if _, _, err := adaptive.ParsePolicy(s.AdaptiveConcurrency); err != nil {
+			v.report(database.SeverityError, "Service", s.ID, s.Name, "invalid adaptive concurrency policy: %v", err)
+		}
+
+		switch s.Protocol {
+		case "rest":
+			u, err := url.Parse(s.BaseURL)
+			if s.BaseURL == "" || err != nil || u.Scheme == "" || u.Host == "" {
+				v.report(database.SeverityError, "Service", s.ID, s.Name, "REST service needs an absolute base URL, got %q", s.BaseURL)
+			}
+		case "grpc":
+			if s.GRPCAddr == "" {
+				v.report(database.SeverityError, "Service", s.ID, s.Name, "gRPC service needs a gRPC address")
+			}
+			if !v.mapped[s.ID] {
+				v.report(database.SeverityError, "Service", s.ID, s.Name, "gRPC service has no proto mapping")
+			}
+		default:
+			v.report(database.SeverityError, "Service", s.ID, s.Name, "unknown protocol %q, expected \"rest\" or \"grpc\"", s.Protocol)
+		}
+	}
+}
+
+func (v *configValidator) validateRoutes(routes []database.Route) {
+	filters := make(map[string]database.Route)
+	patterns := make(map[string]database.Route)
+
+	for _, r := range routes {
+		name := r.Method + " " + r.Path
+
+		if !strings.HasPrefix(r.Path, "/") {
+			v.report(database.SeverityError, "Route", r.ID, name, "path must start with \"/\"")
+		}
+		if !httpMethods[r.Method] {
+			v.report(database.SeverityError, "Route", r.ID, name, "unsupported method %q", r.Method)
+		}
+
+		service, ok := v.services[r.ServiceID]
+		if !ok {
+			v.report(database.SeverityError, "Route", r.ID, name, "references unknown service ID %d", r.ServiceID)
+		}
+
+		switch {
+		case r.EndpointFilter == "":
+			v.report(database.SeverityError, "Route", r.ID, name, "endpoint filter is required")
+		default:
+			if other, dup := filters[r.EndpointFilter]; dup {
+				v.report(database.SeverityError, "Route", r.ID, name, "endpoint filter %q is already used by %s %s", r.EndpointFilter, other.Method, other.Path)
+			} else {
+				filters[r.EndpointFilter] = r
+			}
+			if _, registered := endpoint[r.EndpointFilter]; !registered && ok {
+				if reason := v.unproxyable(service); reason != "" {
+					v.report(database.SeverityError, "Route", r.ID, name, "endpoint filter %q has no handler and service %s cannot be proxied: %s", r.EndpointFilter, service.Name, reason)
+				} else {
+					v.report(database.SeverityWarning, "Route", r.ID, name, "endpoint filter %q has no handler, requests are proxied to %s", r.EndpointFilter, service.Name)
+				}
+			}
+		}
+
+		v.validateMiddleware(r, name)
+
+		key := r.Method + " " + pathPattern(r.Path)
+		if other, overlap := patterns[key]; overlap {
+			v.report(database.SeverityError, "Route", r.ID, name, "path overlaps with %s %s", other.Method, other.Path)
+		} else {
+			patterns[key] = r
+		}
+	}
+}
+
+// unproxyable tells why the generic proxy cannot reach the service, or is empty if it can
+func (v *configValidator) unproxyable(s database.Service) string {
+	switch s.Protocol {
+	case "rest":
+		if s.BaseURL == "" {
+			return "it has no base URL"
+		}
+	case "grpc":
+		if s.GRPCAddr == "" {
+			return "it has no gRPC address"
+		}
+		if !v.mapped[s.ID] {
+			return "it has no proto mapping"
+		}
+	default:
+		return fmt.Sprintf("unknown protocol %q", s.Protocol)
+	}
+	return ""
+}
+
+func (v *configValidator) validateMiddleware(r database.Route, name string) {
+	route, err := toRoute(r)
+	if err != nil {
+		v.report(database.SeverityError, "Route", r.ID, name, "middleware must be a JSON array of names or objects: %v", err)
+		return
+	}
+
+	v.validateAuthorization(r, route, name)
+	if (r.EndpointFilter == "logout" || r.EndpointFilter == "logout-grpc") && !hasMiddleware(route, "jwt") {
+		v.report(database.SeverityWarning, "Route", r.ID, name, "logout cannot revoke access tokens without the jwt middleware")
+	}
+
+	for _, spec := range route.Middleware {
+		_, params, err := decodeMiddleware(spec, route)
+		if err != nil {
+			v.report(database.SeverityError, "Route", r.ID, name, "%v", err)
+			continue
+		}
+		if fb, ok := params.(*customMw.FallbackConfig); ok && fb.Mode == customMw.FallbackService {
+			if _, ok := v.services[fb.ServiceID]; !ok {
+				v.report(database.SeverityError, "Route", r.ID, name, "fallback references unknown service ID %d", fb.ServiceID)
+			}
+		}
+		if h, ok := params.(*customMw.HedgeConfig); ok {
+			if h.ServiceID != 0 {
+				if _, ok := v.services[h.ServiceID]; !ok {
+					v.report(database.SeverityError, "Route", r.ID, name, "hedge references unknown service ID %d", h.ServiceID)
+				}
+			}
+			if svc, ok := v.services[r.ServiceID]; ok && svc.Protocol == "grpc" {
+				v.report(database.SeverityWarning, "Route", r.ID, name, "hedge has no effect on gRPC service %s", svc.Name)
+			}
+		}
+	}
+}
+
+func (v *configValidator) validateAuthorization(r database.Route, route Route, name string) {
+	policy, ok, err := authz.ParsePolicy(r.Authorization)
+	if err != nil {
+		v.report(database.SeverityError, "Route", r.ID, name, "invalid authorization policy, every request is denied: %v", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	if !hasMiddleware(route, "jwt") {
+		v.report(database.SeverityError, "Route", r.ID, name, "authorization policy needs the jwt middleware, every request is denied")
+	}
+	for _, param := range policy.Params() {
+		if !strings.Contains(r.Path+"/", "/:"+param+"/") {
+			v.report(database.SeverityError, "Route", r.ID, name, "authorization policy compares with unknown path parameter %q", param)
+		}
+	}
+}
+
+func (v *configValidator) validateProtoMappings(mappings []database.ProtoMapping) {
+	for _, m := range mappings {
+		name := m.ServiceName + "/" + m.RPCMethod
+
+		service, ok := v.services[m.ServiceID]
+		if !ok {
+			v.report(database.SeverityError, "ProtoMapping", m.ID, name, "references unknown service ID %d", m.ServiceID)
+		} else if service.Protocol != "grpc" {
+			v.report(database.SeverityWarning, "ProtoMapping", m.ID, name, "service %s is not a gRPC service", service.Name)
+		}
+
+		if m.ProtoPackage == "" || m.ServiceName == "" || m.RPCMethod == "" {
+			v.report(database.SeverityError, "ProtoMapping", m.ID, name, "proto package, service name and RPC method are required")
+		}
+	}
+}
+
+func (v *configValidator) validateRateLimits(snap *database.ConfigSnapshot) {
+	routes := make(map[uint]database.Route)
+	for _, r := range snap.Routes {
+		routes[r.ID] = r
+	}
+
+	for _, m := range snap.RateLimitPolicies {
+		p, err := ratelimit.FromModel(m)
+		if err != nil {
+			v.report(database.SeverityError, "RateLimitPolicy", m.ID, m.Name, "%v", err)
+			continue
+		}
+
+		switch p.Scope {
+		case ratelimit.ScopeService:
+			if _, ok := v.services[p.TargetID]; !ok {
+				v.report(database.SeverityError, "RateLimitPolicy", m.ID, m.Name, "references unknown service ID %d", p.TargetID)
+			}
+		case ratelimit.ScopeRoute:
+			r, ok := routes[p.TargetID]
+			if !ok {
+				v.report(database.SeverityError, "RateLimitPolicy", m.ID, m.Name, "references unknown route ID %d", p.TargetID)
+			} else if p.KeyBy == ratelimit.KeyByBody && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+				v.report(database.SeverityWarning, "RateLimitPolicy", m.ID, m.Name, "keys by body field on %s %s, which has no body", r.Method, r.Path)
+			}
+		}
+	}
+}
+
+func (v *configValidator) validateQuotas(snap *database.ConfigSnapshot) {
+	routes := make(map[uint]bool)
+	tags := make(map[string]bool)
+	for _, r := range snap.Routes {
+		routes[r.ID] = true
+		tags[r.Tag] = true
+	}
+
+	for _, m := range snap.Quotas {
+		q, err := quota.FromModel(m)
+		if err != nil {
+			v.report(database.SeverityError, "Quota", m.ID, m.Name, "%v", err)
+			continue
+		}
+
+		switch q.Scope {
+		case quota.ScopeService:
+			if _, ok := v.services[q.TargetID]; !ok {
+				v.report(database.SeverityError, "Quota", m.ID, m.Name, "references unknown service ID %d", q.TargetID)
+			}
+		case quota.ScopeRoute:
+			if !routes[q.TargetID] {
+				v.report(database.SeverityError, "Quota", m.ID, m.Name, "references unknown route ID %d", q.TargetID)
+			}
+		case quota.ScopeTag:
+			if !tags[q.Tag] {
+				v.report(database.SeverityWarning, "Quota", m.ID, m.Name, "no route has tag %q", q.Tag)
+			}
+		}
+	}
+}
+
+// pathPattern normalizes a route path so that routes echo cannot tell apart compare equal,
+// e.g. /users/:id and /users/:name
+func pathPattern(path string) string {
+	segments := strings.Split(strings.TrimSuffix(path, "/"), "/")
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") {
+			segments[i] = ":"
+		}
+	}
+	return strings.Join(segments, "/")
+}
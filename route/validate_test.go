@@ -0,0 +1,80 @@
+package route
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+)
+
+func TestValidateConfig(t *testing.T) {
+	snap := &database.ConfigSnapshot{
+		Services: []database.Service{
+			{Model: gorm.Model{ID: 1}, Name: "auth-service", BaseURL: "http://localhost:8081", Protocol: "rest"},
+			{Model: gorm.Model{ID: 2}, Name: "auth-grpc", GRPCAddr: "localhost:50051", Protocol: "grpc"},
+		},
+		Routes: []database.Route{
+			{Model: gorm.Model{ID: 1}, Path: "/api/v1/auth/login", Method: "POST", ServiceID: 1, EndpointFilter: "login", Middleware: `["timeout", {"name":"retry","attempts":2}]`},
+			{Model: gorm.Model{ID: 5}, Path: "/api/v1/auth/otp/send", Method: "POST", ServiceID: 1, EndpointFilter: "otp-send", Middleware: `[{"name":"retry","attempts":0}]`},
+			{Model: gorm.Model{ID: 2}, Path: "/api/v1/auth/logout", Method: "POST", ServiceID: 1, EndpointFilter: "logout", Middleware: `[""]`},
+			{Model: gorm.Model{ID: 3}, Path: "/api/v1/users/:id", Method: "GET", ServiceID: 1, EndpointFilter: "user-get"},
+			{Model: gorm.Model{ID: 4}, Path: "/api/v1/users/:userId", Method: "GET", ServiceID: 9, EndpointFilter: "user-get"},
+			{Model: gorm.Model{ID: 6}, Path: "/api/v1/ref/provinces", Method: "GET", ServiceID: 1, EndpointFilter: "ref-provinces", Middleware: `[{"name":"fallback","mode":"service","service_id":7}]`},
+			{Model: gorm.Model{ID: 7}, Path: "/api/v1/ref/cities", Method: "GET", ServiceID: 1, EndpointFilter: "ref-cities", Middleware: `[{"name":"hedge","service_id":7}]`},
+			{Model: gorm.Model{ID: 10}, Path: "/api/v1/echo", Method: "POST", ServiceID: 2, EndpointFilter: "echo"},
+			{Model: gorm.Model{ID: 8}, Path: "/api/v1/agents/:agentId", Method: "GET", ServiceID: 1, EndpointFilter: "agent-get", Authorization: `{"rules":[{"claim":"sub","op":"eq","param":"userId"}]}`},
+		},
+		RateLimitPolicies: []database.RateLimitPolicy{
+			{Model: gorm.Model{ID: 1}, Name: "otp-send", Scope: "route", TargetID: 5, Requests: 3, Period: "1m", KeyBy: "body", KeyName: "phoneNumber"},
+			{Model: gorm.Model{ID: 2}, Name: "profile", Scope: "route", TargetID: 3, Requests: 3, Period: "1m", KeyBy: "body", KeyName: "phoneNumber"},
+			{Model: gorm.Model{ID: 3}, Name: "partners", Scope: "service", TargetID: 8, Requests: 100, Period: "1s", KeyBy: "api_key"},
+			{Model: gorm.Model{ID: 4}, Name: "broken", Scope: "global", Requests: 10, Period: "soon", KeyBy: "ip"},
+		},
+		Quotas: []database.Quota{
+			{Model: gorm.Model{ID: 1}, Name: "partners", Scope: "service", TargetID: 1, Requests: 100000, Interval: "month", KeyBy: "api_key"},
+			{Model: gorm.Model{ID: 2}, Name: "otp", Scope: "tag", Tag: "otp", Requests: 10, Interval: "day", KeyBy: "ip"},
+			{Model: gorm.Model{ID: 3}, Name: "login", Scope: "route", TargetID: 9, Requests: 10, Interval: "week", KeyBy: "ip"},
+		},
+	}
+
+	problems := ValidateConfig(snap)
+	assert.True(t, database.HasErrors(problems))
+
+	assert.Equal(t, []string{"gRPC service has no proto mapping"}, problemMessages(problems, "Service", 2))
+	assert.Empty(t, problemMessages(problems, "Service", 1))
+	assert.Empty(t, problemMessages(problems, "Route", 1))
+	assert.Equal(t, []string{`invalid parameters for "retry": attempts must be at least 1`}, problemMessages(problems, "Route", 5))
+	assert.Contains(t, problemMessages(problems, "Route", 2), `unknown middleware ""`)
+	assert.Contains(t, problemMessages(problems, "Route", 2), "logout cannot revoke access tokens without the jwt middleware")
+	assert.Equal(t, []string{`endpoint filter "user-get" has no handler, requests are proxied to auth-service`}, problemMessages(problems, "Route", 3))
+	assert.Equal(t, []string{`endpoint filter "echo" has no handler and service auth-grpc cannot be proxied: it has no proto mapping`}, problemMessages(problems, "Route", 10))
+	assert.ElementsMatch(t, []string{
+		"references unknown service ID 9",
+		`endpoint filter "user-get" is already used by GET /api/v1/users/:id`,
+		"path overlaps with GET /api/v1/users/:id",
+	}, problemMessages(problems, "Route", 4))
+	assert.Contains(t, problemMessages(problems, "Route", 6), "fallback references unknown service ID 7")
+	assert.Contains(t, problemMessages(problems, "Route", 7), "hedge references unknown service ID 7")
+	assert.Contains(t, problemMessages(problems, "Route", 8), "authorization policy needs the jwt middleware, every request is denied")
+	assert.Contains(t, problemMessages(problems, "Route", 8), `authorization policy compares with unknown path parameter "userId"`)
+
+	assert.Empty(t, problemMessages(problems, "RateLimitPolicy", 1))
+	assert.Equal(t, []string{"keys by body field on GET /api/v1/users/:id, which has no body"}, problemMessages(problems, "RateLimitPolicy", 2))
+	assert.Equal(t, []string{"references unknown service ID 8"}, problemMessages(problems, "RateLimitPolicy", 3))
+	assert.Equal(t, []string{`period must be a positive duration such as "1s" or "1m"`}, problemMessages(problems, "RateLimitPolicy", 4))
+
+	assert.Empty(t, problemMessages(problems, "Quota", 1))
+	assert.Equal(t, []string{`no route has tag "otp"`}, problemMessages(problems, "Quota", 2))
+	assert.Equal(t, []string{`interval must be "day" or "month"`}, problemMessages(problems, "Quota", 3))
+}
+
+func problemMessages(problems []database.ConfigProblem, resource string, id uint) []string {
+	var out []string
+	for _, p := range problems {
+		if p.Resource == resource && p.ID == id {
+			out = append(out, p.Message)
+		}
+	}
+	return out
+}
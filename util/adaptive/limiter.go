@@ -0,0 +1,148 @@
+package adaptive
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// shares is the part of the concurrency limit each priority may use, so lower priorities
+// are shed first as the limit shrinks
+var shares = map[string]float64{
+	PriorityHigh:   1.0,
+	PriorityNormal: 0.9,
+	PriorityLow:    0.7,
+}
+
+// Policy configures the AIMD concurrency limit of a service
+type Policy struct {
+	InitialLimit   int           `json:"initial_limit"`
+	MinLimit       int           `json:"min_limit"`
+	MaxLimit       int           `json:"max_limit"`
+	TargetLatency  util.Duration `json:"target_latency"`  // Slower responses shrink the limit
+	Backoff        float64       `json:"backoff"`         // Factor the limit is multiplied by when it shrinks
+	PriorityHeader string        `json:"priority_header"` // Header authenticated consumers may set "high", "normal" or "low" in, none by default
+}
+
+// DefaultPolicy starts at 20 concurrent requests and backs off when responses take over 500ms
+func DefaultPolicy() Policy {
+	return Policy{
+		InitialLimit:  20,
+		MinLimit:      1,
+		MaxLimit:      200,
+		TargetLatency: util.Duration(500 * time.Millisecond),
+		Backoff:       0.9,
+	}
+}
+
+func (p *Policy) Validate() error {
+	if p.MinLimit < 1 || p.MaxLimit < p.MinLimit {
+		return errors.New("min_limit must be at least 1 and not above max_limit")
+	}
+	if p.InitialLimit < p.MinLimit || p.InitialLimit > p.MaxLimit {
+		return errors.New("initial_limit must be between min_limit and max_limit")
+	}
+	if p.TargetLatency <= 0 {
+		return errors.New("target_latency must be positive")
+	}
+	if p.Backoff <= 0 || p.Backoff >= 1 {
+		return errors.New("backoff must be between 0 and 1")
+	}
+	return nil
+}
+
+// Stats is a point in time view of a limiter
+type Stats struct {
+	Key      string `json:"key"`
+	Limit    int    `json:"limit"`
+	InFlight int    `json:"in_flight"`
+	Shed     int64  `json:"shed"`
+}
+
+// Limiter adapts the concurrency it allows to the latency it observes: additive increase
+// while responses are fast, multiplicative decrease when they are slow or overloaded
+type Limiter struct {
+	key          string
+	policy       Policy
+	limit        float64
+	inFlight     int
+	shed         int64
+	lastDecrease time.Time
+	now          func() time.Time
+	mu           sync.Mutex
+}
+
+// ValidPriority reports whether priority is one of "high", "normal" or "low"
+func ValidPriority(priority string) bool {
+	_, ok := shares[priority]
+	return ok
+}
+
+// Acquire admits a request of the given priority if the limit leaves room for it
+func (l *Limiter) Acquire(priority string) (release func(), ok bool) {
+	share, known := shares[priority]
+	if !known {
+		share = shares[PriorityNormal]
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	allowed := int(math.Max(1, math.Floor(l.limit*share)))
+	if l.inFlight >= allowed {
+		l.shed++
+		return nil, false
+	}
+	l.inFlight++
+	return l.release, true
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+}
+
+// Observe adjusts the limit to the latency and status of a finished request
+func (l *Limiter) Observe(latency time.Duration, status int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	target := time.Duration(l.policy.TargetLatency)
+	overloaded := latency > target || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+	if overloaded {
+		// Requests started before the last decrease reflect the old limit, so wait for them
+		if now := l.now(); now.Sub(l.lastDecrease) >= target {
+			l.limit = math.Max(float64(l.policy.MinLimit), l.limit*l.policy.Backoff)
+			l.lastDecrease = now
+		}
+		return
+	}
+	// Only grow while the limit is actually in use
+	if float64(l.inFlight+1) >= l.limit/2 {
+		l.limit = math.Min(float64(l.policy.MaxLimit), l.limit+1/l.limit)
+	}
+}
+
+// SetPolicy changes the policy, keeping the current limit within the new bounds
+func (l *Limiter) SetPolicy(policy Policy) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.policy = policy
+	l.limit = math.Min(float64(policy.MaxLimit), math.Max(float64(policy.MinLimit), l.limit))
+}
+
+func (l *Limiter) Stats() Stats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return Stats{Key: l.key, Limit: int(l.limit), InFlight: l.inFlight, Shed: l.shed}
+}
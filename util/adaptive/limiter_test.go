@@ -0,0 +1,98 @@
+package adaptive
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func newTestLimiter(policy Policy) (*Limiter, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := NewRegistry().Get("service:1", policy)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestShedsLowPriorityFirst(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.InitialLimit = 10
+	l, _ := newTestLimiter(policy)
+
+	for i := 0; i < 7; i++ {
+		_, ok := l.Acquire(PriorityLow)
+		assert.True(t, ok)
+	}
+	_, ok := l.Acquire(PriorityLow)
+	assert.False(t, ok, "low priority may use 70% of the limit")
+
+	_, ok = l.Acquire("")
+	assert.True(t, ok)
+	_, ok = l.Acquire(PriorityNormal)
+	assert.True(t, ok)
+	_, ok = l.Acquire(PriorityNormal)
+	assert.False(t, ok, "normal priority may use 90% of the limit")
+
+	release, ok := l.Acquire(PriorityHigh)
+	assert.True(t, ok)
+	_, ok = l.Acquire(PriorityHigh)
+	assert.False(t, ok)
+
+	release()
+	assert.Equal(t, Stats{Key: "service:1", Limit: 10, InFlight: 9, Shed: 3}, l.Stats())
+}
+
+func TestAIMD(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.InitialLimit = 10
+	l, now := newTestLimiter(policy)
+
+	// Slow responses shrink the limit, once per target latency
+	l.Observe(time.Second, http.StatusOK)
+	assert.Equal(t, 9, l.Stats().Limit)
+	l.Observe(time.Second, http.StatusOK)
+	assert.Equal(t, 9, l.Stats().Limit)
+	*now = now.Add(time.Duration(policy.TargetLatency))
+	l.Observe(10*time.Millisecond, http.StatusGatewayTimeout)
+	assert.Equal(t, 8, l.Stats().Limit)
+
+	// Fast responses only grow the limit while it is in use
+	for i := 0; i < 100; i++ {
+		l.Observe(10*time.Millisecond, http.StatusOK)
+	}
+	assert.Equal(t, 8, l.Stats().Limit)
+
+	for i := 0; i < 8; i++ {
+		l.Acquire(PriorityHigh)
+	}
+	for i := 0; i < 20; i++ {
+		l.Observe(10*time.Millisecond, http.StatusOK)
+	}
+	assert.Equal(t, 10, l.Stats().Limit)
+
+	// Never below the minimum
+	for i := 0; i < 100; i++ {
+		*now = now.Add(time.Second)
+		l.Observe(time.Second, http.StatusOK)
+	}
+	assert.Equal(t, policy.MinLimit, l.Stats().Limit)
+}
+
+func TestParsePolicy(t *testing.T) {
+	_, ok, err := ParsePolicy("")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	policy, ok, err := ParsePolicy(`{"target_latency": "200ms", "max_limit": 50}`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, util.Duration(200*time.Millisecond), policy.TargetLatency)
+	assert.Equal(t, 50, policy.MaxLimit)
+
+	_, _, err = ParsePolicy(`{"backoff": 1.5}`)
+	assert.Error(t, err)
+	_, _, err = ParsePolicy(`{"initial_limit": 500}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,79 @@
+package adaptive
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Registry holds the adaptive limiters of every service, keyed like their circuit breakers
+type Registry struct {
+	limiters map[string]*Limiter
+	mu       sync.RWMutex
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{limiters: make(map[string]*Limiter)}
+}
+
+// Get returns the limiter for key, creating it at the initial limit of policy. An existing
+// limiter keeps the limit it has learned.
+func (r *Registry) Get(key string, policy Policy) *Limiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if l, ok := r.limiters[key]; ok {
+		l.SetPolicy(policy)
+		return l
+	}
+	l := &Limiter{key: key, policy: policy, limit: float64(policy.InitialLimit), now: time.Now}
+	r.limiters[key] = l
+	return l
+}
+
+// Lookup returns the limiter for key if one exists
+func (r *Registry) Lookup(key string) (*Limiter, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	l, ok := r.limiters[key]
+	return l, ok
+}
+
+// All returns the stats of every limiter ordered by key
+func (r *Registry) All() []Stats {
+	r.mu.RLock()
+	limiters := make([]*Limiter, 0, len(r.limiters))
+	for _, l := range r.limiters {
+		limiters = append(limiters, l)
+	}
+	r.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(limiters))
+	for _, l := range limiters {
+		stats = append(stats, l.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// ParsePolicy decodes a JSON policy on top of the defaults. An empty string means the
+// service has no adaptive limit and ok is false.
+func ParsePolicy(raw string) (policy Policy, ok bool, err error) {
+	if raw == "" {
+		return policy, false, nil
+	}
+	policy = DefaultPolicy()
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return policy, false, err
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, false, err
+	}
+	return policy, true, nil
+}
@@ -0,0 +1,224 @@
+// Package authz evaluates per-route authorization policies against verified token claims
+package authz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	MatchAll = "all"
+	MatchAny = "any"
+)
+
+const (
+	OpEq       = "eq"
+	OpNe       = "ne"
+	OpIn       = "in"
+	OpNotIn    = "not_in"
+	OpContains = "contains"
+	OpExists   = "exists"
+)
+
+// Rule compares one claim to a value, a list of values or a path parameter
+type Rule struct {
+	Claim  string        `json:"claim"`  // Claim name, dots for nested claims such as "realm_access.roles"
+	Op     string        `json:"op"`     // "eq", "ne", "in", "not_in", "contains" or "exists"
+	Value  interface{}   `json:"value"`  // eq, ne and contains: the value to compare with
+	Values []interface{} `json:"values"` // in and not_in: the allowed or forbidden values
+	Param  string        `json:"param"`  // eq and ne: compare with this path parameter instead of value
+}
+
+// Policy is the authorization policy of a route
+type Policy struct {
+	Match string `json:"match"` // "all" rules must pass, or "any" one of them
+	Rules []Rule `json:"rules"`
+}
+
+// ParsePolicy decodes the JSON policy stored with a route. An empty value means no policy.
+func ParsePolicy(raw string) (policy Policy, ok bool, err error) {
+	if raw == "" {
+		return policy, false, nil
+	}
+	policy.Match = MatchAll
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return policy, false, err
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, false, err
+	}
+	return policy, true, nil
+}
+
+func (p *Policy) Validate() error {
+	if p.Match != MatchAll && p.Match != MatchAny {
+		return errors.New("match must be \"all\" or \"any\"")
+	}
+	if len(p.Rules) == 0 {
+		return errors.New("rules must not be empty")
+	}
+	for i, r := range p.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("rules[%d]: %v", i, err)
+		}
+	}
+	return nil
+}
+
+func (r Rule) validate() error {
+	if r.Claim == "" {
+		return errors.New("claim is required")
+	}
+	switch r.Op {
+	case OpEq, OpNe:
+		if r.Value == nil && r.Param == "" {
+			return errors.New("value or param is required")
+		}
+	case OpIn, OpNotIn:
+		if len(r.Values) == 0 {
+			return errors.New("values must not be empty")
+		}
+	case OpContains:
+		if r.Value == nil {
+			return errors.New("value is required")
+		}
+	case OpExists:
+	default:
+		return errors.New("op must be \"eq\", \"ne\", \"in\", \"not_in\", \"contains\" or \"exists\"")
+	}
+	return nil
+}
+
+// Params lists the path parameters the policy compares claims with
+func (p Policy) Params() []string {
+	var out []string
+	for _, r := range p.Rules {
+		if r.Param != "" {
+			out = append(out, r.Param)
+		}
+	}
+	return out
+}
+
+// Decision is the outcome of evaluating a policy, with the rules that decided it
+type Decision struct {
+	Allowed bool
+	Reason  string
+}
+
+// Evaluate checks the claims against the policy. param returns the value of a path parameter.
+func (p Policy) Evaluate(claims map[string]interface{}, param func(name string) string) Decision {
+	var passed, failed []string
+	for _, r := range p.Rules {
+		if r.eval(claims, param) {
+			passed = append(passed, r.String())
+		} else {
+			failed = append(failed, r.String())
+		}
+	}
+
+	if p.Match == MatchAny {
+		if len(passed) > 0 {
+			return Decision{Allowed: true, Reason: "passed " + strings.Join(passed, ", ")}
+		}
+		return Decision{Reason: "failed " + strings.Join(failed, ", ")}
+	}
+	if len(failed) > 0 {
+		return Decision{Reason: "failed " + strings.Join(failed, ", ")}
+	}
+	return Decision{Allowed: true, Reason: "passed " + strings.Join(passed, ", ")}
+}
+
+func (r Rule) eval(claims map[string]interface{}, param func(name string) string) bool {
+	claim, ok := lookup(claims, r.Claim)
+	if r.Op == OpExists {
+		return ok
+	}
+	if !ok {
+		return false
+	}
+
+	want := r.Value
+	if r.Param != "" {
+		want = param(r.Param)
+	}
+	switch r.Op {
+	case OpEq:
+		return equal(claim, want)
+	case OpNe:
+		return !equal(claim, want)
+	case OpIn:
+		return anyOf(claim, r.Values)
+	case OpNotIn:
+		return !anyOf(claim, r.Values)
+	case OpContains:
+		list, ok := claim.([]interface{})
+		return ok && anyOf(want, list)
+	}
+	return false
+}
+
+// anyOf reports whether the claim, or any element of a list claim, is one of values
+func anyOf(claim interface{}, values []interface{}) bool {
+	items, ok := claim.([]interface{})
+	if !ok {
+		items = []interface{}{claim}
+	}
+	for _, item := range items {
+		for _, v := range values {
+			if equal(item, v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// equal compares claims by their text, so the number 42 equals the path parameter "42"
+func equal(a, b interface{}) bool {
+	return text(a) == text(b)
+}
+
+func text(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func lookup(claims map[string]interface{}, path string) (interface{}, bool) {
+	var v interface{} = claims
+	for _, part := range strings.Split(path, ".") {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[part]; !ok || v == nil {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+// String describes the rule for the trace, such as "role in [agent supervisor]"
+func (r Rule) String() string {
+	switch r.Op {
+	case OpExists:
+		return r.Claim + " exists"
+	case OpIn, OpNotIn:
+		return fmt.Sprintf("%s %s %v", r.Claim, strings.ReplaceAll(r.Op, "_", " "), r.Values)
+	}
+	if r.Param != "" {
+		return fmt.Sprintf("%s %s :%s", r.Claim, r.Op, r.Param)
+	}
+	return fmt.Sprintf("%s %s %v", r.Claim, r.Op, r.Value)
+}
@@ -0,0 +1,65 @@
+package authz
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParsePolicy(t *testing.T) {
+	_, ok, err := ParsePolicy("")
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	p, ok, err := ParsePolicy(`{"rules": [{"claim": "role", "op": "in", "values": ["agent"]}]}`)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+	assert.Equal(t, MatchAll, p.Match)
+
+	for _, raw := range []string{
+		`{"rules": []}`,
+		`{"match": "most", "rules": [{"claim": "role", "op": "exists"}]}`,
+		`{"rules": [{"claim": "role", "op": "like", "value": "agent"}]}`,
+		`{"rules": [{"claim": "role", "op": "in"}]}`,
+		`{"rules": [{"op": "exists"}]}`,
+		`{"rules": [{"claim": "role", "op": "exists", "role": "agent"}]}`,
+	} {
+		_, _, err := ParsePolicy(raw)
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p, _, err := ParsePolicy(`{"rules": [
+		{"claim": "role", "op": "in", "values": ["agent", "supervisor"]},
+		{"claim": "account_status", "op": "eq", "value": "active"},
+		{"claim": "sub", "op": "eq", "param": "userId"}
+	]}`)
+	assert.NoError(t, err)
+	params := map[string]string{"userId": "42"}
+	param := func(name string) string { return params[name] }
+
+	claims := map[string]interface{}{"role": "agent", "account_status": "active", "sub": float64(42)}
+	d := p.Evaluate(claims, param)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, "passed role in [agent supervisor], account_status eq active, sub eq :userId", d.Reason)
+
+	params["userId"] = "43"
+	d = p.Evaluate(claims, param)
+	assert.False(t, d.Allowed, "agents may only reach their own resources")
+	assert.Equal(t, "failed sub eq :userId", d.Reason)
+
+	params["userId"] = "42"
+	claims["role"] = []interface{}{"viewer", "supervisor"}
+	assert.True(t, p.Evaluate(claims, param).Allowed, "list claims pass if any element is allowed")
+
+	delete(claims, "account_status")
+	assert.False(t, p.Evaluate(claims, param).Allowed)
+
+	either, _, _ := ParsePolicy(`{"match": "any", "rules": [
+		{"claim": "realm_access.roles", "op": "contains", "value": "admin"},
+		{"claim": "scope", "op": "exists"}
+	]}`)
+	assert.True(t, either.Evaluate(map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"admin"}}}, param).Allowed)
+	assert.False(t, either.Evaluate(map[string]interface{}{"realm_access": map[string]interface{}{"roles": []interface{}{"agent"}}}, param).Allowed)
+}
@@ -0,0 +1,442 @@
+package breaker
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateOpen:
+		return "OPEN"
+	case StateHalfOpen:
+		return "HALF-OPEN"
+	default:
+		return "CLOSED"
+	}
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return util.Json.Marshal(s.String())
+}
+
+const (
+	ModeConsecutive = "consecutive"
+	ModeRate        = "rate"
+)
+
+var (
+	// ErrOpen is returned while the breaker rejects calls
+	ErrOpen = errors.New("circuit breaker is open")
+	// ErrTooManyProbes is returned while the half-open breaker already has its probe calls in flight
+	ErrTooManyProbes = errors.New("circuit breaker is half-open and waiting for probe calls")
+)
+
+// MaintenanceError is returned while an admin holds the breaker open
+type MaintenanceError struct {
+	Reason string
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Reason == "" {
+		return "service is under maintenance"
+	}
+	return "service is under maintenance: " + e.Reason
+}
+
+// IsRejected reports whether err means the breaker refused the call
+func IsRejected(err error) bool {
+	var maintenance *MaintenanceError
+	return errors.Is(err, ErrOpen) || errors.Is(err, ErrTooManyProbes) || errors.As(err, &maintenance)
+}
+
+// RejectionError is the response for a call the breaker refused
+func RejectionError(err error) *echo.HTTPError {
+	var maintenance *MaintenanceError
+	if errors.As(err, &maintenance) {
+		message := "Service under maintenance"
+		if maintenance.Reason != "" {
+			message += ": " + maintenance.Reason
+		}
+		return echo.NewHTTPError(http.StatusServiceUnavailable, message)
+	}
+	return echo.NewHTTPError(http.StatusServiceUnavailable, "Service temporarily unavailable (Circuit Breaker OPEN)")
+}
+
+const (
+	// ForceOpen keeps the breaker open until an admin closes or resets it
+	ForceOpen = "open"
+	// ForceClosed lets every call through until an admin opens or resets it
+	ForceClosed = "closed"
+)
+
+// Policy decides when a breaker opens and how it recovers
+type Policy struct {
+	Mode             string        `json:"mode"`               // "consecutive" or "rate"
+	Threshold        int           `json:"threshold"`          // Consecutive failures that open the breaker
+	FailureRate      float64       `json:"failure_rate"`       // Percentage of failed calls in the window that opens the breaker
+	MinRequests      int           `json:"min_requests"`       // Calls needed in the window before the failure rate counts
+	Window           util.Duration `json:"window"`             // Rolling window for the failure rate
+	OpenTimeout      util.Duration `json:"open_timeout"`       // How long the breaker stays open before probing
+	HalfOpenRequests int           `json:"half_open_requests"` // Probe calls allowed while half-open
+}
+
+// DefaultPolicy opens after 5 consecutive failures and probes again after 30 seconds
+func DefaultPolicy() Policy {
+	return Policy{
+		Mode:             ModeConsecutive,
+		Threshold:        5,
+		FailureRate:      50,
+		MinRequests:      10,
+		Window:           util.Duration(time.Minute),
+		OpenTimeout:      util.Duration(30 * time.Second),
+		HalfOpenRequests: 1,
+	}
+}
+
+func (p *Policy) Validate() error {
+	switch p.Mode {
+	case ModeConsecutive:
+		if p.Threshold < 1 {
+			return errors.New("threshold must be at least 1")
+		}
+	case ModeRate:
+		if p.FailureRate <= 0 || p.FailureRate > 100 {
+			return errors.New("failure_rate must be a percentage between 0 and 100")
+		}
+		if p.MinRequests < 1 {
+			return errors.New("min_requests must be at least 1")
+		}
+		if p.Window <= 0 {
+			return errors.New("window must be positive")
+		}
+	default:
+		return errors.New("mode must be \"consecutive\" or \"rate\"")
+	}
+	if p.OpenTimeout <= 0 {
+		return errors.New("open_timeout must be positive")
+	}
+	if p.HalfOpenRequests < 1 {
+		return errors.New("half_open_requests must be at least 1")
+	}
+	return nil
+}
+
+// Event is emitted whenever a breaker changes state
+type Event struct {
+	Key    string    `json:"key"`
+	From   State     `json:"from"`
+	To     State     `json:"to"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// Stats is a point-in-time view of a breaker
+type Stats struct {
+	Key                 string    `json:"key"`
+	State               State     `json:"state"`
+	TotalRequests       int64     `json:"total_requests"`
+	FailedRequests      int64     `json:"failed_requests"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	WindowRequests      int       `json:"window_requests"`
+	WindowFailures      int       `json:"window_failures"`
+	LastFailure         time.Time `json:"last_failure"`
+	LastTransition      time.Time `json:"last_transition"`
+	Forced              string    `json:"forced,omitempty"`
+	ForcedReason        string    `json:"forced_reason,omitempty"`
+	HealthScore         int       `json:"health_score"`
+	Policy              Policy    `json:"policy"`
+}
+
+const windowBuckets = 10
+
+type bucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// Breaker tracks the calls to one upstream (or one route of it) and stops calling it while it fails
+type Breaker struct {
+	key      string
+	registry *Registry
+	now      func() time.Time
+
+	mu                  sync.Mutex
+	policy              Policy
+	state               State
+	forced              string
+	forcedReason        string
+	generation          uint64
+	openedAt            time.Time
+	lastTransition      time.Time
+	consecutiveFailures int
+	probes              int
+	probeSuccesses      int
+	buckets             [windowBuckets]bucket
+	totalRequests       int64
+	failedRequests      int64
+	lastFailure         time.Time
+}
+
+// Allow asks to make a call. When it is allowed, done must be called once with the outcome.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	events := b.refresh()
+
+	switch {
+	case b.forced == ForceOpen:
+		reason := b.forcedReason
+		b.mu.Unlock()
+		return nil, &MaintenanceError{Reason: reason}
+	case b.forced == ForceClosed:
+	case b.state == StateOpen:
+		b.mu.Unlock()
+		b.emit(events)
+		return nil, ErrOpen
+	case b.state == StateHalfOpen:
+		if b.probes >= b.policy.HalfOpenRequests {
+			b.mu.Unlock()
+			b.emit(events)
+			return nil, ErrTooManyProbes
+		}
+		b.probes++
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.emit(events)
+
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.record(generation, success) })
+	}, nil
+}
+
+// State returns the current state, moving an expired open breaker to half-open
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	events := b.refresh()
+	state := b.state
+	b.mu.Unlock()
+	b.emit(events)
+	return state
+}
+
+// Stats returns counters and state of the breaker
+func (b *Breaker) Stats() Stats {
+	b.mu.Lock()
+	events := b.refresh()
+	requests, failures := b.windowCounts()
+	stats := Stats{
+		Key:                 b.key,
+		State:               b.state,
+		TotalRequests:       b.totalRequests,
+		FailedRequests:      b.failedRequests,
+		ConsecutiveFailures: b.consecutiveFailures,
+		WindowRequests:      requests,
+		WindowFailures:      failures,
+		LastFailure:         b.lastFailure,
+		LastTransition:      b.lastTransition,
+		Forced:              b.forced,
+		ForcedReason:        b.forcedReason,
+		HealthScore:         100,
+		Policy:              b.policy,
+	}
+	if b.totalRequests > 0 {
+		stats.HealthScore = int((b.totalRequests - b.failedRequests) * 100 / b.totalRequests)
+	}
+	b.mu.Unlock()
+	b.emit(events)
+	return stats
+}
+
+// SetPolicy replaces the policy while keeping the current state and counters
+func (b *Breaker) SetPolicy(policy Policy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.policy = policy
+}
+
+func (b *Breaker) record(generation uint64, success bool) {
+	b.mu.Lock()
+	now := b.now()
+
+	b.totalRequests++
+	current := b.bucketAt(now)
+	current.requests++
+	if success {
+		b.consecutiveFailures = 0
+	} else {
+		b.failedRequests++
+		b.consecutiveFailures++
+		b.lastFailure = now
+		current.failures++
+	}
+
+	// Results of calls started before the last transition say nothing about the new state,
+	// and a forced breaker only changes state when an admin says so
+	if generation != b.generation || b.forced != "" {
+		b.mu.Unlock()
+		return
+	}
+
+	var events []Event
+	switch b.state {
+	case StateHalfOpen:
+		b.probes--
+		if !success {
+			events = append(events, b.transition(StateOpen, "probe call failed"))
+		} else if b.probeSuccesses++; b.probeSuccesses >= b.policy.HalfOpenRequests {
+			events = append(events, b.transition(StateClosed, "probe calls succeeded"))
+		}
+	case StateClosed:
+		if !success {
+			if reason := b.tripReason(); reason != "" {
+				events = append(events, b.transition(StateOpen, reason))
+			}
+		}
+	}
+	b.mu.Unlock()
+	b.emit(events)
+}
+
+// tripReason returns why the closed breaker should open, or "" to stay closed
+func (b *Breaker) tripReason() string {
+	if b.policy.Mode == ModeRate {
+		requests, failures := b.windowCounts()
+		if requests >= b.policy.MinRequests && float64(failures)*100/float64(requests) >= b.policy.FailureRate {
+			return "failure rate exceeded"
+		}
+		return ""
+	}
+	if b.consecutiveFailures >= b.policy.Threshold {
+		return "consecutive failures exceeded"
+	}
+	return ""
+}
+
+// Force holds the breaker open (ForceOpen) or closed (ForceClosed) until Reset
+func (b *Breaker) Force(mode, reason string) error {
+	to := StateClosed
+	switch mode {
+	case ForceOpen:
+		to = StateOpen
+	case ForceClosed:
+	default:
+		return errors.New("force mode must be \"open\" or \"closed\"")
+	}
+
+	b.mu.Lock()
+	b.forced = mode
+	b.forcedReason = reason
+	var events []Event
+	if b.state != to {
+		events = append(events, b.transition(to, "forced "+mode+" by admin"))
+	}
+	b.mu.Unlock()
+	b.emit(events)
+	return nil
+}
+
+// Forced returns the mode and reason the breaker is forced with, if any
+func (b *Breaker) Forced() (mode, reason string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.forced, b.forcedReason
+}
+
+// Reset clears any forced state and all counters and closes the breaker
+func (b *Breaker) Reset() {
+	b.mu.Lock()
+	b.forced = ""
+	b.forcedReason = ""
+	var events []Event
+	if b.state != StateClosed {
+		events = append(events, b.transition(StateClosed, "reset by admin"))
+	}
+	b.consecutiveFailures = 0
+	b.totalRequests = 0
+	b.failedRequests = 0
+	b.buckets = [windowBuckets]bucket{}
+	b.mu.Unlock()
+	b.emit(events)
+}
+
+// refresh moves an open breaker to half-open once its timeout has passed
+func (b *Breaker) refresh() []Event {
+	if b.forced == "" && b.state == StateOpen && b.now().Sub(b.openedAt) >= time.Duration(b.policy.OpenTimeout) {
+		return []Event{b.transition(StateHalfOpen, "open timeout elapsed")}
+	}
+	return nil
+}
+
+// transition changes the state; callers hold the lock and emit the event after releasing it
+func (b *Breaker) transition(to State, reason string) Event {
+	now := b.now()
+	event := Event{Key: b.key, From: b.state, To: to, Reason: reason, At: now}
+
+	b.state = to
+	b.generation++
+	b.lastTransition = now
+	b.probes = 0
+	b.probeSuccesses = 0
+	switch to {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.consecutiveFailures = 0
+		b.buckets = [windowBuckets]bucket{}
+	}
+	return event
+}
+
+func (b *Breaker) bucketWidth() time.Duration {
+	width := time.Duration(b.policy.Window) / windowBuckets
+	if width <= 0 {
+		width = time.Second
+	}
+	return width
+}
+
+func (b *Breaker) bucketAt(now time.Time) *bucket {
+	width := b.bucketWidth()
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *Breaker) windowCounts() (requests, failures int) {
+	oldest := b.now().Add(-time.Duration(b.policy.Window))
+	for _, bk := range b.buckets {
+		if bk.start.After(oldest) {
+			requests += bk.requests
+			failures += bk.failures
+		}
+	}
+	return requests, failures
+}
+
+func (b *Breaker) emit(events []Event) {
+	if b.registry == nil {
+		return
+	}
+	for _, e := range events {
+		b.registry.publish(e)
+	}
+}
@@ -0,0 +1,209 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gorm.io/gorm"
+)
+
+func newTestBreaker(policy Policy) (*Breaker, *time.Time, *[]Event) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var events []Event
+
+	r := &Registry{breakers: make(map[string]*Breaker)}
+	r.Subscribe(func(e Event) { events = append(events, e) })
+	b := r.Get("service:1", policy)
+	b.now = func() time.Time { return now }
+	return b, &now, &events
+}
+
+func call(t *testing.T, b *Breaker, success bool) {
+	done, err := b.Allow()
+	if assert.NoError(t, err) {
+		done(success)
+	}
+}
+
+func TestConsecutiveFailuresOpenAndRecover(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Threshold = 3
+	policy.HalfOpenRequests = 2
+	b, now, events := newTestBreaker(policy)
+
+	call(t, b, false)
+	call(t, b, false)
+	call(t, b, true) // Resets the streak
+	call(t, b, false)
+	call(t, b, false)
+	assert.Equal(t, StateClosed, b.State())
+	call(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+
+	_, err := b.Allow()
+	assert.ErrorIs(t, err, ErrOpen)
+
+	*now = now.Add(30 * time.Second)
+	assert.Equal(t, StateHalfOpen, b.State())
+
+	// Only the configured number of probes get through
+	probe1, err := b.Allow()
+	assert.NoError(t, err)
+	probe2, err := b.Allow()
+	assert.NoError(t, err)
+	_, err = b.Allow()
+	assert.ErrorIs(t, err, ErrTooManyProbes)
+
+	probe1(true)
+	assert.Equal(t, StateHalfOpen, b.State())
+	probe2(true)
+	probe2(false) // Extra calls to done are ignored
+	assert.Equal(t, StateClosed, b.State())
+
+	var transitions []string
+	for _, e := range *events {
+		transitions = append(transitions, e.From.String()+"->"+e.To.String())
+	}
+	assert.Equal(t, []string{"CLOSED->OPEN", "OPEN->HALF-OPEN", "HALF-OPEN->CLOSED"}, transitions)
+}
+
+func TestFailureRateWithinWindow(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Mode = ModeRate
+	policy.FailureRate = 50
+	policy.MinRequests = 4
+	policy.Window = util.Duration(10 * time.Second)
+	b, now, _ := newTestBreaker(policy)
+
+	call(t, b, false)
+	call(t, b, false)
+	assert.Equal(t, StateClosed, b.State(), "below min_requests")
+
+	// Old failures fall out of the rolling window
+	*now = now.Add(11 * time.Second)
+	call(t, b, true)
+	call(t, b, true)
+	call(t, b, false)
+	assert.Equal(t, StateClosed, b.State())
+	call(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+
+	stats := b.Stats()
+	assert.Equal(t, 4, stats.WindowRequests)
+	assert.Equal(t, 2, stats.WindowFailures)
+	assert.Equal(t, int64(6), stats.TotalRequests)
+	assert.Equal(t, 33, stats.HealthScore)
+}
+
+func TestHalfOpenProbeFailureReopens(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Threshold = 1
+	b, now, _ := newTestBreaker(policy)
+
+	call(t, b, false)
+	*now = now.Add(time.Minute)
+	call(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+}
+
+func TestForceAndReset(t *testing.T) {
+	policy := DefaultPolicy()
+	policy.Threshold = 1
+	b, now, events := newTestBreaker(policy)
+
+	assert.NoError(t, b.Force(ForceOpen, "database upgrade"))
+	_, err := b.Allow()
+	assert.True(t, IsRejected(err))
+	assert.Equal(t, "Service under maintenance: database upgrade", RejectionError(err).Message)
+
+	// A forced breaker does not probe after the open timeout
+	*now = now.Add(time.Hour)
+	assert.Equal(t, StateOpen, b.State())
+
+	// Forced closed lets failures through without tripping
+	assert.NoError(t, b.Force(ForceClosed, ""))
+	call(t, b, false)
+	call(t, b, false)
+	assert.Equal(t, StateClosed, b.State())
+	assert.Equal(t, int64(2), b.Stats().FailedRequests)
+
+	b.Reset()
+	stats := b.Stats()
+	assert.Equal(t, "", stats.Forced)
+	assert.Equal(t, int64(0), stats.FailedRequests)
+	call(t, b, false)
+	assert.Equal(t, StateOpen, b.State())
+
+	if assert.Len(t, *events, 3) {
+		assert.Equal(t, "forced open by admin", (*events)[0].Reason)
+		assert.Equal(t, "forced closed by admin", (*events)[1].Reason)
+		assert.Equal(t, StateOpen, (*events)[2].To)
+	}
+
+	assert.Error(t, b.Force("sideways", ""))
+}
+
+func TestServiceIDFromKey(t *testing.T) {
+	id, ok := ServiceIDFromKey(RouteKey(7, "GET", "/users"))
+	assert.True(t, ok)
+	assert.Equal(t, uint(7), id)
+
+	_, ok = ServiceIDFromKey("global")
+	assert.False(t, ok)
+}
+
+func TestParsePolicy(t *testing.T) {
+	policy, err := ParsePolicy(`{"mode":"rate","failure_rate":25,"window":"30s"}`)
+	assert.NoError(t, err)
+	assert.Equal(t, 25.0, policy.FailureRate)
+	assert.Equal(t, util.Duration(30*time.Second), policy.Window)
+	assert.Equal(t, 5, policy.Threshold)
+
+	_, err = ParsePolicy(`{"treshold":3}`)
+	assert.Error(t, err)
+	_, err = ParsePolicy(`{"mode":"sometimes"}`)
+	assert.Error(t, err)
+}
+
+func TestForServiceKeepsPolicyUntilReload(t *testing.T) {
+	svc := database.Service{Model: gorm.Model{ID: 9001}, Name: "ledger", CircuitBreaker: `{"threshold":3}`}
+	assert.Equal(t, 3, ForService(svc).Stats().Policy.Threshold)
+
+	// Requests carry the service as loaded, the policy only changes when the gateway reloads
+	svc.CircuitBreaker = `{"threshold":7}`
+	assert.Equal(t, 3, ForService(svc).Stats().Policy.Threshold)
+	ConfigureService(svc)
+	assert.Equal(t, 7, ForService(svc).Stats().Policy.Threshold)
+}
+
+func TestApplyOverrides(t *testing.T) {
+	r := &Registry{breakers: make(map[string]*Breaker)}
+	forced := r.Get(ServiceKey(1), DefaultPolicy())
+	released := r.Get(ServiceKey(2), DefaultPolicy())
+	route := r.Get(RouteKey(2, "GET", "/users"), DefaultPolicy())
+	assert.NoError(t, released.Force(ForceOpen, "upgrade"))
+	assert.NoError(t, route.Force(ForceClosed, ""))
+
+	ApplyOverrides(r, []database.BreakerOverride{
+		{ServiceID: 1, Mode: ForceOpen, Reason: "migration"},
+		{ServiceID: 3, Mode: ForceOpen},
+	})
+
+	mode, reason := forced.Forced()
+	assert.Equal(t, ForceOpen, mode)
+	assert.Equal(t, "migration", reason)
+	assert.Equal(t, StateOpen, forced.Stats().State)
+
+	mode, _ = released.Forced()
+	assert.Empty(t, mode, "reset on another instance")
+	assert.Equal(t, StateClosed, released.Stats().State)
+
+	mode, _ = route.Forced()
+	assert.Equal(t, ForceClosed, mode, "route breakers are not overridden")
+
+	_, ok := r.Lookup(ServiceKey(3))
+	assert.False(t, ok)
+}
@@ -0,0 +1,38 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/labstack/echo/v4"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// IsFailure reports whether err means the upstream failed, as opposed to the caller
+// sending a bad request or giving up
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		return he.Code >= 500
+	}
+
+	if st, ok := status.FromError(err); ok {
+		// The REST client reports upstream HTTP statuses as status codes
+		if st.Code() >= 100 {
+			return st.Code() >= 500
+		}
+		switch st.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.DataLoss:
+			return true
+		}
+		return false
+	}
+
+	// Anything else is a transport level error
+	return true
+}
@@ -0,0 +1,148 @@
+package breaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+)
+
+// Registry holds the breakers of every service and route
+type Registry struct {
+	breakers  map[string]*Breaker
+	listeners []func(Event)
+	mu        sync.RWMutex
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	r := &Registry{breakers: make(map[string]*Breaker)}
+	r.Subscribe(func(e Event) {
+		log.Printf("Circuit breaker %s: %s -> %s (%s)", e.Key, e.From, e.To, e.Reason)
+	})
+	return r
+}
+
+// ServiceKey is the breaker key of an upstream service
+func ServiceKey(serviceID uint) string {
+	return fmt.Sprintf("service:%d", serviceID)
+}
+
+// RouteKey is the breaker key of a single route of an upstream service
+func RouteKey(serviceID uint, method, path string) string {
+	return fmt.Sprintf("service:%d route:%s %s", serviceID, method, path)
+}
+
+// Get returns the breaker for key, creating it with policy. An existing breaker keeps
+// its state and counters but picks up the policy, so config reloads do not reset it.
+func (r *Registry) Get(key string, policy Policy) *Breaker {
+	r.mu.RLock()
+	b, ok := r.breakers[key]
+	r.mu.RUnlock()
+	if ok {
+		b.SetPolicy(policy)
+		return b
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Double check
+	if b, ok = r.breakers[key]; ok {
+		b.SetPolicy(policy)
+		return b
+	}
+
+	b = &Breaker{
+		key:      key,
+		registry: r,
+		now:      time.Now,
+		policy:   policy,
+		state:    StateClosed,
+	}
+	r.breakers[key] = b
+	return b
+}
+
+// Lookup returns the breaker for key if it exists
+func (r *Registry) Lookup(key string) (*Breaker, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b, ok := r.breakers[key]
+	return b, ok
+}
+
+// All returns the stats of every breaker ordered by key
+func (r *Registry) All() []Stats {
+	r.mu.RLock()
+	breakers := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(breakers))
+	for _, b := range breakers {
+		stats = append(stats, b.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// Subscribe registers fn to be called on every state change
+func (r *Registry) Subscribe(fn func(Event)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+func (r *Registry) publish(e Event) {
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(e)
+	}
+}
+
+// ParsePolicy decodes a JSON policy on top of the defaults. An empty string yields the defaults.
+func ParsePolicy(raw string) (Policy, error) {
+	policy := DefaultPolicy()
+	if raw != "" {
+		dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&policy); err != nil {
+			return policy, err
+		}
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// ForService returns the service-level breaker. Its policy is parsed when the breaker is
+// created and again whenever the gateway reloads, through ConfigureService, not per call.
+func ForService(svc database.Service) *Breaker {
+	if b, ok := Default.Lookup(ServiceKey(svc.ID)); ok {
+		return b
+	}
+	return ConfigureService(svc)
+}
+
+// ConfigureService applies the service's circuit breaker policy to its breaker, creating the
+// breaker if needed. Invalid policies fall back to the defaults.
+func ConfigureService(svc database.Service) *Breaker {
+	policy, err := ParsePolicy(svc.CircuitBreaker)
+	if err != nil {
+		log.Printf("Service %s: invalid circuit breaker policy, using defaults: %v", svc.Name, err)
+		policy = DefaultPolicy()
+	}
+	return Default.Get(ServiceKey(svc.ID), policy)
+}
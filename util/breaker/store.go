@@ -0,0 +1,98 @@
+package breaker
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm/clause"
+)
+
+// ServiceIDFromKey returns the service a service or route breaker key belongs to
+func ServiceIDFromKey(key string) (uint, bool) {
+	var id uint
+	if _, err := fmt.Sscanf(key, "service:%d", &id); err != nil {
+		return 0, false
+	}
+	return id, true
+}
+
+// StoreEvent persists a state change so transitions can be audited after a restart
+func StoreEvent(e Event) {
+	serviceID, _ := ServiceIDFromKey(e.Key)
+	go func() {
+		db := database.GetDB()
+		event := &database.BreakerEvent{
+			Key:       e.Key,
+			ServiceID: serviceID,
+			From:      e.From.String(),
+			To:        e.To.String(),
+			Reason:    e.Reason,
+		}
+		event.CreatedAt = e.At
+		if err := db.Create(event).Error; err != nil {
+			log.Printf("Error recording circuit breaker event: %v", err)
+		}
+	}()
+}
+
+// SaveOverride persists a forced state of a service breaker, so it survives restarts and
+// reaches every instance
+func SaveOverride(ctx context.Context, serviceID uint, mode, reason, actor string) error {
+	row := database.BreakerOverride{ServiceID: serviceID, Mode: mode, Reason: reason, Actor: actor}
+	return database.GetDB().WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "service_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mode", "reason", "actor", "updated_at"}),
+	}).Create(&row).Error
+}
+
+// DeleteOverride removes the persisted forced state of a service breaker
+func DeleteOverride(ctx context.Context, serviceID uint) error {
+	return database.GetDB().WithContext(ctx).Delete(&database.BreakerOverride{}, serviceID).Error
+}
+
+// SyncOverrides brings the forced state of every service breaker in line with the persisted
+// overrides. Breakers forced on another instance are forced here too, and ones reset there
+// are reset here.
+func SyncOverrides() error {
+	var overrides []database.BreakerOverride
+	if err := database.GetDB().Find(&overrides).Error; err != nil {
+		return err
+	}
+	ApplyOverrides(Default, overrides)
+	return nil
+}
+
+// ApplyOverrides forces the service breakers of r that have an override and resets the
+// forced ones that no longer have one. Breakers not created yet are skipped.
+func ApplyOverrides(r *Registry, overrides []database.BreakerOverride) {
+	wanted := make(map[string]database.BreakerOverride, len(overrides))
+	for _, o := range overrides {
+		wanted[ServiceKey(o.ServiceID)] = o
+	}
+
+	r.mu.RLock()
+	breakers := make(map[string]*Breaker, len(r.breakers))
+	for key, b := range r.breakers {
+		breakers[key] = b
+	}
+	r.mu.RUnlock()
+
+	for key, b := range breakers {
+		// Only service breakers are forced, route breakers are left alone
+		if id, ok := ServiceIDFromKey(key); !ok || key != ServiceKey(id) {
+			continue
+		}
+		mode, reason := b.Forced()
+		o, ok := wanted[key]
+		switch {
+		case ok && (o.Mode != mode || o.Reason != reason):
+			if err := b.Force(o.Mode, o.Reason); err != nil {
+				log.Printf("Circuit breaker %s: ignoring override: %v", key, err)
+			}
+		case !ok && mode != "":
+			b.Reset()
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package bulkhead
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+var (
+	// ErrFull is returned when every slot and queue place is taken
+	ErrFull = errors.New("bulkhead full")
+	// ErrQueueTimeout is returned when a queued request did not get a slot in time
+	ErrQueueTimeout = errors.New("bulkhead queue timeout")
+)
+
+// Policy bounds the concurrent requests of a service or route
+type Policy struct {
+	MaxConcurrent int           `json:"max_concurrent"`
+	MaxQueue      int           `json:"max_queue"`     // Requests that may wait for a slot, 0 to reject at once
+	QueueTimeout  util.Duration `json:"queue_timeout"` // How long a queued request waits
+}
+
+// DefaultPolicy allows 100 concurrent requests and queues 50 more for up to a second
+func DefaultPolicy() Policy {
+	return Policy{MaxConcurrent: 100, MaxQueue: 50, QueueTimeout: util.Duration(time.Second)}
+}
+
+func (p *Policy) Validate() error {
+	if p.MaxConcurrent < 1 {
+		return errors.New("max_concurrent must be at least 1")
+	}
+	if p.MaxQueue < 0 {
+		return errors.New("max_queue must not be negative")
+	}
+	if p.MaxQueue > 0 && p.QueueTimeout <= 0 {
+		return errors.New("queue_timeout must be positive when requests are queued")
+	}
+	return nil
+}
+
+// Stats is a point in time view of a bulkhead
+type Stats struct {
+	Key           string `json:"key"`
+	MaxConcurrent int    `json:"max_concurrent"`
+	MaxQueue      int    `json:"max_queue"`
+	InFlight      int    `json:"in_flight"`
+	Queued        int    `json:"queued"`
+	Rejected      int64  `json:"rejected"`
+}
+
+// Bulkhead limits concurrent requests and queues the overflow in arrival order
+type Bulkhead struct {
+	key      string
+	policy   Policy
+	inFlight int
+	waiters  []chan struct{}
+	rejected int64
+	mu       sync.Mutex
+}
+
+// Acquire takes a slot, waiting in the queue if there is room. The returned function
+// gives the slot back and must be called once the request is done.
+func (b *Bulkhead) Acquire(ctx context.Context) (func(), error) {
+	b.mu.Lock()
+	if b.inFlight < b.policy.MaxConcurrent {
+		b.inFlight++
+		b.mu.Unlock()
+		return b.release, nil
+	}
+	if len(b.waiters) >= b.policy.MaxQueue {
+		b.rejected++
+		b.mu.Unlock()
+		return nil, ErrFull
+	}
+	ready := make(chan struct{})
+	b.waiters = append(b.waiters, ready)
+	timeout := time.Duration(b.policy.QueueTimeout)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var err error
+	select {
+	case <-ready:
+		return b.release, nil
+	case <-timer.C:
+		err = ErrQueueTimeout
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.dequeue(ready) {
+		// The slot was handed over while giving up, so use it
+		return b.release, nil
+	}
+	b.rejected++
+	return nil, err
+}
+
+// release hands the slot to the first queued request, or frees it
+func (b *Bulkhead) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight--
+	b.admit()
+}
+
+// admit moves queued requests into free slots
+func (b *Bulkhead) admit() {
+	for len(b.waiters) > 0 && b.inFlight < b.policy.MaxConcurrent {
+		ready := b.waiters[0]
+		b.waiters = b.waiters[1:]
+		b.inFlight++
+		close(ready)
+	}
+}
+
+// dequeue removes a waiter, reporting false if it was already admitted
+func (b *Bulkhead) dequeue(ready chan struct{}) bool {
+	for i, w := range b.waiters {
+		if w == ready {
+			b.waiters = append(b.waiters[:i], b.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// SetPolicy changes the limits, admitting queued requests if there are more slots.
+// Requests beyond a lowered limit finish normally.
+func (b *Bulkhead) SetPolicy(policy Policy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.policy = policy
+	b.admit()
+}
+
+func (b *Bulkhead) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return Stats{
+		Key:           b.key,
+		MaxConcurrent: b.policy.MaxConcurrent,
+		MaxQueue:      b.policy.MaxQueue,
+		InFlight:      b.inFlight,
+		Queued:        len(b.waiters),
+		Rejected:      b.rejected,
+	}
+}
@@ -0,0 +1,92 @@
+package bulkhead
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func TestAcquireQueuesAndRejects(t *testing.T) {
+	r := NewRegistry()
+	b := r.Get("service:1", Policy{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: util.Duration(time.Second)})
+
+	release, err := b.Acquire(context.Background())
+	assert.NoError(t, err)
+
+	queued := make(chan error)
+	go func() {
+		release, err := b.Acquire(context.Background())
+		if err == nil {
+			defer release()
+		}
+		queued <- err
+	}()
+	assert.Eventually(t, func() bool { return b.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// The queue is full as well
+	_, err = b.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrFull)
+
+	release()
+	assert.NoError(t, <-queued)
+	assert.Equal(t, Stats{Key: "service:1", MaxConcurrent: 1, MaxQueue: 1, Rejected: 1}, b.Stats())
+}
+
+func TestAcquireQueueTimeout(t *testing.T) {
+	b := NewRegistry().Get("service:1", Policy{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: util.Duration(10 * time.Millisecond)})
+
+	release, err := b.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	_, err = b.Acquire(context.Background())
+	assert.ErrorIs(t, err, ErrQueueTimeout)
+	assert.Equal(t, 0, b.Stats().Queued)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = b.Acquire(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestSetPolicyAdmitsQueued(t *testing.T) {
+	r := NewRegistry()
+	policy := Policy{MaxConcurrent: 1, MaxQueue: 1, QueueTimeout: util.Duration(time.Second)}
+	b := r.Get("service:1", policy)
+
+	release, err := b.Acquire(context.Background())
+	assert.NoError(t, err)
+	defer release()
+
+	admitted := make(chan error)
+	go func() {
+		_, err := b.Acquire(context.Background())
+		admitted <- err
+	}()
+	assert.Eventually(t, func() bool { return b.Stats().Queued == 1 }, time.Second, time.Millisecond)
+
+	// Reloading with more slots lets the queued request in and keeps the one in flight
+	policy.MaxConcurrent = 2
+	assert.Same(t, b, r.Get("service:1", policy))
+	assert.NoError(t, <-admitted)
+	assert.Equal(t, 2, b.Stats().InFlight)
+}
+
+func TestParsePolicy(t *testing.T) {
+	_, ok, err := ParsePolicy("")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	policy, ok, err := ParsePolicy(`{"max_concurrent": 20, "max_queue": 0}`)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Policy{MaxConcurrent: 20, QueueTimeout: util.Duration(time.Second)}, policy)
+
+	_, _, err = ParsePolicy(`{"max_concurrent": 0}`)
+	assert.Error(t, err)
+	_, _, err = ParsePolicy(`{"limit": 5}`)
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package bulkhead
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+)
+
+// Registry holds the bulkheads of every service and route, keyed like their circuit breakers
+type Registry struct {
+	bulkheads map[string]*Bulkhead
+	mu        sync.RWMutex
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{bulkheads: make(map[string]*Bulkhead)}
+}
+
+// Get returns the bulkhead for key, creating it with policy. An existing bulkhead keeps
+// its requests but picks up the policy, so config reloads do not drop them.
+func (r *Registry) Get(key string, policy Policy) *Bulkhead {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if b, ok := r.bulkheads[key]; ok {
+		b.SetPolicy(policy)
+		return b
+	}
+	b := &Bulkhead{key: key, policy: policy}
+	r.bulkheads[key] = b
+	return b
+}
+
+// Lookup returns the bulkhead for key if one exists
+func (r *Registry) Lookup(key string) (*Bulkhead, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	b, ok := r.bulkheads[key]
+	return b, ok
+}
+
+// All returns the stats of every bulkhead ordered by key
+func (r *Registry) All() []Stats {
+	r.mu.RLock()
+	bulkheads := make([]*Bulkhead, 0, len(r.bulkheads))
+	for _, b := range r.bulkheads {
+		bulkheads = append(bulkheads, b)
+	}
+	r.mu.RUnlock()
+
+	stats := make([]Stats, 0, len(bulkheads))
+	for _, b := range bulkheads {
+		stats = append(stats, b.Stats())
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Key < stats[j].Key })
+	return stats
+}
+
+// ParsePolicy decodes a JSON policy on top of the defaults. An empty string means the
+// service has no bulkhead and ok is false.
+func ParsePolicy(raw string) (policy Policy, ok bool, err error) {
+	if raw == "" {
+		return policy, false, nil
+	}
+	policy = DefaultPolicy()
+	dec := json.NewDecoder(bytes.NewReader([]byte(raw)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&policy); err != nil {
+		return policy, false, err
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, false, err
+	}
+	return policy, true, nil
+}
@@ -0,0 +1,150 @@
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached upstream response
+type Entry struct {
+	Key        string
+	Route      string // Method and path pattern of the route that stored it
+	Status     int
+	Header     http.Header
+	Body       []byte
+	StoredAt   time.Time
+	FreshUntil time.Time
+	StaleUntil time.Time // Served while revalidating until then
+}
+
+// Fresh reports whether the entry can be served without revalidation
+func (e *Entry) Fresh(now time.Time) bool {
+	return now.Before(e.FreshUntil)
+}
+
+// Usable reports whether the entry can still be served, fresh or stale
+func (e *Entry) Usable(now time.Time) bool {
+	return now.Before(e.StaleUntil) || e.Fresh(now)
+}
+
+// Store is a bounded in-memory cache that evicts the least recently used entry
+type Store struct {
+	capacity     int
+	entries      map[string]*list.Element
+	order        *list.List
+	revalidating map[string]bool
+	mu           sync.Mutex
+}
+
+// RouteName names a route in entries, purges and metrics
+func RouteName(method, path string) string {
+	return method + " " + path
+}
+
+// Default is the cache shared by every route
+var Default = NewStore(10000)
+
+// Fallback keeps the last good responses that stale fallbacks serve
+var Fallback = NewStore(10000)
+
+func NewStore(capacity int) *Store {
+	return &Store{
+		capacity:     capacity,
+		entries:      make(map[string]*list.Element),
+		order:        list.New(),
+		revalidating: make(map[string]bool),
+	}
+}
+
+// Get returns the entry for key if it can still be served
+func (s *Store) Get(key string, now time.Time) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*Entry)
+	if !entry.Usable(now) {
+		s.remove(el)
+		return nil, false
+	}
+	s.order.MoveToFront(el)
+	return entry, true
+}
+
+// Set stores entry, evicting the least recently used entries beyond capacity
+func (s *Store) Set(entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[entry.Key]; ok {
+		el.Value = entry
+		s.order.MoveToFront(el)
+		return
+	}
+	s.entries[entry.Key] = s.order.PushFront(entry)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+}
+
+// PurgePrefix removes every entry whose key starts with prefix and returns how many were removed
+func (s *Store) PurgePrefix(prefix string) int {
+	return s.purge(func(e *Entry) bool { return strings.HasPrefix(e.Key, prefix) })
+}
+
+// PurgeRoute removes every entry stored by route
+func (s *Store) PurgeRoute(route string) int {
+	return s.purge(func(e *Entry) bool { return e.Route == route })
+}
+
+// Len returns the number of entries
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.order.Len()
+}
+
+// StartRevalidation claims the refresh of a stale key. It returns false while another refresh runs.
+func (s *Store) StartRevalidation(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.revalidating[key] {
+		return false
+	}
+	s.revalidating[key] = true
+	return true
+}
+
+// FinishRevalidation releases the refresh claimed by StartRevalidation
+func (s *Store) FinishRevalidation(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.revalidating, key)
+}
+
+func (s *Store) purge(match func(e *Entry) bool) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for el := s.order.Front(); el != nil; {
+		next := el.Next()
+		if match(el.Value.(*Entry)) {
+			s.remove(el)
+			n++
+		}
+		el = next
+	}
+	return n
+}
+
+func (s *Store) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*Entry).Key)
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Now()
+	s := NewStore(2)
+	entry := func(key string) *Entry {
+		return &Entry{Key: key, Route: "GET /ref/:kind", FreshUntil: now.Add(time.Minute), StaleUntil: now.Add(time.Minute)}
+	}
+
+	s.Set(entry("GET /ref/provinces"))
+	s.Set(entry("GET /ref/cities"))
+	_, ok := s.Get("GET /ref/provinces", now) // Now the most recently used
+	assert.True(t, ok)
+	s.Set(entry("GET /ref/districts"))
+
+	_, ok = s.Get("GET /ref/cities", now)
+	assert.False(t, ok)
+	assert.Equal(t, 2, s.Len())
+
+	// Expired entries are dropped on lookup
+	_, ok = s.Get("GET /ref/provinces", now.Add(2*time.Minute))
+	assert.False(t, ok)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestStorePurge(t *testing.T) {
+	now := time.Now()
+	s := NewStore(10)
+	for _, key := range []string{"GET /ref/provinces", "GET /ref/cities?province=1", "GET /users/1"} {
+		s.Set(&Entry{Key: key, Route: "GET /ref/:kind", FreshUntil: now.Add(time.Minute)})
+	}
+	s.Set(&Entry{Key: "GET /users/2", Route: "GET /users/:id", FreshUntil: now.Add(time.Minute)})
+
+	assert.Equal(t, 2, s.PurgePrefix("GET /ref/"))
+	assert.Equal(t, 1, s.PurgeRoute("GET /users/:id"))
+	assert.Equal(t, 1, s.Len())
+}
@@ -10,7 +10,10 @@ import (
 	"net/http"
 
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/deadline"
 	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/errors"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/gatewayauth"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/hedge"
 	"google.golang.org/grpc/codes"
 )
 
@@ -80,7 +83,7 @@ func (a *RestClient) CallAPI(ctx context.Context, method, url string, payload ma
 
 	req.Header.Set("x-api-key", a.APIKey)
 
-	client := &http.Client{}
+	client := &http.Client{Transport: &gatewayauth.Transport{Next: &deadline.Transport{Next: hedge.Transport}}}
 	resp, err := client.Do(req)
 	if err != nil {
 		log.Println("Error sending request:", err)
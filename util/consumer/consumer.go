@@ -0,0 +1,269 @@
+// Package consumer authenticates API keys and the consumers they belong to
+package consumer
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidKey = errors.New("invalid API key")
+	ErrExpired    = errors.New("API key expired")
+	ErrRevoked    = errors.New("API key revoked")
+	ErrDisabled   = errors.New("consumer disabled")
+)
+
+// KeyPrefix starts every API key the gateway issues
+const KeyPrefix = "gw_"
+
+// DefaultCacheTTL bounds how long a revoked key or disabled consumer keeps working on other instances
+const DefaultCacheTTL = 30 * time.Second
+
+// maxCached keeps made up keys from growing the cache without bound
+const maxCached = 10000
+
+// GenerateKey returns a new random API key with its display prefix and hash
+func GenerateKey() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = KeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:len(KeyPrefix)+8], Hash(key), nil
+}
+
+// Hash is what is stored of a key. Keys are random, so a fast hash is enough.
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Identity is the consumer an API key belongs to
+type Identity struct {
+	ConsumerID    uint
+	Consumer      string
+	KeyID         uint
+	Scopes        []string
+	AllowedRoutes []string
+	Priority      string // Load shedding priority, empty for normal
+}
+
+// HasScopes reports whether the consumer was granted every required scope
+func (i Identity) HasScopes(required []string) bool {
+	for _, r := range required {
+		if !contains(i.Scopes, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsRoute reports whether the consumer may call the route, named by its tag or as "METHOD /path"
+func (i Identity) AllowsRoute(method, path, tag string) bool {
+	if len(i.AllowedRoutes) == 0 {
+		return true
+	}
+	return contains(i.AllowedRoutes, method+" "+path) || (tag != "" && contains(i.AllowedRoutes, tag))
+}
+
+// Authenticator looks API keys up, caching the result briefly so every request does not hit the database
+type Authenticator struct {
+	find         func(ctx context.Context, hash string) (*database.ConsumerKey, error)
+	findConsumer func(ctx context.Context, name string) (*database.Consumer, error)
+	touch        func(keyID uint, at time.Time)
+	ttl          time.Duration
+	cache        map[string]cached
+	secrets      map[string]cachedSecret
+	mu           sync.Mutex
+	now          func() time.Time
+}
+
+type cachedSecret struct {
+	identity Identity
+	secret   []byte
+	err      error
+	fetched  time.Time
+}
+
+type cached struct {
+	identity  Identity
+	expiresAt *time.Time
+	err       error
+	fetched   time.Time
+}
+
+// Default authenticates the keys of the api-key middleware. It is set up in main.
+var Default *Authenticator
+
+// NewAuthenticator looks keys up in the consumer_keys table, caching them for ttl
+func NewAuthenticator(db *gorm.DB, ttl time.Duration) *Authenticator {
+	a := newAuthenticator(ttl)
+	a.find = func(ctx context.Context, hash string) (*database.ConsumerKey, error) {
+		var row database.ConsumerKey
+		if err := db.WithContext(ctx).Preload("Consumer").Where("hash = ?", hash).First(&row).Error; err != nil {
+			return nil, err
+		}
+		return &row, nil
+	}
+	a.findConsumer = func(ctx context.Context, name string) (*database.Consumer, error) {
+		var row database.Consumer
+		if err := db.WithContext(ctx).Where("name = ?", name).First(&row).Error; err != nil {
+			return nil, err
+		}
+		return &row, nil
+	}
+	a.touch = func(keyID uint, at time.Time) {
+		db.Model(&database.ConsumerKey{}).Where("id = ?", keyID).UpdateColumn("last_used_at", at)
+	}
+	return a
+}
+
+func newAuthenticator(ttl time.Duration) *Authenticator {
+	return &Authenticator{ttl: ttl, cache: make(map[string]cached), secrets: make(map[string]cachedSecret), now: time.Now}
+}
+
+// Authenticate returns the identity of a valid key
+func (a *Authenticator) Authenticate(ctx context.Context, key string) (Identity, error) {
+	hash := Hash(key)
+	now := a.now()
+
+	a.mu.Lock()
+	entry, ok := a.cache[hash]
+	a.mu.Unlock()
+	if !ok || now.Sub(entry.fetched) >= a.ttl {
+		var err error
+		if entry, err = a.load(ctx, hash, now); err != nil {
+			return Identity{}, err
+		}
+		a.mu.Lock()
+		if len(a.cache) >= maxCached {
+			a.cache = make(map[string]cached)
+		}
+		a.cache[hash] = entry
+		a.mu.Unlock()
+	}
+
+	if entry.err != nil {
+		return Identity{}, entry.err
+	}
+	if entry.expiresAt != nil && !now.Before(*entry.expiresAt) {
+		return Identity{}, ErrExpired
+	}
+	return entry.identity, nil
+}
+
+// load reads the key from the database. Unknown, revoked and disabled keys are cached like valid
+// ones, only failing to query the database is returned as an error.
+func (a *Authenticator) load(ctx context.Context, hash string, now time.Time) (cached, error) {
+	entry := cached{fetched: now}
+	row, err := a.find(ctx, hash)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return entry, err
+		}
+		entry.err = ErrInvalidKey
+		return entry, nil
+	}
+
+	switch {
+	case row.Revoked:
+		entry.err = ErrRevoked
+	case row.Consumer.ID == 0 || row.Consumer.Disabled:
+		entry.err = ErrDisabled
+	}
+	entry.expiresAt = row.ExpiresAt
+	entry.identity = Identity{
+		ConsumerID:    row.Consumer.ID,
+		Consumer:      row.Consumer.Name,
+		KeyID:         row.ID,
+		Scopes:        Split(row.Consumer.Scopes),
+		AllowedRoutes: Split(row.Consumer.AllowedRoutes),
+		Priority:      row.Consumer.Priority,
+	}
+
+	if entry.err == nil {
+		// Once per cache refresh is precise enough and keeps writes off the request path
+		go a.touch(row.ID, now)
+	}
+	return entry, nil
+}
+
+// SigningSecret returns the consumer a signed request names and its signing secret. Unknown
+// consumers and consumers without a secret get ErrInvalidKey, disabled ones ErrDisabled.
+func (a *Authenticator) SigningSecret(ctx context.Context, name string) (Identity, []byte, error) {
+	now := a.now()
+	a.mu.Lock()
+	entry, ok := a.secrets[name]
+	a.mu.Unlock()
+	if ok && now.Sub(entry.fetched) < a.ttl {
+		return entry.identity, entry.secret, entry.err
+	}
+
+	entry = cachedSecret{fetched: now}
+	row, err := a.findConsumer(ctx, name)
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		entry.err = ErrInvalidKey
+	case err != nil:
+		return Identity{}, nil, err
+	case row.Disabled:
+		entry.err = ErrDisabled
+	case row.SigningSecret == "":
+		entry.err = ErrInvalidKey
+	default:
+		entry.secret = []byte(row.SigningSecret)
+		entry.identity = Identity{
+			ConsumerID:    row.ID,
+			Consumer:      row.Name,
+			Scopes:        Split(row.Scopes),
+			AllowedRoutes: Split(row.AllowedRoutes),
+			Priority:      row.Priority,
+		}
+	}
+
+	a.mu.Lock()
+	if len(a.secrets) >= maxCached {
+		a.secrets = make(map[string]cachedSecret)
+	}
+	a.secrets[name] = entry
+	a.mu.Unlock()
+	return entry.identity, entry.secret, entry.err
+}
+
+// Invalidate forgets every cached key and secret, so changes made through this instance apply at once
+func (a *Authenticator) Invalidate() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.cache = make(map[string]cached)
+	a.secrets = make(map[string]cachedSecret)
+}
+
+// Split reads a comma separated list, dropping blanks
+func Split(s string) []string {
+	var out []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package consumer
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+)
+
+func TestGenerateKey(t *testing.T) {
+	key, prefix, hash, err := GenerateKey()
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, KeyPrefix))
+	assert.True(t, strings.HasPrefix(key, prefix))
+	assert.Equal(t, Hash(key), hash)
+	assert.NotContains(t, hash, key)
+
+	other, _, _, err := GenerateKey()
+	require.NoError(t, err)
+	assert.NotEqual(t, key, other)
+}
+
+func TestIdentity(t *testing.T) {
+	id := Identity{Scopes: []string{"read", "write"}, AllowedRoutes: Split("payments, GET /api/status")}
+	assert.True(t, id.HasScopes(nil))
+	assert.True(t, id.HasScopes([]string{"read", "write"}))
+	assert.False(t, id.HasScopes([]string{"admin"}))
+
+	assert.True(t, id.AllowsRoute("POST", "/api/pay", "payments"))
+	assert.True(t, id.AllowsRoute("GET", "/api/status", ""))
+	assert.False(t, id.AllowsRoute("POST", "/api/status", ""))
+	assert.True(t, Identity{}.AllowsRoute("DELETE", "/api/anything", ""))
+}
+
+func TestAuthenticate(t *testing.T) {
+	now := time.Now()
+	expired := now.Add(-time.Minute)
+	keys := map[string]*database.ConsumerKey{
+		"valid":    {Consumer: database.Consumer{Model: gorm.Model{ID: 1}, Name: "partner", Scopes: "read", Priority: "high"}},
+		"revoked":  {Consumer: database.Consumer{Model: gorm.Model{ID: 1}, Name: "partner"}, Revoked: true},
+		"expired":  {Consumer: database.Consumer{Model: gorm.Model{ID: 1}, Name: "partner"}, ExpiresAt: &expired},
+		"disabled": {Consumer: database.Consumer{Model: gorm.Model{ID: 2}, Name: "old", Disabled: true}},
+		"deleted":  {},
+	}
+	lookups := 0
+	a := newAuthenticator(time.Minute)
+	a.now = func() time.Time { return now }
+	a.touch = func(uint, time.Time) {}
+	a.find = func(ctx context.Context, hash string) (*database.ConsumerKey, error) {
+		lookups++
+		for key, row := range keys {
+			if Hash(key) == hash {
+				return row, nil
+			}
+		}
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	id, err := a.Authenticate(context.Background(), "valid")
+	require.NoError(t, err)
+	assert.Equal(t, "partner", id.Consumer)
+	assert.Equal(t, []string{"read"}, id.Scopes)
+	assert.Equal(t, "high", id.Priority)
+
+	for key, want := range map[string]error{"revoked": ErrRevoked, "expired": ErrExpired, "disabled": ErrDisabled, "deleted": ErrDisabled, "unknown": ErrInvalidKey} {
+		_, err := a.Authenticate(context.Background(), key)
+		assert.ErrorIs(t, err, want, key)
+	}
+	assert.Equal(t, 6, lookups)
+
+	// Results are cached until the TTL runs out or the cache is invalidated
+	_, err = a.Authenticate(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	assert.Equal(t, 6, lookups)
+
+	keys["valid"].Revoked = true
+	_, err = a.Authenticate(context.Background(), "valid")
+	assert.NoError(t, err)
+	a.Invalidate()
+	_, err = a.Authenticate(context.Background(), "valid")
+	assert.ErrorIs(t, err, ErrRevoked)
+}
+
+func TestSigningSecret(t *testing.T) {
+	consumers := map[string]*database.Consumer{
+		"acme":     {Name: "acme", SigningSecret: "s3cret", Scopes: "payments, reports", AllowedRoutes: "pay"},
+		"unsigned": {Name: "unsigned"},
+		"old":      {Name: "old", SigningSecret: "s3cret", Disabled: true},
+	}
+	a := newAuthenticator(time.Minute)
+	a.findConsumer = func(ctx context.Context, name string) (*database.Consumer, error) {
+		if c, ok := consumers[name]; ok {
+			return c, nil
+		}
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	identity, secret, err := a.SigningSecret(context.Background(), "acme")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("s3cret"), secret)
+	assert.Equal(t, "acme", identity.Consumer)
+	assert.True(t, identity.HasScopes([]string{"reports"}))
+	assert.False(t, identity.AllowsRoute("GET", "/api/balance", "balance"))
+
+	_, _, err = a.SigningSecret(context.Background(), "unsigned")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+	_, _, err = a.SigningSecret(context.Background(), "old")
+	assert.ErrorIs(t, err, ErrDisabled)
+	_, _, err = a.SigningSecret(context.Background(), "nobody")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
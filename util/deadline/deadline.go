@@ -0,0 +1,41 @@
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type contextKey struct{}
+
+// WithHeader makes Transport tell upstreams how many milliseconds are left before ctx's
+// deadline, in the header called name
+func WithHeader(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// Header returns the header name ctx was given with WithHeader
+func Header(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(contextKey{}).(string)
+	return name, ok && name != ""
+}
+
+// Transport sets the deadline header on requests whose context names one and has a
+// deadline. The time left is measured when each attempt is sent.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	name, ok := Header(ctx)
+	deadline, hasDeadline := ctx.Deadline()
+	if !ok || !hasDeadline {
+		return t.Next.RoundTrip(req)
+	}
+	// RoundTrippers must not modify the request
+	req = req.Clone(ctx)
+	req.Header.Set(name, strconv.FormatInt(time.Until(deadline).Milliseconds(), 10))
+	return t.Next.RoundTrip(req)
+}
@@ -0,0 +1,44 @@
+package deadline
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	var forwarded []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		forwarded = append(forwarded, r.Header.Get("X-Request-Deadline"))
+	}))
+	defer upstream.Close()
+
+	client := &http.Client{Transport: &Transport{Next: http.DefaultTransport}}
+	call := func(ctx context.Context) {
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+		res, err := client.Do(req)
+		if assert.NoError(t, err) {
+			res.Body.Close()
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	call(ctx)
+	call(WithHeader(context.Background(), "X-Request-Deadline"))
+	call(WithHeader(ctx, "X-Request-Deadline"))
+
+	if assert.Len(t, forwarded, 3) {
+		assert.Empty(t, forwarded[0], "no header was asked for")
+		assert.Empty(t, forwarded[1], "no deadline to forward")
+		ms, err := strconv.Atoi(forwarded[2])
+		if assert.NoError(t, err) {
+			assert.True(t, ms > 1000 && ms <= 2000, "forwarded %dms", ms)
+		}
+	}
+}
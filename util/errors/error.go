@@ -1,6 +1,10 @@
 package errors
 
 import (
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -12,7 +16,7 @@ func ErrNotFound(model string) error {
 
 // ErrBadRequest is for something that bad request
 func ErrBadRequest(msg string) error {
-	return status.Errorf(400, msg)
+	return status.Error(400, msg)
 }
 
 func DuplicateTransaction() error {
@@ -20,5 +24,13 @@ func DuplicateTransaction() error {
 }
 
 func ErrorMap(code codes.Code, msg string) error {
-	return status.Errorf(code, msg)
+	return status.Error(code, msg)
+}
+
+// GRPCToHTTP turns the error of a gRPC call into the gateway response for a failed upstream
+func GRPCToHTTP(err error) *echo.HTTPError {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.DeadlineExceeded {
+		return echo.NewHTTPError(http.StatusGatewayTimeout, "Gateway Timeout")
+	}
+	return echo.NewHTTPError(http.StatusBadGateway, fmt.Sprintf("gRPC call failed: %v", err))
 }
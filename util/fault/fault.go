@@ -0,0 +1,155 @@
+package fault
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	grpcerrors "gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	TypeLatency  = "latency"
+	TypeAbort    = "abort"
+	TypeCorrupt  = "corrupt"
+	TypeTruncate = "truncate"
+)
+
+// DefaultTTL is how long a fault created without an expiry stays active
+const DefaultTTL = time.Hour
+
+// Message is the error message of aborted requests
+const Message = "Fault injected"
+
+// Fault is a validated fault ready to be injected
+type Fault struct {
+	ID          uint
+	Name        string
+	RouteID     uint
+	Type        string
+	Percentage  float64
+	Delay       time.Duration
+	Status      int
+	GRPCCode    codes.Code
+	HeaderName  string
+	HeaderValue string
+	ExpiresAt   time.Time
+}
+
+// FromModel validates a stored fault
+func FromModel(m database.Fault) (Fault, error) {
+	f := Fault{
+		ID:          m.ID,
+		Name:        m.Name,
+		RouteID:     m.RouteID,
+		Type:        m.Type,
+		Percentage:  m.Percentage,
+		Status:      m.Status,
+		HeaderName:  m.HeaderName,
+		HeaderValue: m.HeaderValue,
+		ExpiresAt:   m.ExpiresAt,
+	}
+	if f.RouteID == 0 {
+		return f, errors.New("route_id is required")
+	}
+	if f.Percentage <= 0 || f.Percentage > 100 {
+		return f, errors.New("percentage must be above 0 and at most 100")
+	}
+	if f.ExpiresAt.IsZero() {
+		return f, errors.New("expires_at is required")
+	}
+
+	switch f.Type {
+	case TypeLatency:
+		d, err := time.ParseDuration(m.Delay)
+		if err != nil || d <= 0 {
+			return f, fmt.Errorf("delay must be a positive duration such as \"2s\"")
+		}
+		f.Delay = d
+	case TypeAbort:
+		if m.GRPCCode != "" {
+			if err := f.GRPCCode.UnmarshalJSON([]byte(strconv.Quote(strings.ToUpper(m.GRPCCode)))); err != nil || f.GRPCCode == codes.OK {
+				return f, fmt.Errorf("unknown gRPC code %q", m.GRPCCode)
+			}
+		} else if f.Status < 400 || f.Status > 599 {
+			return f, errors.New("status must be an HTTP error status, or grpc_code must be set")
+		} else if !util.KeepsHTTPStatus(f.Status) {
+			// Abort fails like the upstream would, with an echo.HTTPError the route's middleware can read
+			return f, fmt.Errorf("status %d would reach the client as another status, use one the gateway maps such as 429, 500 or 503", f.Status)
+		}
+	case TypeCorrupt, TypeTruncate:
+	default:
+		return f, errors.New("type must be \"latency\", \"abort\", \"corrupt\" or \"truncate\"")
+	}
+	return f, nil
+}
+
+// Active reports whether the fault has not expired yet
+func (f Fault) Active(now time.Time) bool {
+	return now.Before(f.ExpiresAt)
+}
+
+// Matches reports whether the fault is injected into the request. Requests with the
+// configured header are picked at random with the fault's percentage.
+func (f Fault) Matches(req *http.Request, now time.Time) bool {
+	if !f.Active(now) {
+		return false
+	}
+	if f.HeaderName != "" {
+		value := req.Header.Get(f.HeaderName)
+		if value == "" || (f.HeaderValue != "" && value != f.HeaderValue) {
+			return false
+		}
+	}
+	return f.Percentage >= 100 || rand.Float64()*100 < f.Percentage
+}
+
+// Abort is the error an aborted request fails with. A gRPC code fails the request the way
+// the upstream call failing with that status would.
+func (f Fault) Abort() error {
+	if f.GRPCCode != codes.OK {
+		return grpcerrors.GRPCToHTTP(status.Error(f.GRPCCode, Message))
+	}
+	return echo.NewHTTPError(f.Status, Message)
+}
+
+// Mangle corrupts or truncates a response body
+func (f Fault) Mangle(body []byte) []byte {
+	switch f.Type {
+	case TypeTruncate:
+		return body[:len(body)/2]
+	case TypeCorrupt:
+		out := append([]byte(nil), body...)
+		for i := 0; i < len(out)/100+1 && len(out) > 0; i++ {
+			out[rand.Intn(len(out))] = byte(rand.Intn(256))
+		}
+		return out
+	}
+	return body
+}
+
+// String describes the fault for the trace
+func (f Fault) String() string {
+	switch f.Type {
+	case TypeLatency:
+		return fmt.Sprintf("fault %s: added %s latency", f.Name, f.Delay)
+	case TypeAbort:
+		if f.GRPCCode != codes.OK {
+			return fmt.Sprintf("fault %s: aborted with gRPC %s", f.Name, f.GRPCCode)
+		}
+		return fmt.Sprintf("fault %s: aborted with %d", f.Name, f.Status)
+	case TypeCorrupt:
+		return fmt.Sprintf("fault %s: corrupted response body", f.Name)
+	default:
+		return fmt.Sprintf("fault %s: truncated response body", f.Name)
+	}
+}
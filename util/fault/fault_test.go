@@ -0,0 +1,70 @@
+package fault
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"google.golang.org/grpc/codes"
+)
+
+func TestFromModel(t *testing.T) {
+	expires := time.Now().Add(time.Hour)
+
+	f, err := FromModel(database.Fault{Name: "slow", RouteID: 1, Type: TypeLatency, Percentage: 50, Delay: "2s", ExpiresAt: expires})
+	if assert.NoError(t, err) {
+		assert.Equal(t, 2*time.Second, f.Delay)
+	}
+
+	f, err = FromModel(database.Fault{Name: "down", RouteID: 1, Type: TypeAbort, Percentage: 10, GRPCCode: "unavailable", ExpiresAt: expires})
+	if assert.NoError(t, err) {
+		assert.Equal(t, codes.Unavailable, f.GRPCCode)
+	}
+	_, err = FromModel(database.Fault{Name: "broken", RouteID: 1, Type: TypeAbort, Percentage: 10, Status: 500, ExpiresAt: expires})
+	assert.NoError(t, err)
+
+	for _, m := range []database.Fault{
+		{RouteID: 1, Type: TypeLatency, Percentage: 50, Delay: "soon", ExpiresAt: expires},
+		{RouteID: 1, Type: TypeAbort, Percentage: 50, Status: 200, ExpiresAt: expires},
+		{RouteID: 1, Type: TypeAbort, Percentage: 50, Status: 400, ExpiresAt: expires},
+		{RouteID: 1, Type: TypeAbort, Percentage: 50, Status: 418, ExpiresAt: expires},
+		{RouteID: 1, Type: TypeAbort, Percentage: 50, Status: 501, ExpiresAt: expires},
+		{RouteID: 1, Type: TypeAbort, Percentage: 50, GRPCCode: "BROKEN", ExpiresAt: expires},
+		{RouteID: 1, Type: TypeCorrupt, Percentage: 0, ExpiresAt: expires},
+		{RouteID: 1, Type: TypeTruncate, Percentage: 100},
+		{RouteID: 1, Type: "explode", Percentage: 100, ExpiresAt: expires},
+		{Type: TypeCorrupt, Percentage: 100, ExpiresAt: expires},
+	} {
+		_, err := FromModel(m)
+		assert.Error(t, err, "%+v", m)
+	}
+}
+
+func TestMatches(t *testing.T) {
+	now := time.Now()
+	f := Fault{Type: TypeAbort, Status: http.StatusServiceUnavailable, Percentage: 100, HeaderName: "X-Chaos", HeaderValue: "on", ExpiresAt: now.Add(time.Minute)}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.False(t, f.Matches(req, now), "requests without the header are left alone")
+	req.Header.Set("X-Chaos", "off")
+	assert.False(t, f.Matches(req, now))
+	req.Header.Set("X-Chaos", "on")
+	assert.True(t, f.Matches(req, now))
+	assert.False(t, f.Matches(req, now.Add(time.Minute)), "expired faults are not injected")
+}
+
+func TestAbort(t *testing.T) {
+	err := Fault{Status: http.StatusTooManyRequests}.Abort()
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusTooManyRequests, he.Code)
+	}
+
+	err = Fault{GRPCCode: codes.DeadlineExceeded}.Abort()
+	if he, ok := err.(*echo.HTTPError); assert.True(t, ok) {
+		assert.Equal(t, http.StatusGatewayTimeout, he.Code, "gRPC codes map like upstream failures")
+	}
+}
@@ -0,0 +1,101 @@
+package gatewayauth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var signer = &Signer{KeyID: "k1", Secret: []byte("service-secret"), Audience: "orders", TTL: DefaultTTL}
+
+func TestTransportAndMiddleware(t *testing.T) {
+	verifier := NewVerifier("orders", map[string][]byte{"k1": []byte("service-secret")})
+	var got *Claims
+	srv := httptest.NewServer(verifier.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = FromContext(r.Context())
+	})))
+	defer srv.Close()
+	client := &http.Client{Transport: &Transport{Next: http.DefaultTransport}}
+
+	res, err := client.Get(srv.URL + "/orders/1")
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode, "unsigned calls are rejected")
+
+	id := Identity{RequestID: "req-1", Consumer: "acme", Claims: map[string]interface{}{"sub": "user-7", "role": "agent"}}
+	req, _ := http.NewRequestWithContext(WithSigner(context.Background(), signer, id), http.MethodGet, srv.URL+"/orders/1", nil)
+	res, err = client.Do(req)
+	require.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	require.NotNil(t, got)
+	assert.Equal(t, "req-1", got.RequestID)
+	assert.Equal(t, "acme", got.Consumer)
+	assert.Equal(t, "user-7", got.Subject)
+	assert.Equal(t, "agent", got.Claims["role"])
+	assert.Empty(t, req.Header.Get(Header), "the caller's request is not modified")
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	token, err := signer.Token(Identity{}, http.MethodPost, "/orders", now)
+	require.NoError(t, err)
+
+	v := NewVerifier("orders", map[string][]byte{"k1": []byte("service-secret")})
+	_, err = v.Verify(token)
+	assert.NoError(t, err)
+
+	v.now = func() time.Time { return now.Add(time.Minute) }
+	_, err = v.Verify(token)
+	assert.ErrorIs(t, err, ErrExpired)
+
+	_, err = NewVerifier("payments", v.Keys).Verify(token)
+	assert.ErrorIs(t, err, ErrAudience)
+	_, err = NewVerifier("orders", map[string][]byte{"k1": []byte("other")}).Verify(token)
+	assert.ErrorIs(t, err, ErrSignature)
+	_, err = NewVerifier("orders", map[string][]byte{"k2": []byte("service-secret")}).Verify(token)
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	_, err = v.Verify("not.a.token")
+	assert.ErrorIs(t, err, ErrMalformed)
+
+	req := httptest.NewRequest(http.MethodDelete, "/orders", nil)
+	req.Header.Set(Header, token)
+	_, err = NewVerifier("orders", v.Keys).VerifyRequest(req)
+	assert.ErrorIs(t, err, ErrRequest)
+}
+
+func TestGRPCInterceptors(t *testing.T) {
+	const method = "/orders.OrderService/Get"
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	ctx := WithSigner(context.Background(), signer, Identity{RequestID: "req-2"})
+	require.NoError(t, UnaryClientInterceptor(ctx, method, nil, nil, nil, invoker))
+	require.Len(t, md.Get(MetadataKey), 1)
+
+	v := NewVerifier("orders", map[string][]byte{"k1": []byte("service-secret")})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		claims, _ := FromContext(ctx)
+		return claims.RequestID, nil
+	}
+	incoming := metadata.NewIncomingContext(context.Background(), md)
+	res, err := v.UnaryServerInterceptor(incoming, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	require.NoError(t, err)
+	assert.Equal(t, "req-2", res)
+
+	_, err = v.UnaryServerInterceptor(incoming, nil, &grpc.UnaryServerInfo{FullMethod: "/orders.OrderService/Delete"}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = v.UnaryServerInterceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,94 @@
+package gatewayauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Signer issues the tokens of one upstream service
+type Signer struct {
+	KeyID    string
+	Secret   []byte
+	Audience string // Name of the upstream service
+	TTL      time.Duration
+}
+
+// Identity is who a call is made on behalf of
+type Identity struct {
+	RequestID string
+	Consumer  string
+	Claims    map[string]interface{} // Verified claims of the caller's token
+}
+
+// Token signs a token for a call with the given method and path
+func (s *Signer) Token(id Identity, method, path string, now time.Time) (string, error) {
+	claims := Claims{
+		Issuer:    Issuer,
+		Audience:  s.Audience,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.TTL).Unix(),
+		RequestID: id.RequestID,
+		Consumer:  id.Consumer,
+		Claims:    id.Claims,
+		Method:    method,
+		Path:      path,
+	}
+	if sub, ok := id.Claims["sub"].(string); ok {
+		claims.Subject = sub
+	}
+	return Sign(s.KeyID, s.Secret, claims)
+}
+
+type signing struct {
+	signer   *Signer
+	identity Identity
+}
+
+type signingKey struct{}
+
+// WithSigner makes Transport and UnaryClientInterceptor sign the calls made with ctx
+func WithSigner(ctx context.Context, s *Signer, id Identity) context.Context {
+	return context.WithValue(ctx, signingKey{}, signing{signer: s, identity: id})
+}
+
+func fromContext(ctx context.Context) (signing, bool) {
+	sg, ok := ctx.Value(signingKey{}).(signing)
+	return sg, ok && sg.signer != nil
+}
+
+// Transport adds a gateway token to requests whose context has a signer. Every attempt
+// gets its own token, so retried and hedged requests are signed too.
+type Transport struct {
+	Next http.RoundTripper
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	sg, ok := fromContext(req.Context())
+	if !ok {
+		return t.Next.RoundTrip(req)
+	}
+	token, err := sg.signer.Token(sg.identity, req.Method, req.URL.Path, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	req.Header.Set(Header, token)
+	return t.Next.RoundTrip(req)
+}
+
+// UnaryClientInterceptor adds a gateway token to gRPC calls whose context has a signer
+func UnaryClientInterceptor(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if sg, ok := fromContext(ctx); ok {
+		token, err := sg.signer.Token(sg.identity, "", method, time.Now())
+		if err != nil {
+			return err
+		}
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, token)
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
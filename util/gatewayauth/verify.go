@@ -0,0 +1,107 @@
+package gatewayauth
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Verifier checks the gateway tokens an upstream service receives
+type Verifier struct {
+	Keys     map[string][]byte // Secrets by key ID. Keep the old key here while the gateway rotates.
+	Audience string            // Name of this service in the gateway, any service if empty
+	Leeway   time.Duration     // Allowed clock skew
+	now      func() time.Time
+}
+
+// NewVerifier accepts tokens for the named service signed with one of the keys
+func NewVerifier(audience string, keys map[string][]byte) *Verifier {
+	return &Verifier{Keys: keys, Audience: audience, Leeway: 5 * time.Second}
+}
+
+// Verify checks the token's signature, issuer, audience and expiry
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissing
+	}
+	claims, err := parse(token, v.Keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Issuer != Issuer {
+		return nil, ErrIssuer
+	}
+	if v.Audience != "" && claims.Audience != v.Audience {
+		return nil, ErrAudience
+	}
+	now := time.Now
+	if v.now != nil {
+		now = v.now
+	}
+	if now().Add(-v.Leeway).Unix() >= claims.ExpiresAt {
+		return nil, ErrExpired
+	}
+	return claims, nil
+}
+
+// VerifyRequest checks the token of a REST call and that it was issued for its method and path
+func (v *Verifier) VerifyRequest(r *http.Request) (*Claims, error) {
+	claims, err := v.Verify(r.Header.Get(Header))
+	if err != nil {
+		return nil, err
+	}
+	if claims.Method != r.Method || claims.Path != r.URL.Path {
+		return nil, ErrRequest
+	}
+	return claims, nil
+}
+
+// Middleware rejects requests without a valid gateway token with 401 and makes the claims
+// available through FromContext
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims, err := v.VerifyRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), claims)))
+	})
+}
+
+// UnaryServerInterceptor rejects gRPC calls without a valid gateway token with Unauthenticated
+// and makes the claims available through FromContext
+func (v *Verifier) UnaryServerInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	var token string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(MetadataKey); len(values) > 0 {
+			token = values[0]
+		}
+	}
+	claims, err := v.Verify(token)
+	if err == nil && (claims.Method != "" || claims.Path != info.FullMethod) {
+		err = ErrRequest
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return handler(NewContext(ctx, claims), req)
+}
+
+type claimsKey struct{}
+
+// NewContext returns a context carrying verified claims
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims verified by Middleware or UnaryServerInterceptor
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
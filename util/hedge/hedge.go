@@ -0,0 +1,164 @@
+package hedge
+
+import (
+	"errors"
+	"math"
+	"net/url"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+// minSamples is how many latencies are needed before the percentile is trusted
+const minSamples = 20
+
+// windowSize is how many recent latencies the percentile is computed from
+const windowSize = 200
+
+// maxTokens bounds the hedges that can be saved up while traffic is quiet
+const maxTokens = 10
+
+// Policy configures when a second attempt is sent
+type Policy struct {
+	Percentile  float64       `json:"percentile"`    // Hedge once the attempt is slower than this percentile of recent latencies
+	Delay       util.Duration `json:"delay"`         // Fixed delay instead of the percentile, also used until enough latencies are known
+	MinDelay    util.Duration `json:"min_delay"`     // Lower bound of the percentile delay
+	MaxRate     float64       `json:"max_rate"`      // Hedges allowed per request, e.g. 0.1 for at most one in ten
+	MaxBodySize int64         `json:"max_body_size"` // Requests with larger bodies are not hedged
+}
+
+// DefaultPolicy hedges requests slower than the p95, for at most one request in ten
+func DefaultPolicy() Policy {
+	return Policy{
+		Percentile:  95,
+		Delay:       util.Duration(200 * time.Millisecond),
+		MinDelay:    util.Duration(10 * time.Millisecond),
+		MaxRate:     0.1,
+		MaxBodySize: 1 << 20,
+	}
+}
+
+func (p *Policy) Validate() error {
+	if p.Percentile < 0 || p.Percentile >= 100 {
+		return errors.New("percentile must be between 0 and 100")
+	}
+	if p.Delay <= 0 {
+		return errors.New("delay must be positive")
+	}
+	if p.MinDelay < 0 {
+		return errors.New("min_delay must not be negative")
+	}
+	if p.MaxRate <= 0 || p.MaxRate > 1 {
+		return errors.New("max_rate must be above 0 and at most 1")
+	}
+	if p.MaxBodySize < 0 {
+		return errors.New("max_body_size must not be negative")
+	}
+	return nil
+}
+
+// Hedger decides when the requests of one route are hedged and where the hedge goes
+type Hedger struct {
+	policy    Policy
+	alternate *url.URL // Scheme and host hedges are sent to, nil for the same upstream
+	latencies []time.Duration
+	next      int
+	tokens    float64
+	mu        sync.Mutex
+}
+
+// Delay is how long the first attempt may take before a hedge is sent
+func (h *Hedger) Delay() time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.policy.Percentile == 0 || len(h.latencies) < minSamples {
+		return time.Duration(h.policy.Delay)
+	}
+	sorted := append([]time.Duration(nil), h.latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(h.policy.Percentile/100*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if d := sorted[i]; d > time.Duration(h.policy.MinDelay) {
+		return d
+	}
+	return time.Duration(h.policy.MinDelay)
+}
+
+// Observe records the latency of an upstream response
+func (h *Hedger) Observe(d time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.latencies) < windowSize {
+		h.latencies = append(h.latencies, d)
+		return
+	}
+	h.latencies[h.next] = d
+	h.next = (h.next + 1) % windowSize
+}
+
+// earn adds the hedge budget of one request
+func (h *Hedger) earn() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.tokens = math.Min(maxTokens, h.tokens+h.policy.MaxRate)
+}
+
+// spend takes a hedge from the budget if there is one, allowing for rounding of the earned fractions
+func (h *Hedger) spend() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.tokens < 1-1e-9 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+func (h *Hedger) setPolicy(policy Policy, alternate *url.URL) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.policy = policy
+	h.alternate = alternate
+}
+
+func (h *Hedger) target() *url.URL {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.alternate
+}
+
+func (h *Hedger) maxBodySize() int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.policy.MaxBodySize
+}
+
+// Registry holds the hedger of every route so reloads keep the latencies learned
+type Registry struct {
+	hedgers map[string]*Hedger
+	mu      sync.Mutex
+}
+
+var Default = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{hedgers: make(map[string]*Hedger)}
+}
+
+// Get returns the hedger for key with the given policy and alternate target
+func (r *Registry) Get(key string, policy Policy, alternate *url.URL) *Hedger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hedgers[key]
+	if !ok {
+		h = &Hedger{}
+		r.hedgers[key] = h
+	}
+	h.setPolicy(policy, alternate)
+	return h
+}
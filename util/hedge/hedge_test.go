@@ -0,0 +1,102 @@
+package hedge
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func TestDelayFollowsPercentile(t *testing.T) {
+	h := NewRegistry().Get("route:1", DefaultPolicy(), nil)
+	assert.Equal(t, 200*time.Millisecond, h.Delay(), "the fixed delay is used until enough latencies are known")
+
+	for i := 1; i <= 100; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	assert.Equal(t, 95*time.Millisecond, h.Delay())
+
+	policy := DefaultPolicy()
+	policy.MinDelay = util.Duration(time.Second)
+	h = NewRegistry().Get("route:1", policy, nil)
+	for i := 0; i < minSamples; i++ {
+		h.Observe(time.Millisecond)
+	}
+	assert.Equal(t, time.Second, h.Delay())
+}
+
+func TestHedgeRateIsCapped(t *testing.T) {
+	h := NewRegistry().Get("route:1", DefaultPolicy(), nil)
+	hedges := 0
+	for i := 0; i < 100; i++ {
+		h.earn()
+		if h.spend() {
+			hedges++
+		}
+	}
+	assert.Equal(t, 10, hedges)
+}
+
+func TestTransportTakesFirstResponse(t *testing.T) {
+	var slowCancelled atomic.Bool
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadAll(r.Body)
+		select {
+		case <-r.Context().Done():
+			slowCancelled.Store(true)
+		case <-time.After(2 * time.Second):
+			io.WriteString(w, "slow")
+		}
+	}))
+	defer slow.Close()
+	var body string
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		io.WriteString(w, "fast")
+	}))
+	defer fast.Close()
+
+	policy := DefaultPolicy()
+	policy.Delay = util.Duration(20 * time.Millisecond)
+	policy.MaxRate = 1
+	alternate, _ := url.Parse(fast.URL)
+	h := NewRegistry().Get("route:1", policy, alternate)
+	h.tokens = 1
+
+	rt := &transport{primary: http.DefaultTransport, hedge: http.DefaultTransport}
+	req, _ := http.NewRequestWithContext(WithHedger(t.Context(), h), http.MethodPut, slow.URL, strings.NewReader("payload"))
+	res, err := rt.RoundTrip(req)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		assert.Equal(t, "fast", string(data))
+		assert.Equal(t, "true", res.Header.Get(HeaderHedged))
+		assert.Equal(t, "payload", body, "the hedge sends the same body")
+	}
+	assert.Eventually(t, slowCancelled.Load, time.Second, time.Millisecond, "the slow attempt is cancelled")
+}
+
+func TestTransportWithoutHedger(t *testing.T) {
+	calls := 0
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		time.Sleep(30 * time.Millisecond)
+	}))
+	defer upstream.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, upstream.URL, nil)
+	res, err := Transport.RoundTrip(req)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Empty(t, res.Header.Get(HeaderHedged))
+	}
+	assert.Equal(t, 1, calls)
+}
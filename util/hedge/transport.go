@@ -0,0 +1,170 @@
+package hedge
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/tracing"
+)
+
+// HeaderHedged marks responses that came from the hedged attempt
+const HeaderHedged = "X-Gateway-Hedged"
+
+type contextKey struct{}
+
+// WithHedger makes Transport hedge the upstream requests made with ctx
+func WithHedger(ctx context.Context, h *Hedger) context.Context {
+	return context.WithValue(ctx, contextKey{}, h)
+}
+
+// Transport sends upstream requests, hedging those whose context carries a Hedger. Hedges use
+// their own connection pool so they are not queued behind the slow attempt's connection.
+var Transport http.RoundTripper = &transport{
+	primary: http.DefaultTransport,
+	hedge:   http.DefaultTransport.(*http.Transport).Clone(),
+}
+
+type transport struct {
+	primary http.RoundTripper
+	hedge   http.RoundTripper
+}
+
+type attempt struct {
+	res     *http.Response
+	err     error
+	hedged  bool
+	latency time.Duration
+	cancel  context.CancelFunc
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h, ok := req.Context().Value(contextKey{}).(*Hedger)
+	if !ok {
+		return t.primary.RoundTrip(req)
+	}
+	h.earn()
+
+	body, ok, err := readBody(req, h.maxBodySize())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return t.primary.RoundTrip(req)
+	}
+
+	ctx := req.Context()
+	results := make(chan attempt, 2)
+	send := func(rt http.RoundTripper, r *http.Request, hedged bool) context.CancelFunc {
+		actx, cancel := context.WithCancel(ctx)
+		r = r.WithContext(actx)
+		if body != nil {
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		go func() {
+			start := time.Now()
+			res, err := rt.RoundTrip(r)
+			results <- attempt{res: res, err: err, hedged: hedged, latency: time.Since(start), cancel: cancel}
+		}()
+		return cancel
+	}
+
+	cancelPrimary := send(t.primary, req, false)
+
+	delay := h.Delay()
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case first := <-results:
+		return h.answer(ctx, first)
+	case <-timer.C:
+	}
+	if !h.spend() {
+		return h.answer(ctx, <-results)
+	}
+	tracing.Info(ctx, "Hedge", "Upstream slower than "+delay.String()+", sending hedged request")
+	cancelHedge := send(t.hedge, hedgeRequest(req, h.target()), true)
+
+	// A failed attempt gives the other one the chance to answer
+	first := <-results
+	if first.err != nil {
+		first.cancel()
+		return h.answer(ctx, <-results)
+	}
+
+	// Cancel the slower attempt and close whatever it still returns
+	if first.hedged {
+		cancelPrimary()
+	} else {
+		cancelHedge()
+	}
+	go func() {
+		if loser := <-results; loser.res != nil {
+			loser.res.Body.Close()
+		}
+	}()
+	return h.answer(ctx, first)
+}
+
+// answer returns the response of the winning attempt, whose context is released once its body is closed
+func (h *Hedger) answer(ctx context.Context, a attempt) (*http.Response, error) {
+	if a.err != nil {
+		a.cancel()
+		return nil, a.err
+	}
+	h.Observe(a.latency)
+	if a.hedged {
+		tracing.Info(ctx, "Hedge", "Hedged request answered first")
+		a.res.Header.Set(HeaderHedged, "true")
+	}
+	a.res.Body = &cancelBody{ReadCloser: a.res.Body, cancel: a.cancel}
+	return a.res, nil
+}
+
+// hedgeRequest copies the request, sending it to the alternate target if there is one
+func hedgeRequest(req *http.Request, alternate *url.URL) *http.Request {
+	r := req.Clone(req.Context())
+	if alternate != nil {
+		r.URL.Scheme = alternate.Scheme
+		r.URL.Host = alternate.Host
+		r.Host = alternate.Host
+	}
+	return r
+}
+
+// readBody buffers the request body so both attempts can send it. A body larger than limit
+// is left readable on the request and ok is false.
+func readBody(req *http.Request, limit int64) (body []byte, ok bool, err error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(req.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return nil, false, nil
+	}
+	req.Body.Close()
+	return body, true, nil
+}
+
+// cancelBody releases the winning attempt's context once its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -19,10 +19,16 @@ import (
 var Json = jsoniter.ConfigCompatibleWithStandardLibrary
 
 const (
-	ContextTokenValueKey = "token-value"
-	ContextJwtClaimKey   = "jwt-claim"
-	ContextRouterKey     = "router-property"
-	ApiKey               = "x-api-token"
+	ContextTokenValueKey      = "token-value"
+	ContextJwtClaimKey        = "jwt-claim"
+	ContextRouterKey          = "router-property"
+	ContextServiceKey         = "service-property"
+	ContextCacheControlKey    = "cache-control"
+	ContextLatencyObserverKey = "latency-observer"
+	ContextPriorityKey        = "priority"
+	ContextConsumerKey        = "consumer"
+	ContextAPIKeyIDKey        = "api-key-id"
+	ApiKey                    = "x-api-token"
 
 	TagRouteDefault = "default"
 
@@ -116,6 +122,11 @@ func (ge *GenericException) Header() map[string]interface{} {
 	return ge.ErrorHeader
 }
 
+// Error lets handlers return the exception, which CustomHTTPErrorHandler renders as is
+func (ge *GenericException) Error() string {
+	return ge.ErrorMessage
+}
+
 // CustomHTTPErrorHandler handles various types of errors and renders the JSON response
 func CustomHTTPErrorHandler(err error, c echo.Context) {
 	var genericException AppError
@@ -134,10 +145,11 @@ func CustomHTTPErrorHandler(err error, c echo.Context) {
 
 	// Convert genericException to Response struct
 	response := &Response{
-		Status:  genericException.Status(),
-		Code:    genericException.Code(),
-		Message: genericException.Message(),
-		Data:    genericException.Data(),
+		Status:     genericException.Status(),
+		Code:       genericException.Code(),
+		HTTPStatus: genericException.HTTPStatus(),
+		Message:    genericException.Message(),
+		Data:       genericException.Data(),
 	}
 
 	// Marshal response to JSON and send it
@@ -146,6 +158,12 @@ func CustomHTTPErrorHandler(err error, c echo.Context) {
 	}
 }
 
+// KeepsHTTPStatus reports whether an echo.HTTPError with the status reaches the client with that
+// same status. The error handler answers the others with 403 or 500.
+func KeepsHTTPStatus(code int) bool {
+	return mapHTTPErrorToGenericException(code, "").HTTPStatus() == code
+}
+
 func mapHTTPErrorToGenericException(code int, message string) AppError {
 	switch code {
 	case http.StatusBadRequest:
@@ -172,6 +190,12 @@ func mapHTTPErrorToGenericException(code int, message string) AppError {
 		return NewGenericException("016", message, http.StatusTooManyRequests)
 	case http.StatusRequestHeaderFieldsTooLarge:
 		return NewGenericException("017", message, http.StatusRequestHeaderFieldsTooLarge)
+	case http.StatusBadGateway:
+		return NewGenericException("018", message, http.StatusBadGateway)
+	case http.StatusServiceUnavailable:
+		return NewGenericException("019", message, http.StatusServiceUnavailable)
+	case http.StatusGatewayTimeout:
+		return NewGenericException("020", message, http.StatusGatewayTimeout)
 	default:
 		return NewGenericException("999", "INTERNAL_SERVER_ERROR", http.StatusInternalServerError)
 	}
@@ -0,0 +1,102 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseStore keeps records in the gateway database so every instance sees them
+type DatabaseStore struct {
+	db *gorm.DB
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Record, bool, error) {
+	db := s.db.WithContext(ctx)
+	now := time.Now()
+
+	// An expired record gives its key up, hard delete so the unique index allows it again.
+	// Other expired records are left to Sweep.
+	if err := db.Unscoped().Where("key = ? AND expires_at <= ?", key, now).Delete(&database.IdempotencyRecord{}).Error; err != nil {
+		return nil, false, err
+	}
+
+	row := &database.IdempotencyRecord{Key: key, Fingerprint: fingerprint, ExpiresAt: now.Add(lease)}
+	result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(row)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &Record{Key: key, Fingerprint: fingerprint, ExpiresAt: row.ExpiresAt}, true, nil
+	}
+
+	record, err := s.Get(ctx, key)
+	return record, false, err
+}
+
+func (s *DatabaseStore) Complete(ctx context.Context, record *Record) error {
+	header, err := util.Json.Marshal(record.Header)
+	if err != nil {
+		return err
+	}
+	result := s.db.WithContext(ctx).Model(&database.IdempotencyRecord{}).
+		Where("key = ? AND NOT completed AND expires_at > ?", record.Key, time.Now()).
+		Updates(map[string]interface{}{
+			"completed":  true,
+			"status":     record.Status,
+			"header":     string(header),
+			"body":       record.Body,
+			"expires_at": record.ExpiresAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (s *DatabaseStore) Release(ctx context.Context, key string) error {
+	return s.db.WithContext(ctx).Unscoped().Where("key = ?", key).Delete(&database.IdempotencyRecord{}).Error
+}
+
+func (s *DatabaseStore) Get(ctx context.Context, key string) (*Record, error) {
+	var row database.IdempotencyRecord
+	err := s.db.WithContext(ctx).Where("key = ? AND expires_at > ?", key, time.Now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	record := &Record{
+		Key:         row.Key,
+		Fingerprint: row.Fingerprint,
+		Completed:   row.Completed,
+		Status:      row.Status,
+		Body:        row.Body,
+		ExpiresAt:   row.ExpiresAt,
+	}
+	if row.Header != "" {
+		if err := util.Json.Unmarshal([]byte(row.Header), &record.Header); err != nil {
+			return nil, err
+		}
+	}
+	return record, nil
+}
+
+// Sweep deletes every expired record
+func (s *DatabaseStore) Sweep(ctx context.Context) error {
+	return s.db.WithContext(ctx).Unscoped().Where("expires_at <= ?", time.Now()).Delete(&database.IdempotencyRecord{}).Error
+}
@@ -0,0 +1,90 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps records in process. Duplicates are only detected on the same instance.
+type MemoryStore struct {
+	records   map[string]*Record
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+// Memory is the store shared by every route using in-memory idempotency
+var Memory = NewMemoryStore()
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]*Record), now: time.Now}
+}
+
+func (s *MemoryStore) Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+	if record, ok := s.records[key]; ok && now.Before(record.ExpiresAt) {
+		return copyRecord(record), false, nil
+	}
+	record := &Record{Key: key, Fingerprint: fingerprint, ExpiresAt: now.Add(lease)}
+	s.records[key] = record
+	return copyRecord(record), true, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, record *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, ok := s.records[record.Key]
+	if !ok {
+		return ErrNotFound
+	}
+	if existing.Completed || !s.now().Before(existing.ExpiresAt) {
+		return ErrNotFound
+	}
+	completed := copyRecord(record)
+	completed.Completed = true
+	s.records[record.Key] = completed
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	record, ok := s.records[key]
+	if !ok || !s.now().Before(record.ExpiresAt) {
+		return nil, ErrNotFound
+	}
+	return copyRecord(record), nil
+}
+
+// sweep drops expired records at most once a minute
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, record := range s.records {
+		if !now.Before(record.ExpiresAt) {
+			delete(s.records, key)
+		}
+	}
+}
+
+func copyRecord(r *Record) *Record {
+	c := *r
+	c.Header = r.Header.Clone()
+	return &c
+}
@@ -0,0 +1,60 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+
+	_, created, err := s.Begin(ctx, "k1", "fp", time.Minute)
+	assert.NoError(t, err)
+	assert.True(t, created)
+
+	record, created, _ := s.Begin(ctx, "k1", "other", time.Minute)
+	assert.False(t, created)
+	assert.Equal(t, "fp", record.Fingerprint)
+	assert.False(t, record.Completed)
+
+	header := http.Header{"Content-Type": {"application/json"}}
+	assert.NoError(t, s.Complete(ctx, &Record{Key: "k1", Fingerprint: "fp", Status: 201, Header: header, Body: []byte(`{}`), ExpiresAt: now.Add(time.Hour)}))
+	record, err = Wait(ctx, s, "k1", time.Millisecond)
+	if assert.NoError(t, err) {
+		assert.True(t, record.Completed)
+		assert.Equal(t, 201, record.Status)
+		assert.Equal(t, header, record.Header)
+	}
+
+	// Completed records outlive the lease of the claim
+	now = now.Add(30 * time.Minute)
+	_, created, _ = s.Begin(ctx, "k1", "fp", time.Minute)
+	assert.False(t, created)
+
+	// Released keys can be claimed again
+	assert.NoError(t, s.Release(ctx, "k1"))
+	_, created, _ = s.Begin(ctx, "k1", "fp", time.Hour)
+	assert.True(t, created)
+
+	// Expired keys are gone
+	now = now.Add(2 * time.Hour)
+	_, err = s.Get(ctx, "k1")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, created, _ = s.Begin(ctx, "k1", "fp", time.Hour)
+	assert.True(t, created)
+
+	// A claim that is never completed can be taken again once its lease runs out
+	_, created, _ = s.Begin(ctx, "k2", "fp", time.Minute)
+	assert.True(t, created)
+	now = now.Add(2 * time.Minute)
+	assert.ErrorIs(t, s.Complete(ctx, &Record{Key: "k2", ExpiresAt: now.Add(time.Hour)}), ErrNotFound)
+	_, created, _ = s.Begin(ctx, "k2", "fp", time.Minute)
+	assert.True(t, created)
+}
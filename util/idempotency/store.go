@@ -0,0 +1,54 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// ErrNotFound is returned when a key has no record, or its record expired
+var ErrNotFound = errors.New("idempotency key not found")
+
+// Record is the stored outcome of the first request made with a key
+type Record struct {
+	Key         string      `json:"key"`
+	Fingerprint string      `json:"fingerprint"` // Hash of the request the key was first used with
+	Completed   bool        `json:"completed"`   // False while the first request is still in flight
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+	ExpiresAt   time.Time   `json:"expires_at"`
+}
+
+// Store keeps idempotency records for the TTL of their key
+type Store interface {
+	// Begin claims key for a new request for the length of lease, so a request that never
+	// finishes does not hold the key for long. When the key is already taken it returns the
+	// existing record and false instead.
+	Begin(ctx context.Context, key, fingerprint string, lease time.Duration) (*Record, bool, error)
+	// Complete stores the response of the request that claimed key and keeps it until
+	// the record's ExpiresAt
+	Complete(ctx context.Context, record *Record) error
+	// Release drops the claim on key so the request can be made again
+	Release(ctx context.Context, key string) error
+	// Get returns the record of key
+	Get(ctx context.Context, key string) (*Record, error)
+}
+
+// Wait polls store until the request holding key completes, returning its record
+func Wait(ctx context.Context, store Store, key string, interval time.Duration) (*Record, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		record, err := store.Get(ctx, key)
+		if err != nil || record.Completed {
+			return record, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
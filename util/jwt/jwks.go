@@ -0,0 +1,255 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+// DefaultJWKSTTL is how long fetched keys are used before the set is fetched again
+const DefaultJWKSTTL = time.Hour
+
+// minRefresh limits how often an unknown key ID triggers a fetch, so tokens with made up
+// key IDs cannot flood the key server
+const minRefresh = 30 * time.Second
+
+// failedRefresh is how long a failed fetch is waited out, doubling with every further failure up to minRefresh
+const failedRefresh = time.Second
+
+// RemoteKeys is a JSON Web Key Set read from a URL or file. It is fetched again once its TTL
+// has passed, or early when a token names a key it does not hold yet, so rotated keys are picked up.
+// One fetch runs at a time in the background, and requests keep using the keys held meanwhile.
+type RemoteKeys struct {
+	location    string
+	ttl         time.Duration
+	client      *http.Client
+	keys        []Key
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	failures    int
+	err         error         // Why the last fetch failed
+	refreshing  chan struct{} // Closed when the fetch in flight finishes
+	mu          sync.Mutex
+}
+
+var (
+	remoteKeys   = make(map[string]*RemoteKeys)
+	remoteKeysMu sync.Mutex
+)
+
+// JWKS returns the key set at location, shared by every route that uses it so reloads keep the cached keys
+func JWKS(location string, ttl time.Duration) *RemoteKeys {
+	remoteKeysMu.Lock()
+	defer remoteKeysMu.Unlock()
+
+	r, ok := remoteKeys[location]
+	if !ok {
+		r = &RemoteKeys{location: location, client: &http.Client{Timeout: 10 * time.Second}}
+		remoteKeys[location] = r
+	}
+	r.mu.Lock()
+	r.ttl = ttl
+	r.mu.Unlock()
+	return r
+}
+
+// Lookup returns the keys with the ID. Stale keys are still used if the set cannot be fetched.
+// Only a key ID the set does not hold waits for the fetch, and giving up on it leaves the
+// fetch running for the requests after it.
+func (r *RemoteKeys) Lookup(ctx context.Context, kid string) ([]Key, error) {
+	r.mu.Lock()
+	now := time.Now()
+	age := now.Sub(r.fetchedAt)
+	found := matching(r.keys, kid)
+	if r.keys != nil && age < r.ttl && (len(found) > 0 || age < minRefresh) {
+		r.mu.Unlock()
+		return found, nil
+	}
+	done := r.refresh(now)
+	r.mu.Unlock()
+
+	if done != nil && len(found) == 0 {
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.keys == nil {
+		err := r.err
+		if err == nil {
+			err = ctx.Err()
+		}
+		return nil, fmt.Errorf("fetching JWKS: %w", err)
+	}
+	return matching(r.keys, kid), nil
+}
+
+// refresh starts fetching the set unless a fetch is in flight or the last one failed too
+// recently. It returns a channel closed when the fetch finishes, or nil if none runs. The
+// caller holds r.mu.
+func (r *RemoteKeys) refresh(now time.Time) chan struct{} {
+	if r.refreshing != nil {
+		return r.refreshing
+	}
+	if r.failures > 0 && now.Sub(r.attemptedAt) < backoff(r.failures) {
+		return nil
+	}
+
+	done := make(chan struct{})
+	r.refreshing = done
+	r.attemptedAt = now
+	go func() {
+		// Not tied to the request that started it, which other requests may be waiting with
+		keys, err := r.fetch(context.Background())
+
+		r.mu.Lock()
+		if err != nil {
+			r.failures++
+			r.err = err
+		} else {
+			r.keys = keys
+			r.fetchedAt = time.Now()
+			r.failures = 0
+			r.err = nil
+		}
+		r.refreshing = nil
+		r.mu.Unlock()
+		close(done)
+	}()
+	return done
+}
+
+func backoff(failures int) time.Duration {
+	d := failedRefresh
+	for i := 1; i < failures && d < minRefresh; i++ {
+		d *= 2
+	}
+	if d > minRefresh {
+		d = minRefresh
+	}
+	return d
+}
+
+func (r *RemoteKeys) fetch(ctx context.Context) ([]Key, error) {
+	var data []byte
+	if strings.HasPrefix(r.location, "http://") || strings.HasPrefix(r.location, "https://") {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.location, nil)
+		if err != nil {
+			return nil, err
+		}
+		res, err := r.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("%s answered %d", r.location, res.StatusCode)
+		}
+		if data, err = io.ReadAll(io.LimitReader(res.Body, 1<<20)); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if data, err = os.ReadFile(strings.TrimPrefix(r.location, "file://")); err != nil {
+			return nil, err
+		}
+	}
+	return ParseJWKS(data)
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// ParseJWKS reads the signature keys of a JSON Web Key Set, skipping keys it cannot use
+func ParseJWKS(data []byte) ([]Key, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := util.Json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %v", err)
+	}
+
+	keys := []Key{}
+	for _, k := range set.Keys {
+		if k.Use == "enc" {
+			continue
+		}
+		pub, err := k.public()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, Key{ID: k.Kid, Algorithm: k.Alg, Public: pub})
+	}
+	return keys, nil
+}
+
+func (k jwk) public() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err1 := decodeInt(k.N)
+		e, err2 := decodeInt(k.E)
+		if err1 != nil || err2 != nil || !e.IsInt64() {
+			return nil, errors.New("invalid RSA key")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		curve, ok := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}[k.Crv]
+		if !ok {
+			return nil, errors.New("unsupported curve")
+		}
+		x, err1 := decodeInt(k.X)
+		y, err2 := decodeInt(k.Y)
+		if err1 != nil || err2 != nil || !curve.IsOnCurve(x, y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid OKP key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return nil, errors.New("invalid symmetric key")
+		}
+		return secret, nil
+	}
+	return nil, errors.New("unsupported key type")
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, errors.New("invalid number")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,217 @@
+// Package jwt verifies JSON Web Tokens signed with HMAC, RSA, ECDSA or Ed25519 keys
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+var (
+	ErrMalformed   = errors.New("malformed token")
+	ErrAlgorithm   = errors.New("unsupported signing algorithm")
+	ErrUnknownKey  = errors.New("no key to verify the token")
+	ErrSignature   = errors.New("invalid signature")
+	ErrNoExpiry    = errors.New("token has no expiry")
+	ErrExpired     = errors.New("token expired")
+	ErrNotYetValid = errors.New("token not valid yet")
+	ErrIssuer      = errors.New("invalid issuer")
+	ErrAudience    = errors.New("invalid audience")
+)
+
+// Header is the JOSE header of a token
+type Header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// MaxLeeway is the largest clock skew a Verifier should allow. Tokens are revoked until this
+// long after they expire, so a larger leeway would accept revoked tokens.
+const MaxLeeway = 5 * time.Minute
+
+// Verifier checks the signature and registered claims of tokens
+type Verifier struct {
+	Keys     KeySet
+	Issuer   string        // Required "iss", any issuer if empty
+	Audience []string      // "aud" must contain one of these, any audience if empty
+	Leeway   time.Duration // Allowed clock skew for "exp" and "nbf"
+	now      func() time.Time
+}
+
+// Verify returns the claims of a valid token
+func (v *Verifier) Verify(ctx context.Context, token string) (map[string]interface{}, error) {
+	header, claims, input, sig, err := parse(token)
+	if err != nil {
+		return nil, err
+	}
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, ErrAlgorithm
+	}
+
+	keys, err := v.Keys.Lookup(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	verified, tried := false, false
+	for _, key := range keys {
+		if !key.fits(header.Alg) {
+			continue
+		}
+		tried = true
+		if verify(header.Alg, hash, key.Public, input, sig) {
+			verified = true
+			break
+		}
+	}
+	if !tried {
+		return nil, ErrUnknownKey
+	}
+	if !verified {
+		return nil, ErrSignature
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) validate(claims map[string]interface{}) error {
+	now := time.Now()
+	if v.now != nil {
+		now = v.now()
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return ErrNoExpiry
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+	if v.Issuer != "" && claims["iss"] != v.Issuer {
+		return ErrIssuer
+	}
+	if len(v.Audience) > 0 && !hasAudience(claims["aud"], v.Audience) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// UnverifiedClaims decodes the claims of a token without checking it. Only use them for
+// decisions a forged token cannot abuse.
+func UnverifiedClaims(token string) (map[string]interface{}, error) {
+	_, claims, _, _, err := parse(token)
+	return claims, err
+}
+
+// parse splits a compact token and decodes its header and claims without verifying it
+func parse(token string) (header Header, claims map[string]interface{}, input, sig []byte, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	rawHeader, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	rawClaims, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	sig, err = base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	if err := util.Json.Unmarshal(rawHeader, &header); err != nil {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	if err := util.Json.Unmarshal(rawClaims, &claims); err != nil || claims == nil {
+		return header, nil, nil, nil, ErrMalformed
+	}
+	return header, claims, []byte(parts[0] + "." + parts[1]), sig, nil
+}
+
+// algorithms maps the supported "alg" values to their hash
+var algorithms = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+	"PS256": crypto.SHA256, "PS384": crypto.SHA384, "PS512": crypto.SHA512,
+	"ES256": crypto.SHA256, "ES384": crypto.SHA384, "ES512": crypto.SHA512,
+	"EdDSA": 0,
+}
+
+func verify(alg string, hash crypto.Hash, key interface{}, input, sig []byte) bool {
+	if alg == "EdDSA" {
+		return ed25519.Verify(key.(ed25519.PublicKey), input, sig)
+	}
+	h := hash.New()
+	h.Write(input)
+	digest := h.Sum(nil)
+
+	switch alg[:2] {
+	case "HS":
+		mac := hmac.New(hash.New, key.([]byte))
+		mac.Write(input)
+		return hmac.Equal(mac.Sum(nil), sig)
+	case "RS":
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), hash, digest, sig) == nil
+	case "PS":
+		return rsa.VerifyPSS(key.(*rsa.PublicKey), hash, digest, sig, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+	case "ES":
+		pub := key.(*ecdsa.PublicKey)
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(pub, digest, r, s)
+	}
+	return false
+}
+
+// numericDate reads a NumericDate claim
+func numericDate(v interface{}) (time.Time, bool) {
+	n, ok := v.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(0, int64(n*float64(time.Second))), true
+}
+
+func hasAudience(aud interface{}, accepted []string) bool {
+	var values []string
+	switch a := aud.(type) {
+	case string:
+		values = []string{a}
+	case []interface{}:
+		for _, v := range a {
+			values = append(values, fmt.Sprint(v))
+		}
+	}
+	for _, v := range values {
+		for _, want := range accepted {
+			if v == want {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,183 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sign(t *testing.T, alg, kid string, claims map[string]interface{}, key interface{}) string {
+	header, _ := json.Marshal(Header{Alg: alg, Kid: kid, Typ: "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(input))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(crypto.SHA256.New, k)
+		mac.Write([]byte(input))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func claims(exp time.Duration) map[string]interface{} {
+	return map[string]interface{}{"sub": "agent-1", "iss": "auth-service", "aud": []string{"mobile"}, "exp": time.Now().Add(exp).Unix()}
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	v := &Verifier{
+		Keys:     StaticKeys{{Public: &rsaKey.PublicKey}, {ID: "ec", Public: &ecKey.PublicKey}},
+		Issuer:   "auth-service",
+		Audience: []string{"mobile", "web"},
+	}
+	ctx := context.Background()
+
+	got, err := v.Verify(ctx, sign(t, "RS256", "", claims(time.Minute), rsaKey))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "agent-1", got["sub"])
+	}
+	_, err = v.Verify(ctx, sign(t, "ES256", "ec", claims(time.Minute), ecKey))
+	assert.NoError(t, err)
+
+	expired := claims(-time.Minute)
+	_, err = v.Verify(ctx, sign(t, "RS256", "", expired, rsaKey))
+	assert.ErrorIs(t, err, ErrExpired)
+
+	v.Leeway = 2 * time.Minute
+	_, err = v.Verify(ctx, sign(t, "RS256", "", expired, rsaKey))
+	assert.NoError(t, err, "leeway allows clock skew")
+	v.Leeway = 0
+
+	wrongIssuer := claims(time.Minute)
+	wrongIssuer["iss"] = "someone-else"
+	_, err = v.Verify(ctx, sign(t, "RS256", "", wrongIssuer, rsaKey))
+	assert.ErrorIs(t, err, ErrIssuer)
+
+	wrongAudience := claims(time.Minute)
+	wrongAudience["aud"] = "partners"
+	_, err = v.Verify(ctx, sign(t, "RS256", "", wrongAudience, rsaKey))
+	assert.ErrorIs(t, err, ErrAudience)
+
+	noExpiry := claims(time.Minute)
+	delete(noExpiry, "exp")
+	_, err = v.Verify(ctx, sign(t, "RS256", "", noExpiry, rsaKey))
+	assert.ErrorIs(t, err, ErrNoExpiry)
+
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	_, err = v.Verify(ctx, sign(t, "RS256", "", claims(time.Minute), otherKey))
+	assert.ErrorIs(t, err, ErrSignature)
+
+	// A token signed with HS256 using the public key as the secret must not verify
+	pub, _ := json.Marshal(rsaKey.PublicKey)
+	_, err = v.Verify(ctx, sign(t, "HS256", "", claims(time.Minute), pub))
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = v.Verify(ctx, "not-a-token")
+	assert.ErrorIs(t, err, ErrMalformed)
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	newKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	current := map[string]*rsa.PrivateKey{"k1": oldKey}
+	fetches := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches++
+		var keys []map[string]string
+		for kid, k := range current {
+			keys = append(keys, map[string]string{
+				"kty": "RSA",
+				"kid": kid,
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+			})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	}))
+	defer server.Close()
+
+	set := JWKS(server.URL, time.Hour)
+	v := &Verifier{Keys: set}
+	ctx := context.Background()
+
+	_, err := v.Verify(ctx, sign(t, "RS256", "k1", claims(time.Minute), oldKey))
+	assert.NoError(t, err)
+	_, err = v.Verify(ctx, sign(t, "RS256", "k1", claims(time.Minute), oldKey))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fetches, "keys are cached")
+
+	current["k2"] = newKey
+	_, err = v.Verify(ctx, sign(t, "RS256", "k2", claims(time.Minute), newKey))
+	assert.ErrorIs(t, err, ErrUnknownKey, "the set is not fetched again right away")
+
+	set.fetchedAt = time.Now().Add(-minRefresh)
+	_, err = v.Verify(ctx, sign(t, "RS256", "k2", claims(time.Minute), newKey))
+	assert.NoError(t, err, "an unknown key ID fetches the rotated set")
+	assert.Equal(t, 2, fetches)
+}
+
+func TestJWKSFailedFetchBacksOff(t *testing.T) {
+	var fetches int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		<-release
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	set := JWKS(server.URL, time.Hour)
+
+	// A client giving up does not abort the fetch the others are waiting on
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := set.Lookup(ctx, "k1")
+	assert.ErrorIs(t, err, context.Canceled)
+	close(release)
+
+	_, err = set.Lookup(context.Background(), "k1")
+	assert.ErrorContains(t, err, "503")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	// Until the backoff passes, requests fail at once without fetching again
+	_, err = set.Lookup(context.Background(), "k1")
+	assert.ErrorContains(t, err, "503")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&fetches))
+
+	set.mu.Lock()
+	set.attemptedAt = time.Now().Add(-failedRefresh)
+	set.mu.Unlock()
+	set.Lookup(context.Background(), "k1")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&fetches))
+	assert.Equal(t, 2*failedRefresh, backoff(2))
+	assert.Equal(t, minRefresh, backoff(20))
+}
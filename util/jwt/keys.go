@@ -0,0 +1,124 @@
+package jwt
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Key is a verification key, optionally bound to a key ID and algorithm
+type Key struct {
+	ID        string
+	Algorithm string
+	Public    interface{} // *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey or an HMAC secret as []byte
+}
+
+// fits reports whether the key may verify tokens signed with alg. The key type must match
+// the algorithm, so a public key can never be used as an HMAC secret.
+func (k Key) fits(alg string) bool {
+	if k.Algorithm != "" && k.Algorithm != alg {
+		return false
+	}
+	switch pub := k.Public.(type) {
+	case []byte:
+		return alg[:2] == "HS"
+	case *rsa.PublicKey:
+		return alg[:2] == "RS" || alg[:2] == "PS"
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return alg == "ES256"
+		case elliptic.P384():
+			return alg == "ES384"
+		case elliptic.P521():
+			return alg == "ES512"
+		}
+	case ed25519.PublicKey:
+		return alg == "EdDSA"
+	}
+	return false
+}
+
+// KeySet finds the keys that may have signed a token
+type KeySet interface {
+	Lookup(ctx context.Context, kid string) ([]Key, error)
+}
+
+// StaticKeys is a fixed set of keys
+type StaticKeys []Key
+
+// Lookup returns the keys with the ID, or every key without an ID
+func (s StaticKeys) Lookup(ctx context.Context, kid string) ([]Key, error) {
+	return matching(s, kid), nil
+}
+
+// MultiKeySet looks a key up in every set
+type MultiKeySet []KeySet
+
+func (m MultiKeySet) Lookup(ctx context.Context, kid string) ([]Key, error) {
+	var keys []Key
+	var firstErr error
+	for _, set := range m {
+		found, err := set.Lookup(ctx, kid)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		keys = append(keys, found...)
+	}
+	if len(keys) == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return keys, nil
+}
+
+func matching(keys []Key, kid string) []Key {
+	var out []Key
+	for _, k := range keys {
+		if k.ID == "" || kid == "" || k.ID == kid {
+			out = append(out, k)
+		}
+	}
+	return out
+}
+
+// ParsePublicKey reads a PEM encoded public key or certificate
+func ParsePublicKey(data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM block found")
+	}
+
+	var pub interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		pub = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		pub = key
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return Key{}, err
+		}
+		pub = key
+	}
+
+	switch pub.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+		return Key{Public: pub}, nil
+	}
+	return Key{}, fmt.Errorf("unsupported public key type %T", pub)
+}
@@ -3,6 +3,9 @@ package metrics
 import (
 	"sync"
 	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/adaptive"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/bulkhead"
 )
 
 type MetricPoint struct {
@@ -21,6 +24,9 @@ type ServiceMetrics struct {
 	PathMetrics   map[string]*PathInfo `json:"path_metrics"`
 	HealthScore   int                  `json:"health_score"`
 	CircuitStatus string               `json:"circuit_status"`
+	InFlight      int                  `json:"in_flight"`                // Requests holding a slot of the service bulkhead
+	Queued        int                  `json:"queued"`                   // Requests waiting for one
+	AdaptiveLimit int                  `json:"adaptive_limit,omitempty"` // Concurrency the adaptive limiter allows
 	mu            sync.RWMutex
 }
 
@@ -29,14 +35,30 @@ type PathInfo struct {
 	AvgLatencyMS float64 `json:"avg_latency_ms"`
 }
 
+// CacheMetrics counts the response cache outcomes of a route
+type CacheMetrics struct {
+	Hits      int64   `json:"hits"`
+	StaleHits int64   `json:"stale_hits"`
+	Misses    int64   `json:"misses"`
+	HitRatio  float64 `json:"hit_ratio"`
+}
+
 type Registry struct {
-	Services  map[string]*ServiceMetrics `json:"services"`
-	StartTime time.Time                  `json:"start_time"`
+	Services  map[string]*ServiceMetrics  `json:"services"`
+	Cache     map[string]*CacheMetrics    `json:"cache"`
+	Coalesce  map[string]*CoalesceMetrics `json:"coalesce"`
+	Consumers map[string]*ConsumerMetrics `json:"consumers"`
+	Bulkheads []bulkhead.Stats            `json:"bulkheads"`
+	Adaptive  []adaptive.Stats            `json:"adaptive"`
+	StartTime time.Time                   `json:"start_time"`
 	mu        sync.RWMutex
 }
 
 var DefaultRegistry = &Registry{
 	Services:  make(map[string]*ServiceMetrics),
+	Cache:     make(map[string]*CacheMetrics),
+	Coalesce:  make(map[string]*CoalesceMetrics),
+	Consumers: make(map[string]*ConsumerMetrics),
 	StartTime: time.Now(),
 }
 
@@ -89,3 +111,111 @@ func (sm *ServiceMetrics) Record(path string, status int, duration time.Duration
 func Record(service, path string, status int, duration time.Duration) {
 	DefaultRegistry.GetServiceMetrics(service).Record(path, status, duration)
 }
+
+const (
+	CacheHit   = "hit"
+	CacheStale = "stale"
+	CacheMiss  = "miss"
+)
+
+// RecordCache counts a cache lookup of route with outcome CacheHit, CacheStale or CacheMiss
+func (r *Registry) RecordCache(route, outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cm, ok := r.Cache[route]
+	if !ok {
+		cm = &CacheMetrics{}
+		r.Cache[route] = cm
+	}
+	switch outcome {
+	case CacheHit:
+		cm.Hits++
+	case CacheStale:
+		cm.StaleHits++
+	default:
+		cm.Misses++
+	}
+	cm.HitRatio = float64(cm.Hits+cm.StaleHits) / float64(cm.Hits+cm.StaleHits+cm.Misses)
+}
+
+func RecordCache(route, outcome string) {
+	DefaultRegistry.RecordCache(route, outcome)
+}
+
+// CoalesceMetrics counts the requests a route sent upstream and the ones collapsed into them
+type CoalesceMetrics struct {
+	Upstream  int64 `json:"upstream"`
+	Collapsed int64 `json:"collapsed"`
+}
+
+// RecordCoalesce counts a request of route that either went upstream or was collapsed into one in flight
+func (r *Registry) RecordCoalesce(route string, collapsed bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cm, ok := r.Coalesce[route]
+	if !ok {
+		cm = &CoalesceMetrics{}
+		r.Coalesce[route] = cm
+	}
+	if collapsed {
+		cm.Collapsed++
+	} else {
+		cm.Upstream++
+	}
+}
+
+func RecordCoalesce(route string, collapsed bool) {
+	DefaultRegistry.RecordCoalesce(route, collapsed)
+}
+
+// CoalesceStats returns a copy of the coalescing counters of route
+func (r *Registry) CoalesceStats(route string) CoalesceMetrics {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if cm, ok := r.Coalesce[route]; ok {
+		return *cm
+	}
+	return CoalesceMetrics{}
+}
+
+// ConsumerMetrics counts the requests of an API key consumer
+type ConsumerMetrics struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+}
+
+// RecordConsumer counts a request made with one of the consumer's keys
+func (r *Registry) RecordConsumer(consumer string, status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cm, ok := r.Consumers[consumer]
+	if !ok {
+		cm = &ConsumerMetrics{}
+		r.Consumers[consumer] = cm
+	}
+	cm.Requests++
+	if status >= 400 {
+		cm.Errors++
+	}
+}
+
+func RecordConsumer(consumer string, status int) {
+	DefaultRegistry.RecordConsumer(consumer, status)
+}
+
+// SetBulkheads replaces the bulkhead stats reported with the metrics
+func (r *Registry) SetBulkheads(stats []bulkhead.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Bulkheads = stats
+}
+
+// SetAdaptive replaces the adaptive limiter stats reported with the metrics
+func (r *Registry) SetAdaptive(stats []adaptive.Stats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Adaptive = stats
+}
@@ -0,0 +1,129 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/ratelimit"
+)
+
+const (
+	ScopeGlobal  = ratelimit.ScopeGlobal
+	ScopeService = ratelimit.ScopeService
+	ScopeTag     = "tag"
+	ScopeRoute   = ratelimit.ScopeRoute
+)
+
+const (
+	IntervalDay   = "day"
+	IntervalMonth = "month"
+)
+
+// DefaultRejectCode is the error code of requests over quota
+const DefaultRejectCode = "016"
+
+// Location is the time zone days and months start in
+var Location = time.Local
+
+// Quota is a validated quota ready to be enforced
+type Quota struct {
+	ID           uint
+	Name         string
+	Scope        string
+	TargetID     uint
+	Tag          string
+	Requests     int64
+	Interval     string
+	KeyBy        string
+	KeyName      string
+	RejectCode   string
+	RejectStatus int
+}
+
+// FromModel validates a stored quota and fills in its defaults
+func FromModel(m database.Quota) (Quota, error) {
+	q := Quota{
+		ID:           m.ID,
+		Name:         m.Name,
+		Scope:        m.Scope,
+		TargetID:     m.TargetID,
+		Tag:          m.Tag,
+		Requests:     m.Requests,
+		Interval:     m.Interval,
+		KeyBy:        m.KeyBy,
+		RejectCode:   m.RejectCode,
+		RejectStatus: m.RejectStatus,
+	}
+
+	switch q.Scope {
+	case ScopeGlobal:
+	case ScopeService, ScopeRoute:
+		if q.TargetID == 0 {
+			return q, fmt.Errorf("%s quota needs a target_id", q.Scope)
+		}
+	case ScopeTag:
+		if q.Tag == "" {
+			return q, errors.New("tag quota needs a tag")
+		}
+	default:
+		return q, errors.New("scope must be \"global\", \"service\", \"tag\" or \"route\"")
+	}
+
+	if q.Requests < 1 {
+		return q, errors.New("requests must be at least 1")
+	}
+	if q.Interval != IntervalDay && q.Interval != IntervalMonth {
+		return q, errors.New("interval must be \"day\" or \"month\"")
+	}
+
+	keyName, err := ratelimit.KeyName(m.KeyBy, m.KeyName)
+	if err != nil {
+		return q, err
+	}
+	q.KeyName = keyName
+
+	if q.RejectCode == "" {
+		q.RejectCode = DefaultRejectCode
+	}
+	if q.RejectStatus == 0 {
+		q.RejectStatus = http.StatusTooManyRequests
+	}
+	if q.RejectStatus < 400 || q.RejectStatus > 599 {
+		return q, fmt.Errorf("reject_status %d is not an error status", q.RejectStatus)
+	}
+	return q, nil
+}
+
+// Applies reports whether the quota covers a route
+func (q Quota) Applies(serviceID, routeID uint, tag string) bool {
+	switch q.Scope {
+	case ScopeService:
+		return q.TargetID == serviceID
+	case ScopeTag:
+		return q.Tag == tag
+	case ScopeRoute:
+		return q.TargetID == routeID
+	default:
+		return true
+	}
+}
+
+// Period returns the start and end of the day or month containing t
+func (q Quota) Period(t time.Time) (time.Time, time.Time) {
+	t = t.In(Location)
+	if q.Interval == IntervalMonth {
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, Location)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Location)
+	return start, start.AddDate(0, 0, 1)
+}
+
+// Rejection is the error returned for requests over quota
+func (q Quota) Rejection() error {
+	return util.NewGenericException(q.RejectCode, "Quota exceeded", q.RejectStatus)
+}
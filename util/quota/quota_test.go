@@ -0,0 +1,50 @@
+package quota
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+)
+
+func TestFromModel(t *testing.T) {
+	q, err := FromModel(database.Quota{Name: "otp", Scope: ScopeTag, Tag: "otp", Requests: 1000, Interval: IntervalMonth, KeyBy: "api_key"})
+	if assert.NoError(t, err) {
+		assert.Equal(t, DefaultRejectCode, q.RejectCode)
+		assert.Equal(t, http.StatusTooManyRequests, q.RejectStatus)
+		assert.Empty(t, q.KeyName)
+		assert.True(t, q.Applies(1, 2, "otp"))
+		assert.False(t, q.Applies(1, 2, "login"))
+	}
+
+	invalid := []database.Quota{
+		{Scope: ScopeTag, Requests: 1, Interval: IntervalDay, KeyBy: "ip"},
+		{Scope: ScopeService, Requests: 1, Interval: IntervalDay, KeyBy: "ip"},
+		{Scope: ScopeGlobal, Requests: 0, Interval: IntervalDay, KeyBy: "ip"},
+		{Scope: ScopeGlobal, Requests: 1, Interval: "week", KeyBy: "ip"},
+		{Scope: ScopeGlobal, Requests: 1, Interval: IntervalDay, KeyBy: "header"},
+		{Scope: ScopeGlobal, Requests: 1, Interval: IntervalDay, KeyBy: "ip", RejectStatus: 200},
+	}
+	for _, m := range invalid {
+		_, err := FromModel(m)
+		assert.Error(t, err, "%+v", m)
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	defer func(loc *time.Location) { Location = loc }(Location)
+	Location = time.FixedZone("WIB", 7*60*60)
+
+	// 20:00 UTC on January 31st is already February 1st in WIB
+	now := time.Date(2024, 1, 31, 20, 0, 0, 0, time.UTC)
+
+	start, end := Quota{Interval: IntervalDay}.Period(now)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, Location), start)
+	assert.Equal(t, time.Date(2024, 2, 2, 0, 0, 0, 0, Location), end)
+
+	start, end = Quota{Interval: IntervalMonth}.Period(now)
+	assert.Equal(t, time.Date(2024, 2, 1, 0, 0, 0, 0, Location), start)
+	assert.Equal(t, time.Date(2024, 3, 1, 0, 0, 0, 0, Location), end)
+}
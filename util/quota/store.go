@@ -0,0 +1,53 @@
+package quota
+
+import (
+	"context"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+)
+
+// Store keeps the usage of each quota and client key
+type Store interface {
+	// Take counts a request in the period starting at start. Requests over quota are not counted.
+	Take(ctx context.Context, q Quota, key string, start time.Time) (used int64, allowed bool, err error)
+	// Return uncounts a request Take allowed, when the request was rejected after all
+	Return(ctx context.Context, q Quota, key string, start time.Time) error
+}
+
+// Default is the store every route counts quota usage in, set once the database is connected
+var Default Store
+
+// DatabaseStore keeps usage in the gateway database, so counters survive restarts and are
+// shared by every instance. Past periods are kept for usage reports.
+type DatabaseStore struct {
+	db *gorm.DB
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db}
+}
+
+func (s *DatabaseStore) Take(ctx context.Context, q Quota, key string, start time.Time) (int64, bool, error) {
+	db := s.db.WithContext(ctx)
+
+	var used int64
+	err := db.Raw(`INSERT INTO quota_usages (quota_id, key, period_start, count, updated_at) VALUES (?, ?, ?, 1, ?)
+		ON CONFLICT (quota_id, key, period_start) DO UPDATE SET count = quota_usages.count + 1, updated_at = EXCLUDED.updated_at
+		RETURNING count`, q.ID, key, start, time.Now()).Scan(&used).Error
+	if err != nil {
+		return 0, false, err
+	}
+	if used <= q.Requests {
+		return used, true, nil
+	}
+
+	return used - 1, false, s.Return(ctx, q, key, start)
+}
+
+func (s *DatabaseStore) Return(ctx context.Context, q Quota, key string, start time.Time) error {
+	return s.db.WithContext(ctx).Model(&database.QuotaUsage{}).
+		Where("quota_id = ? AND key = ? AND period_start = ? AND count > 0", q.ID, key, start).
+		Update("count", gorm.Expr("count - 1")).Error
+}
@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+)
+
+// DatabaseStore counts requests in the gateway database so every instance enforces the same
+// limits. It uses a sliding window: the count of the current window plus the previous one,
+// weighted by how much of it still overlaps the last period. Burst is not used.
+type DatabaseStore struct {
+	db        *gorm.DB
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db, now: time.Now}
+}
+
+func (s *DatabaseStore) Take(ctx context.Context, p Policy, key string) (Result, error) {
+	db := s.db.WithContext(ctx)
+	now := s.now().UTC()
+	if err := s.sweep(db, now); err != nil {
+		return Result{}, err
+	}
+
+	window := now.Truncate(p.Period)
+	previous, err := s.count(db, key, window.Add(-p.Period))
+	if err != nil {
+		return Result{}, err
+	}
+
+	var count int
+	err = db.Raw(`INSERT INTO rate_limit_counters (key, window_start, count, expires_at) VALUES (?, ?, 1, ?)
+		ON CONFLICT (key, window_start) DO UPDATE SET count = rate_limit_counters.count + 1
+		RETURNING count`, key, window, window.Add(2*p.Period)).Scan(&count).Error
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := slidingWindow(p, previous, count, now.Sub(window))
+	if !result.Allowed {
+		// Rejected requests do not use up the window
+		err = db.Model(&database.RateLimitCounter{}).
+			Where("key = ? AND window_start = ?", key, window).
+			Update("count", gorm.Expr("count - 1")).Error
+	}
+	return result, err
+}
+
+// Peek reports the window of key as the next request would see it
+func (s *DatabaseStore) Peek(ctx context.Context, p Policy, key string) (Result, error) {
+	db := s.db.WithContext(ctx)
+	now := s.now().UTC()
+	window := now.Truncate(p.Period)
+
+	previous, err := s.count(db, key, window.Add(-p.Period))
+	if err != nil {
+		return Result{}, err
+	}
+	current, err := s.count(db, key, window)
+	if err != nil {
+		return Result{}, err
+	}
+
+	result := slidingWindow(p, previous, current+1, now.Sub(window))
+	if result.Allowed {
+		// The request slidingWindow counted was not made
+		result.Remaining++
+	}
+	return result, nil
+}
+
+// count is the number of requests of key in the window, zero if there were none
+func (s *DatabaseStore) count(db *gorm.DB, key string, window time.Time) (int, error) {
+	var row database.RateLimitCounter
+	err := db.Where("key = ? AND window_start = ?", key, window).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, nil
+	}
+	return row.Count, err
+}
+
+// sweep deletes the counters of past windows at most once a minute
+func (s *DatabaseStore) sweep(db *gorm.DB, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+	return db.Where("expires_at <= ?", now).Delete(&database.RateLimitCounter{}).Error
+}
+
+// slidingWindow decides on a request given the previous window's count, the current window's
+// count including the request, and the time elapsed in the current window
+func slidingWindow(p Policy, previous, current int, elapsed time.Duration) Result {
+	overlap := 1 - float64(elapsed)/float64(p.Period)
+	used := float64(previous)*overlap + float64(current)
+	left := p.Period - elapsed
+
+	result := Result{Allowed: used <= float64(p.Requests), Limit: p.Requests, Reset: left}
+	if previous > 0 {
+		// The previous window stops counting once it no longer overlaps
+		result.Reset = p.Period
+	}
+	if result.Allowed {
+		result.Remaining = int(math.Max(0, math.Floor(float64(p.Requests)-used)))
+		return result
+	}
+
+	// Wait until the previous window has decayed enough to make room for one more request
+	result.RetryAfter = left
+	if previous > 0 && current <= p.Requests {
+		wait := time.Duration(float64(p.Period)*(1-float64(p.Requests-current)/float64(previous))) - elapsed
+		if wait > 0 && wait < left {
+			result.RetryAfter = wait
+		}
+	}
+	return result
+}
@@ -0,0 +1,146 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+const (
+	// DefaultMaxKeys bounds the buckets kept in memory
+	DefaultMaxKeys = 100000
+	// DefaultIdleTTL is how long a bucket is kept after the client's last request
+	DefaultIdleTTL = time.Hour
+)
+
+// MemoryStore keeps a token bucket per key in process. The least recently used buckets are
+// evicted beyond maxKeys, and buckets unused for idleTTL are dropped, which gives the client
+// a full bucket again. Limits are per instance.
+type MemoryStore struct {
+	maxKeys int
+	idleTTL time.Duration
+	buckets map[string]*list.Element
+	lru     *list.List // Most recently used at the front
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+type bucket struct {
+	key      string
+	limiter  *rate.Limiter
+	limit    rate.Limit
+	burst    int
+	lastUsed time.Time
+}
+
+func NewMemoryStore(maxKeys int, idleTTL time.Duration) *MemoryStore {
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		idleTTL: idleTTL,
+		buckets: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+// Take spends a token from the bucket of key. Buckets follow policy changes.
+func (s *MemoryStore) Take(ctx context.Context, p Policy, key string) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.evictIdle(now)
+
+	limit := p.Limit()
+	var b *bucket
+	if el, ok := s.buckets[key]; ok {
+		b = el.Value.(*bucket)
+		s.lru.MoveToFront(el)
+	}
+	if b == nil || b.limit != limit || b.burst != p.Burst {
+		if b != nil {
+			s.remove(key)
+		}
+		b = &bucket{key: key, limiter: rate.NewLimiter(limit, p.Burst), limit: limit, burst: p.Burst}
+		s.buckets[key] = s.lru.PushFront(b)
+		for s.maxKeys > 0 && s.lru.Len() > s.maxKeys {
+			s.remove(s.lru.Back().Value.(*bucket).key)
+		}
+	}
+	b.lastUsed = now
+
+	allowed := b.limiter.AllowN(now, 1)
+	result := bucketState(p, b.limiter.TokensAt(now))
+	result.Allowed = allowed
+	if allowed {
+		result.RetryAfter = 0
+	}
+	return result, nil
+}
+
+// Peek reports the bucket of key, which is full if the client has not been seen
+func (s *MemoryStore) Peek(ctx context.Context, p Policy, key string) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens := float64(p.Burst)
+	if el, ok := s.buckets[key]; ok {
+		b := el.Value.(*bucket)
+		if b.limit == p.Limit() && b.burst == p.Burst && s.now().Sub(b.lastUsed) < s.idleTTL {
+			tokens = b.limiter.TokensAt(s.now())
+		}
+	}
+	return bucketState(p, tokens), nil
+}
+
+// bucketState describes a bucket holding the given tokens
+func bucketState(p Policy, tokens float64) Result {
+	limit := p.Limit()
+	result := Result{
+		Allowed:   tokens >= 1,
+		Limit:     p.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     refill(float64(p.Burst)-tokens, limit),
+	}
+	if !result.Allowed {
+		result.RetryAfter = refill(1-tokens, limit)
+	}
+	return result
+}
+
+// Len is the number of buckets held
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len()
+}
+
+// evictIdle drops the buckets unused for idleTTL, oldest first
+func (s *MemoryStore) evictIdle(now time.Time) {
+	for el := s.lru.Back(); el != nil; el = s.lru.Back() {
+		b := el.Value.(*bucket)
+		if now.Sub(b.lastUsed) < s.idleTTL {
+			return
+		}
+		s.remove(b.key)
+	}
+}
+
+func (s *MemoryStore) remove(key string) {
+	if el, ok := s.buckets[key]; ok {
+		s.lru.Remove(el)
+		delete(s.buckets, key)
+	}
+}
+
+// refill is the time it takes to earn the given number of tokens
+func refill(tokens float64, limit rate.Limit) time.Duration {
+	if tokens <= 0 || limit <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(tokens / float64(limit) * float64(time.Second)))
+}
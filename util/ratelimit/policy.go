@@ -0,0 +1,221 @@
+package ratelimit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+	"golang.org/x/time/rate"
+)
+
+const (
+	ScopeGlobal  = "global"
+	ScopeService = "service"
+	ScopeRoute   = "route"
+)
+
+const (
+	KeyByIP       = "ip"
+	KeyByHeader   = "header"
+	KeyByJWTClaim = "jwt_claim"
+	KeyByAPIKey   = "api_key"
+	KeyByBody     = "body"
+	KeyByConsumer = "consumer"
+)
+
+// Policy is a validated rate limit policy ready to be enforced
+type Policy struct {
+	ID       uint
+	Name     string
+	Scope    string
+	TargetID uint
+	Requests int
+	Period   time.Duration
+	Burst    int
+	KeyBy    string
+	KeyName  string
+}
+
+// FromModel validates a stored policy and fills in its defaults
+func FromModel(m database.RateLimitPolicy) (Policy, error) {
+	p := Policy{
+		ID:       m.ID,
+		Name:     m.Name,
+		Scope:    m.Scope,
+		TargetID: m.TargetID,
+		Requests: m.Requests,
+		Burst:    m.Burst,
+		KeyBy:    m.KeyBy,
+		KeyName:  m.KeyName,
+	}
+
+	switch p.Scope {
+	case ScopeGlobal:
+	case ScopeService, ScopeRoute:
+		if p.TargetID == 0 {
+			return p, fmt.Errorf("%s policy needs a target_id", p.Scope)
+		}
+	default:
+		return p, errors.New("scope must be \"global\", \"service\" or \"route\"")
+	}
+
+	if p.Requests < 1 {
+		return p, errors.New("requests must be at least 1")
+	}
+	period, err := time.ParseDuration(m.Period)
+	if err != nil || period <= 0 {
+		return p, fmt.Errorf("period must be a positive duration such as \"1s\" or \"1m\"")
+	}
+	p.Period = period
+	if p.Burst == 0 {
+		p.Burst = p.Requests
+	}
+	if p.Burst < 0 {
+		return p, errors.New("burst must not be negative")
+	}
+
+	keyName, err := KeyName(p.KeyBy, p.KeyName)
+	if err != nil {
+		return p, err
+	}
+	p.KeyName = keyName
+	return p, nil
+}
+
+// KeyName validates how clients are told apart and returns the key name, or its default
+func KeyName(keyBy, keyName string) (string, error) {
+	switch keyBy {
+	case KeyByIP, KeyByAPIKey, KeyByConsumer:
+	case KeyByHeader, KeyByJWTClaim, KeyByBody:
+		if keyName == "" {
+			return keyName, fmt.Errorf("key_by %q needs a key_name", keyBy)
+		}
+	default:
+		return keyName, errors.New("key_by must be \"ip\", \"header\", \"jwt_claim\", \"api_key\", \"consumer\" or \"body\"")
+	}
+	return keyName, nil
+}
+
+// Limit is the sustained rate of the policy
+func (p Policy) Limit() rate.Limit {
+	return rate.Limit(float64(p.Requests) / p.Period.Seconds())
+}
+
+// Applies reports whether the policy covers a route of a service
+func (p Policy) Applies(serviceID, routeID uint) bool {
+	switch p.Scope {
+	case ScopeService:
+		return p.TargetID == serviceID
+	case ScopeRoute:
+		return p.TargetID == routeID
+	default:
+		return true
+	}
+}
+
+// Authenticated reports whether the policy tells clients apart by who they authenticated as
+func (p Policy) Authenticated() bool {
+	return Authenticated(p.KeyBy)
+}
+
+// Authenticated reports whether keyBy is only known once the route's authentication middleware
+// has run. Counting such requests any earlier would key them on credentials nobody checked.
+func Authenticated(keyBy string) bool {
+	return keyBy == KeyByJWTClaim || keyBy == KeyByAPIKey || keyBy == KeyByConsumer
+}
+
+// ClientKey identifies the client the policy counts the request against
+func (p Policy) ClientKey(c echo.Context) string {
+	return ClientKey(c, p.KeyBy, p.KeyName)
+}
+
+// ClientKey reads the value clients are told apart by, prefixed with keyBy. Requests without
+// it are identified by IP so leaving it out does not lift a limit. Claims and API keys are only
+// taken from what the route's jwt and api-key middleware verified, and consumers from the
+// api-key or signature middleware.
+func ClientKey(c echo.Context, keyBy, keyName string) string {
+	var value string
+	switch keyBy {
+	case KeyByHeader:
+		value = c.Request().Header.Get(keyName)
+	case KeyByAPIKey:
+		if id, ok := c.Get(util.ContextAPIKeyIDKey).(uint); ok {
+			value = strconv.FormatUint(uint64(id), 10)
+		}
+	case KeyByConsumer:
+		value, _ = c.Get(util.ContextConsumerKey).(string)
+	case KeyByJWTClaim:
+		value = claimValue(c, keyName)
+	case KeyByBody:
+		value = bodyValue(c.Request(), keyName)
+	}
+	if value == "" {
+		return KeyByIP + ":" + c.RealIP()
+	}
+	return keyBy + ":" + value
+}
+
+// StoreKey is the key a client's requests are counted under in a Store
+func (p Policy) StoreKey(clientKey string) string {
+	return fmt.Sprintf("policy:%d %s", p.ID, clientKey)
+}
+
+// claimValue reads a claim verified by the JWT middleware
+func claimValue(c echo.Context, name string) string {
+	claims, _ := c.Get(util.ContextJwtClaimKey).(map[string]interface{})
+	if v, ok := claims[name]; ok && v != nil {
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// maxBodySize bounds the body read for a body key, like the signature middleware's default,
+// since rate limits run before any authentication
+const maxBodySize = 1 << 20
+
+// bodyValue reads a field of the JSON body, using dots for nested fields, and puts the body back.
+// Bodies over maxBodySize are not read any further and have no value.
+func bodyValue(req *http.Request, path string) string {
+	if req.Body == nil || req.Body == http.NoBody {
+		return ""
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	if err != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return ""
+	}
+	if len(body) > maxBodySize {
+		req.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), req.Body), req.Body}
+		return ""
+	}
+	req.Body.Close()
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	var v interface{}
+	if err := util.Json.Unmarshal(body, &v); err != nil {
+		return ""
+	}
+	for _, field := range strings.Split(path, ".") {
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = obj[field]
+	}
+	switch v.(type) {
+	case nil, map[string]interface{}, []interface{}:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
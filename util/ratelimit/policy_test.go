@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util"
+)
+
+func TestFromModel(t *testing.T) {
+	p, err := FromModel(database.RateLimitPolicy{Name: "partners", Scope: ScopeService, TargetID: 2, Requests: 100, Period: "1s", KeyBy: KeyByAPIKey})
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Second, p.Period)
+		assert.Equal(t, 100, p.Burst)
+		assert.Empty(t, p.KeyName)
+		assert.True(t, p.Authenticated())
+		assert.True(t, p.Applies(2, 7))
+		assert.False(t, p.Applies(3, 7))
+	}
+
+	p, err = FromModel(*database.DefaultRateLimitPolicy())
+	if assert.NoError(t, err) {
+		assert.Equal(t, 5, p.Burst)
+		assert.True(t, p.Applies(0, 0))
+	}
+
+	invalid := []database.RateLimitPolicy{
+		{Scope: "tenant", Requests: 1, Period: "1s", KeyBy: KeyByIP},
+		{Scope: ScopeRoute, Requests: 1, Period: "1s", KeyBy: KeyByIP},
+		{Scope: ScopeGlobal, Requests: 0, Period: "1s", KeyBy: KeyByIP},
+		{Scope: ScopeGlobal, Requests: 1, Period: "-1s", KeyBy: KeyByIP},
+		{Scope: ScopeGlobal, Requests: 1, Period: "1s", KeyBy: KeyByHeader},
+		{Scope: ScopeGlobal, Requests: 1, Period: "1s", KeyBy: "cookie"},
+	}
+	for _, m := range invalid {
+		_, err := FromModel(m)
+		assert.Error(t, err, "%+v", m)
+	}
+}
+
+func newContext(req *http.Request) echo.Context {
+	req.RemoteAddr = "10.0.0.1:1234"
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+func TestClientKey(t *testing.T) {
+	header := Policy{KeyBy: KeyByHeader, KeyName: "X-Client"}
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Client", "pos-17")
+	assert.Equal(t, "header:pos-17", header.ClientKey(newContext(req)))
+	assert.Equal(t, "ip:10.0.0.1", header.ClientKey(newContext(httptest.NewRequest(http.MethodGet, "/", nil))))
+
+	body := Policy{KeyBy: KeyByBody, KeyName: "user.phoneNumber"}
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"user":{"phoneNumber":"0812"}}`))
+	assert.Equal(t, "body:0812", body.ClientKey(newContext(req)))
+	rest, _ := io.ReadAll(req.Body)
+	assert.JSONEq(t, `{"user":{"phoneNumber":"0812"}}`, string(rest))
+
+	// Large bodies are not buffered, yet still reach the upstream whole
+	large := `{"user":{"phoneNumber":"0812"},"pad":"` + strings.Repeat("x", maxBodySize) + `"}`
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(large))
+	assert.Equal(t, "ip:10.0.0.1", body.ClientKey(newContext(req)))
+	rest, _ = io.ReadAll(req.Body)
+	assert.Equal(t, large, string(rest))
+	req = httptest.NewRequest(http.MethodPost, "/", strings.NewReader("phoneNumber=0812"))
+	assert.Equal(t, "ip:10.0.0.1", body.ClientKey(newContext(req)))
+
+	// An unverified bearer token is not trusted to tell clients apart
+	claim := Policy{KeyBy: KeyByJWTClaim, KeyName: "sub"}
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"agent-9"}`))
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(echo.HeaderAuthorization, "Bearer e30."+payload+".sig")
+	assert.Equal(t, "ip:10.0.0.1", claim.ClientKey(newContext(req)))
+
+	c := newContext(httptest.NewRequest(http.MethodGet, "/", nil))
+	c.Set(util.ContextJwtClaimKey, map[string]interface{}{"sub": "agent-3"})
+	assert.Equal(t, "jwt_claim:agent-3", claim.ClientKey(c))
+
+	apiKey := Policy{KeyBy: KeyByAPIKey}
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(util.ApiKey, "gw_made-up")
+	c = newContext(req)
+	assert.Equal(t, "ip:10.0.0.1", apiKey.ClientKey(c))
+	c.Set(util.ContextAPIKeyIDKey, uint(12))
+	assert.Equal(t, "api_key:12", apiKey.ClientKey(c))
+
+	consumer := Policy{KeyBy: KeyByConsumer}
+	assert.Equal(t, "ip:10.0.0.1", consumer.ClientKey(newContext(httptest.NewRequest(http.MethodGet, "/", nil))))
+	c.Set(util.ContextConsumerKey, "acme")
+	assert.Equal(t, "consumer:acme", consumer.ClientKey(c))
+}
@@ -0,0 +1,32 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	StoreMemory   = "memory"
+	StoreDatabase = "database"
+)
+
+// Result is the outcome of counting one request against a policy
+type Result struct {
+	Allowed    bool
+	Limit      int           // Requests allowed per period
+	Remaining  int           // Requests left right now
+	Reset      time.Duration // Time until the client's full limit is available again
+	RetryAfter time.Duration // Time until the next request is allowed, zero if this one was
+}
+
+// Store counts the requests of each client key. Keys are unique per policy, see Policy.StoreKey.
+type Store interface {
+	// Take counts a request and reports whether it is allowed
+	Take(ctx context.Context, p Policy, key string) (Result, error)
+	// Peek reports the state of key without counting a request
+	Peek(ctx context.Context, p Policy, key string) (Result, error)
+}
+
+// Default is the store shared by every route. Replace it with a DatabaseStore before the
+// routes are loaded to share limits between gateway instances.
+var Default Store = NewMemoryStore(DefaultMaxKeys, DefaultIdleTTL)
@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func take(t *testing.T, s Store, p Policy, key string) Result {
+	result, err := s.Take(context.Background(), p, key)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestMemoryStoreTake(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(10, time.Hour)
+	s.now = func() time.Time { return now }
+	p := Policy{Requests: 2, Period: time.Minute, Burst: 2}
+
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 1, Reset: 30 * time.Second}, take(t, s, p, "a"))
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}, take(t, s, p, "a"))
+	assert.Equal(t, Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Minute, RetryAfter: 30 * time.Second}, take(t, s, p, "a"))
+	assert.True(t, take(t, s, p, "b").Allowed)
+
+	now = now.Add(30 * time.Second)
+	assert.True(t, take(t, s, p, "a").Allowed)
+
+	// A changed policy starts over with a fresh bucket
+	p.Burst = 3
+	assert.Equal(t, 2, take(t, s, p, "a").Remaining)
+}
+
+func TestMemoryStoreEviction(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(2, time.Minute)
+	s.now = func() time.Time { return now }
+	p := Policy{Requests: 1, Period: time.Hour, Burst: 1}
+
+	take(t, s, p, "a")
+	take(t, s, p, "b")
+	assert.False(t, take(t, s, p, "a").Allowed)
+
+	// "b" is the least recently used and makes room for "c"
+	take(t, s, p, "c")
+	assert.Equal(t, 2, s.Len())
+	assert.True(t, take(t, s, p, "b").Allowed)
+	assert.Equal(t, 2, s.Len())
+
+	// Idle buckets are dropped and the client starts with a full bucket
+	now = now.Add(time.Minute)
+	assert.True(t, take(t, s, p, "a").Allowed)
+	assert.Equal(t, 1, s.Len())
+}
+
+func TestSlidingWindow(t *testing.T) {
+	p := Policy{Requests: 10, Period: time.Minute}
+
+	assert.Equal(t, Result{Allowed: true, Limit: 10, Remaining: 9, Reset: 45 * time.Second}, slidingWindow(p, 0, 1, 15*time.Second))
+
+	// 8 requests last minute still count 6 a quarter into this one
+	assert.Equal(t, Result{Allowed: true, Limit: 10, Remaining: 0, Reset: time.Minute}, slidingWindow(p, 8, 4, 15*time.Second))
+
+	// Room for one more once the previous window counts 5 at most, 22.5s into this one
+	result := slidingWindow(p, 8, 5, 15*time.Second)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 7500*time.Millisecond, result.RetryAfter)
+
+	// A full current window has to roll over
+	result = slidingWindow(p, 0, 11, 15*time.Second)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 45*time.Second, result.RetryAfter)
+}
+
+func peek(t *testing.T, s Store, p Policy, key string) Result {
+	result, err := s.Peek(context.Background(), p, key)
+	assert.NoError(t, err)
+	return result
+}
+
+func TestMemoryStorePeek(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(10, time.Hour)
+	s.now = func() time.Time { return now }
+	p := Policy{Requests: 2, Period: time.Minute, Burst: 2}
+
+	assert.Equal(t, Result{Allowed: true, Limit: 2, Remaining: 2}, peek(t, s, p, "a"))
+	assert.Equal(t, 0, s.Len())
+
+	take(t, s, p, "a")
+	take(t, s, p, "a")
+	assert.Equal(t, Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Minute, RetryAfter: 30 * time.Second}, peek(t, s, p, "a"))
+	assert.Equal(t, Result{Allowed: false, Limit: 2, Remaining: 0, Reset: time.Minute, RetryAfter: 30 * time.Second}, peek(t, s, p, "a"))
+}
@@ -0,0 +1,75 @@
+package revocation
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL bounds how long a token revoked through another instance keeps working
+const DefaultCacheTTL = 5 * time.Second
+
+// maxCached keeps made up token IDs from growing the cache without bound
+const maxCached = 10000
+
+// CachedStore remembers for a short while which tokens are not revoked, so the jwt middleware
+// does not query the store on every request. Revoking through it takes effect at once on
+// this instance.
+type CachedStore struct {
+	Store
+	ttl        time.Duration
+	checked    map[string]time.Time
+	generation uint64 // Counts revocations, so a check racing one is not cached
+	now        func() time.Time
+	mu         sync.Mutex
+}
+
+func NewCachedStore(store Store, ttl time.Duration) *CachedStore {
+	return &CachedStore{Store: store, ttl: ttl, checked: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *CachedStore) Revoke(ctx context.Context, e Entry) error {
+	err := s.Store.Revoke(ctx, e)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generation++
+	for id := range s.checked {
+		for _, k := range strings.Split(id, "\n") {
+			if k == e.Key() {
+				delete(s.checked, id)
+				break
+			}
+		}
+	}
+	return err
+}
+
+func (s *CachedStore) Revoked(ctx context.Context, keys []string) (bool, error) {
+	id := strings.Join(keys, "\n")
+	now := s.now()
+
+	s.mu.Lock()
+	at, ok := s.checked[id]
+	generation := s.generation
+	s.mu.Unlock()
+	if ok && now.Sub(at) < s.ttl {
+		return false, nil
+	}
+
+	revoked, err := s.Store.Revoked(ctx, keys)
+	if err != nil || revoked {
+		return revoked, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.generation == generation {
+		if len(s.checked) >= maxCached {
+			s.checked = make(map[string]time.Time)
+		}
+		s.checked[id] = now
+	}
+	return false, nil
+}
@@ -0,0 +1,68 @@
+package revocation
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseStore keeps the revocation list in the gateway database so every instance sees it
+type DatabaseStore struct {
+	db        *gorm.DB
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db, now: time.Now}
+}
+
+func (s *DatabaseStore) Revoke(ctx context.Context, e Entry) error {
+	db := s.db.WithContext(ctx)
+	now := s.now().UTC()
+	if err := s.sweep(db, now); err != nil {
+		return err
+	}
+	row := database.RevokedToken{Key: e.Key(), Kind: e.Kind, Value: e.Value, ExpiresAt: e.ExpiresAt, Reason: e.Reason, CreatedAt: now}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Set{{Column: clause.Column{Name: "expires_at"}, Value: gorm.Expr("GREATEST(revoked_tokens.expires_at, EXCLUDED.expires_at)")}},
+	}).Create(&row).Error
+}
+
+func (s *DatabaseStore) Revoked(ctx context.Context, keys []string) (bool, error) {
+	var count int64
+	err := s.db.WithContext(ctx).Model(&database.RevokedToken{}).
+		Where("key IN ? AND expires_at > ?", keys, s.now().UTC()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (s *DatabaseStore) List(ctx context.Context) ([]Entry, error) {
+	var rows []database.RevokedToken
+	if err := s.db.WithContext(ctx).Where("expires_at > ?", s.now().UTC()).Order("created_at").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make([]Entry, 0, len(rows))
+	for _, row := range rows {
+		out = append(out, Entry{Kind: row.Kind, Value: row.Value, ExpiresAt: row.ExpiresAt, Reason: row.Reason, CreatedAt: row.CreatedAt})
+	}
+	return out, nil
+}
+
+// sweep deletes expired entries at most once a minute
+func (s *DatabaseStore) sweep(db *gorm.DB, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+	return db.Where("expires_at <= ?", now).Delete(&database.RevokedToken{}).Error
+}
@@ -0,0 +1,67 @@
+package revocation
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps the revocation list in process, so other instances still accept the tokens
+type MemoryStore struct {
+	entries map[string]Entry
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry), now: time.Now}
+}
+
+func (s *MemoryStore) Revoke(ctx context.Context, e Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, old := range s.entries {
+		if !now.Before(old.ExpiresAt) {
+			delete(s.entries, k)
+		}
+	}
+	if old, ok := s.entries[e.Key()]; ok && old.ExpiresAt.After(e.ExpiresAt) {
+		e.ExpiresAt = old.ExpiresAt
+	}
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	s.entries[e.Key()] = e
+	return nil
+}
+
+func (s *MemoryStore) Revoked(ctx context.Context, keys []string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for _, k := range keys {
+		if e, ok := s.entries[k]; ok && now.Before(e.ExpiresAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	out := []Entry{}
+	for _, e := range s.entries {
+		if now.Before(e.ExpiresAt) {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.Before(out[j].CreatedAt) })
+	return out, nil
+}
@@ -0,0 +1,85 @@
+// Package revocation keeps the list of access tokens that must no longer be accepted
+// although they have not expired yet
+package revocation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/jwt"
+)
+
+// Kinds of revocation entries
+const (
+	KindToken   = "jti" // One token, by its "jti" claim
+	KindSession = "sid" // Every token of a session, by its "sid" claim
+)
+
+// Entry revokes the tokens with a jti or sid until ExpiresAt, when they would have expired anyway
+type Entry struct {
+	Kind      string    `json:"kind"`
+	Value     string    `json:"value"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Key identifies the entry in a store
+func (e Entry) Key() string {
+	return e.Kind + ":" + e.Value
+}
+
+// Store holds the revocation list. Share one between gateway instances, so a token revoked
+// through one instance is rejected by all of them.
+type Store interface {
+	// Revoke adds the entry, extending the expiry of an existing one
+	Revoke(ctx context.Context, e Entry) error
+	// Revoked reports whether any of the keys has an entry that has not expired
+	Revoked(ctx context.Context, keys []string) (bool, error)
+	// List returns the entries that have not expired
+	List(ctx context.Context) ([]Entry, error)
+}
+
+// Default is the store of the jwt middleware and the logout handlers. Replace it with a
+// DatabaseStore before the routes are loaded to share it between gateway instances.
+var Default Store = NewMemoryStore()
+
+// Keys are the store keys a token with the given claims is revoked by
+func Keys(claims map[string]interface{}) []string {
+	var keys []string
+	for _, kind := range []string{KindToken, KindSession} {
+		if v, ok := claims[kind].(string); ok && v != "" {
+			keys = append(keys, kind+":"+v)
+		}
+	}
+	return keys
+}
+
+// ForToken builds the entries that revoke a token and its session until the token expires.
+// They are kept for jwt.MaxLeeway longer, since verifiers accept the token that much past "exp".
+func ForToken(claims map[string]interface{}, reason string) ([]Entry, error) {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	var entries []Entry
+	for _, kind := range []string{KindToken, KindSession} {
+		if v, ok := claims[kind].(string); ok && v != "" {
+			entries = append(entries, Entry{Kind: kind, Value: v, ExpiresAt: time.Unix(int64(exp), 0).Add(jwt.MaxLeeway), Reason: reason})
+		}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("token has neither a jti nor a sid claim")
+	}
+	return entries, nil
+}
+
+// IsRevoked reports whether the token with the given claims was revoked
+func IsRevoked(ctx context.Context, store Store, claims map[string]interface{}) (bool, error) {
+	keys := Keys(claims)
+	if len(keys) == 0 {
+		return false, nil
+	}
+	return store.Revoked(ctx, keys)
+}
@@ -0,0 +1,96 @@
+package revocation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/util/jwt"
+)
+
+func TestForToken(t *testing.T) {
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	entries, err := ForToken(map[string]interface{}{"jti": "t-1", "sid": "s-1", "exp": float64(exp.Unix())}, "logout")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "jti:t-1", entries[0].Key())
+	assert.Equal(t, "sid:s-1", entries[1].Key())
+	assert.True(t, exp.Add(jwt.MaxLeeway).Equal(entries[0].ExpiresAt), "entries outlive the token by the largest leeway")
+
+	_, err = ForToken(map[string]interface{}{"jti": "t-1"}, "logout")
+	assert.Error(t, err)
+	_, err = ForToken(map[string]interface{}{"sub": "agent-1", "exp": float64(exp.Unix())}, "logout")
+	assert.Error(t, err)
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore()
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, s.Revoke(ctx, Entry{Kind: KindSession, Value: "s-1", ExpiresAt: now.Add(time.Minute)}))
+	revoked, err := IsRevoked(ctx, s, map[string]interface{}{"jti": "t-9", "sid": "s-1"})
+	require.NoError(t, err)
+	assert.True(t, revoked)
+	revoked, _ = IsRevoked(ctx, s, map[string]interface{}{"jti": "t-9", "sid": "s-2"})
+	assert.False(t, revoked)
+	revoked, _ = IsRevoked(ctx, s, map[string]interface{}{"sub": "agent-1"})
+	assert.False(t, revoked)
+
+	// A shorter expiry does not shorten an existing entry
+	require.NoError(t, s.Revoke(ctx, Entry{Kind: KindSession, Value: "s-1", ExpiresAt: now.Add(time.Second)}))
+	now = now.Add(30 * time.Second)
+	revoked, _ = s.Revoked(ctx, []string{"sid:s-1"})
+	assert.True(t, revoked)
+
+	now = now.Add(time.Minute)
+	revoked, _ = s.Revoked(ctx, []string{"sid:s-1"})
+	assert.False(t, revoked, "entries expire with the token")
+	entries, _ := s.List(ctx)
+	assert.Empty(t, entries)
+}
+
+// countingStore counts the lookups that reach the underlying store
+type countingStore struct {
+	Store
+	lookups int
+}
+
+func (s *countingStore) Revoked(ctx context.Context, keys []string) (bool, error) {
+	s.lookups++
+	return s.Store.Revoked(ctx, keys)
+}
+
+func TestCachedStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	inner := &countingStore{Store: NewMemoryStore()}
+	s := NewCachedStore(inner, time.Minute)
+	s.now = func() time.Time { return now }
+	keys := []string{"jti:t-1", "sid:s-1"}
+
+	for i := 0; i < 3; i++ {
+		revoked, err := s.Revoked(ctx, keys)
+		assert.NoError(t, err)
+		assert.False(t, revoked)
+	}
+	assert.Equal(t, 1, inner.lookups, "tokens that are not revoked are cached")
+
+	// Revoking through the cache takes effect at once
+	assert.NoError(t, s.Revoke(ctx, Entry{Kind: KindSession, Value: "s-1", ExpiresAt: now.Add(time.Hour)}))
+	revoked, _ := s.Revoked(ctx, keys)
+	assert.True(t, revoked)
+
+	// Revocations made through other instances apply once the cached result expires
+	other := []string{"jti:t-2"}
+	s.Revoked(ctx, other)
+	inner.Store.Revoke(ctx, Entry{Kind: KindToken, Value: "t-2", ExpiresAt: now.Add(time.Hour)})
+	revoked, _ = s.Revoked(ctx, other)
+	assert.False(t, revoked)
+	now = now.Add(time.Minute)
+	revoked, _ = s.Revoked(ctx, other)
+	assert.True(t, revoked)
+}
@@ -0,0 +1,44 @@
+package signature
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gitlab.com/posfin-unigo/middleware/agen-pos/backend/gateway-service/database"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DatabaseStore keeps nonces in the gateway database so every instance sees them
+type DatabaseStore struct {
+	db        *gorm.DB
+	lastSweep time.Time
+	now       func() time.Time
+	mu        sync.Mutex
+}
+
+func NewDatabaseStore(db *gorm.DB) *DatabaseStore {
+	return &DatabaseStore{db: db, now: time.Now}
+}
+
+func (s *DatabaseStore) Use(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	db := s.db.WithContext(ctx)
+	if err := s.sweep(db, s.now().UTC()); err != nil {
+		return false, err
+	}
+	res := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&database.SignatureNonce{Key: key, ExpiresAt: expiresAt})
+	return res.RowsAffected == 1, res.Error
+}
+
+// sweep deletes expired nonces at most once a minute
+func (s *DatabaseStore) sweep(db *gorm.DB, now time.Time) error {
+	s.mu.Lock()
+	if now.Sub(s.lastSweep) < time.Minute {
+		s.mu.Unlock()
+		return nil
+	}
+	s.lastSweep = now
+	s.mu.Unlock()
+	return db.Where("expires_at <= ?", now).Delete(&database.SignatureNonce{}).Error
+}
@@ -0,0 +1,113 @@
+// Package signature verifies HMAC-SHA256 signatures of partner requests
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a signed request
+const (
+	HeaderClientID  = "X-Client-Id" // Name of the consumer whose secret signed the request
+	HeaderTimestamp = "X-Timestamp" // Unix time in seconds
+	HeaderNonce     = "X-Nonce"     // Unique per request, at most MaxNonceLength characters
+	HeaderSignature = "X-Signature" // Hex encoded HMAC-SHA256 of the canonical request
+)
+
+const (
+	// DefaultTolerance is how far a request's timestamp may be from the gateway's clock
+	DefaultTolerance = 5 * time.Minute
+	// MaxNonceLength bounds what the nonce store keeps per request
+	MaxNonceLength = 128
+)
+
+var (
+	ErrMissing       = errors.New("missing signature headers")
+	ErrUnknownClient = errors.New("unknown client")
+	ErrTimestamp     = errors.New("timestamp outside the accepted window")
+	ErrSignature     = errors.New("signature mismatch")
+	ErrReplay        = errors.New("nonce already used")
+)
+
+// Request is what a signature covers
+type Request struct {
+	Method    string
+	URI       string // Path and query as sent, like /api/v1/pay?dry_run=1
+	Timestamp string
+	Nonce     string
+	Body      []byte
+	Headers   []string // Names of the signed headers, in order
+	Header    http.Header
+}
+
+// FromHTTP reads the request to verify from its signature headers. The body must already be read.
+func FromHTTP(req *http.Request, body []byte, headers []string) Request {
+	return Request{
+		Method:    req.Method,
+		URI:       req.URL.RequestURI(),
+		Timestamp: req.Header.Get(HeaderTimestamp),
+		Nonce:     req.Header.Get(HeaderNonce),
+		Body:      body,
+		Headers:   headers,
+		Header:    req.Header,
+	}
+}
+
+// Canonical is the string that is signed: the method, URI, timestamp, nonce, hex SHA-256 of
+// the body and each signed header as "name:value", separated by newlines. Header names are
+// lower case and repeated values are joined by commas.
+func (r Request) Canonical() string {
+	sum := sha256.Sum256(r.Body)
+	lines := []string{strings.ToUpper(r.Method), r.URI, r.Timestamp, r.Nonce, hex.EncodeToString(sum[:])}
+	for _, name := range r.Headers {
+		values := r.Header.Values(name)
+		for i, v := range values {
+			values[i] = strings.TrimSpace(v)
+		}
+		lines = append(lines, strings.ToLower(name)+":"+strings.Join(values, ","))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Sign returns the hex encoded signature of the request
+func Sign(secret []byte, r Request) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(r.Canonical()))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckTimestamp verifies the request was signed within tolerance of now. It is checked before
+// the signature, so stale requests are turned away without looking up a secret.
+func CheckTimestamp(r Request, now time.Time, tolerance time.Duration) error {
+	if r.Timestamp == "" || r.Nonce == "" || len(r.Nonce) > MaxNonceLength {
+		return ErrMissing
+	}
+	sec, err := strconv.ParseInt(r.Timestamp, 10, 64)
+	if err != nil {
+		return ErrTimestamp
+	}
+	skew := now.Sub(time.Unix(sec, 0))
+	if skew > tolerance || skew < -tolerance {
+		return ErrTimestamp
+	}
+	return nil
+}
+
+// Verify compares the signature against the one computed with secret in constant time
+func Verify(secret []byte, r Request, signature string) error {
+	got, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return ErrSignature
+	}
+	want, _ := hex.DecodeString(Sign(secret, r))
+	if !hmac.Equal(got, want) {
+		return ErrSignature
+	}
+	return nil
+}
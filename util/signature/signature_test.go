@@ -0,0 +1,83 @@
+package signature
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonical(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/pay?dry_run=1", nil)
+	req.Header.Set(HeaderTimestamp, "1700000000")
+	req.Header.Set(HeaderNonce, "n-1")
+	req.Header.Set("X-Account-Number", " 123 ")
+	r := FromHTTP(req, []byte(`{"amount":10}`), []string{"X-Account-Number", "X-Business-Name"})
+
+	lines := strings.Split(r.Canonical(), "\n")
+	require.Len(t, lines, 7)
+	assert.Equal(t, []string{"POST", "/api/pay?dry_run=1", "1700000000", "n-1"}, lines[:4])
+	assert.Len(t, lines[4], 64)
+	assert.Equal(t, "x-account-number:123", lines[5])
+	assert.Equal(t, "x-business-name:", lines[6])
+}
+
+func TestVerify(t *testing.T) {
+	secret := []byte("partner-secret")
+	header := http.Header{}
+	header.Set("X-Account-Number", "123")
+	r := Request{Method: "POST", URI: "/api/pay", Timestamp: "1700000000", Nonce: "n-1", Body: []byte("{}"), Headers: []string{"X-Account-Number"}, Header: header}
+	sig := Sign(secret, r)
+
+	assert.NoError(t, Verify(secret, r, sig))
+	assert.ErrorIs(t, Verify([]byte("other"), r, sig), ErrSignature)
+	assert.ErrorIs(t, Verify(secret, r, "not-hex"), ErrSignature)
+
+	tampered := r
+	tampered.Body = []byte(`{"amount":1000}`)
+	assert.ErrorIs(t, Verify(secret, tampered, sig), ErrSignature)
+
+	header.Set("X-Account-Number", "456")
+	assert.ErrorIs(t, Verify(secret, r, sig), ErrSignature, "signed headers are covered")
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	at := func(offset time.Duration) Request {
+		return Request{Timestamp: strconv.FormatInt(now.Add(offset).Unix(), 10), Nonce: "n"}
+	}
+	assert.NoError(t, CheckTimestamp(at(0), now, time.Minute))
+	assert.NoError(t, CheckTimestamp(at(-time.Minute), now, time.Minute))
+	assert.ErrorIs(t, CheckTimestamp(at(-2*time.Minute), now, time.Minute), ErrTimestamp)
+	assert.ErrorIs(t, CheckTimestamp(at(2*time.Minute), now, time.Minute), ErrTimestamp)
+	assert.ErrorIs(t, CheckTimestamp(Request{Timestamp: "soon", Nonce: "n"}, now, time.Minute), ErrTimestamp)
+	assert.ErrorIs(t, CheckTimestamp(Request{Timestamp: "1700000000"}, now, time.Minute), ErrMissing)
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Now()
+	s := NewMemoryStore(2)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	fresh, _ := s.Use(ctx, "a", now.Add(time.Minute))
+	assert.True(t, fresh)
+	fresh, _ = s.Use(ctx, "a", now.Add(time.Minute))
+	assert.False(t, fresh, "replayed")
+
+	s.Use(ctx, "b", now.Add(time.Second))
+	fresh, err := s.Use(ctx, "c", now.Add(time.Minute))
+	assert.False(t, fresh)
+	assert.ErrorIs(t, err, ErrFull)
+
+	now = now.Add(2 * time.Second)
+	fresh, err = s.Use(ctx, "c", now.Add(time.Minute))
+	assert.NoError(t, err)
+	assert.True(t, fresh, "expired nonces make room")
+}
@@ -0,0 +1,59 @@
+package signature
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrFull is returned by a MemoryStore that cannot remember another nonce
+var ErrFull = errors.New("nonce store full")
+
+// NonceStore remembers the nonces of verified requests so each one is accepted only once
+type NonceStore interface {
+	// Use records the nonce until expiresAt and reports whether it was new
+	Use(ctx context.Context, key string, expiresAt time.Time) (bool, error)
+}
+
+// DefaultMaxNonces bounds the nonces kept in memory
+const DefaultMaxNonces = 100000
+
+// MemoryStore keeps nonces in process, so a request replayed to another instance is not caught.
+// When it is full, new nonces fail with ErrFull until old ones expire.
+type MemoryStore struct {
+	max    int
+	nonces map[string]time.Time
+	now    func() time.Time
+	mu     sync.Mutex
+}
+
+func NewMemoryStore(max int) *MemoryStore {
+	return &MemoryStore{max: max, nonces: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *MemoryStore) Use(ctx context.Context, key string, expiresAt time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if exp, ok := s.nonces[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	if len(s.nonces) >= s.max {
+		for k, exp := range s.nonces {
+			if !now.Before(exp) {
+				delete(s.nonces, k)
+			}
+		}
+		if len(s.nonces) >= s.max {
+			return false, ErrFull
+		}
+	}
+	s.nonces[key] = expiresAt
+	return true, nil
+}
+
+// Default is the nonce store of the signature middleware. Replace it with a DatabaseStore
+// before the routes are loaded to catch replays across gateway instances.
+var Default NonceStore = NewMemoryStore(DefaultMaxNonces)